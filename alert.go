@@ -0,0 +1,412 @@
+package logging
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+type alertFormat int
+
+const (
+	// 通用 JSON, 请求体即 alertRecord
+	AlertJSON alertFormat = iota
+	// 钉钉群机器人 markdown 消息, Secret 为加签密钥
+	AlertDingTalk
+	// 企业微信群机器人 markdown 消息
+	AlertWeCom
+	// Slack incoming webhook
+	AlertSlack
+)
+
+const (
+	alertTimestampHeader = "X-Joker-Timestamp"
+	alertSignatureHeader = "X-Joker-Signature"
+)
+
+type AlertOptions struct {
+	NetSinkOptions
+	URL          string        // webhook 地址
+	Format       alertFormat   // 请求体模板
+	Secret       string        // 签名密钥, 钉钉使用 URL 加签, 其余格式写入签名请求头
+	Level        zapcore.Level // 最低告警级别, 默认 Error
+	Window       time.Duration // 限流窗口, 默认 1 分钟
+	MaxPerWindow int           // 同一指纹每个窗口最多发送条数, 默认 1
+	Timeout      time.Duration // 单次请求超时
+	MaxRetries   int           // 429 和 5xx 的重试次数
+	Backoff      time.Duration // 首次重试等待
+}
+
+// 告警输出, Error 及以上的日志按指纹分组限流后推送到 webhook,
+// 窗口内被抑制的条数在窗口结束时汇总推送
+type AlertSink struct {
+	*NetSink
+	opts AlertOptions
+
+	mu     sync.Mutex
+	groups map[string]*alertGroup
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+type alertGroup struct {
+	sent       int
+	suppressed int
+	sample     alertRecord
+}
+
+// 缓存和传输中的单条告警
+type alertRecord struct {
+	Fingerprint string                 `json:"fingerprint"`
+	Level       string                 `json:"level"`
+	Service     string                 `json:"service,omitempty"`
+	Logger      string                 `json:"logger"`
+	Message     string                 `json:"message"`
+	Caller      string                 `json:"caller,omitempty"`
+	Time        time.Time              `json:"time"`
+	TraceId     string                 `json:"trace_id,omitempty"`
+	Fields      map[string]interface{} `json:"fields,omitempty"`
+	Stack       string                 `json:"stack,omitempty"`
+	Suppressed  int                    `json:"suppressed,omitempty"` // 汇总消息中为窗口内被抑制的条数
+}
+
+func NewAlertSink(opts AlertOptions) (*AlertSink, error) {
+	if len(opts.Name) == 0 {
+		opts.Name = "alert"
+	}
+	if opts.Level < zapcore.ErrorLevel {
+		opts.Level = zapcore.ErrorLevel
+	}
+	if opts.Window == 0 {
+		opts.Window = time.Minute
+	}
+	if opts.MaxPerWindow == 0 {
+		opts.MaxPerWindow = 1
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	if opts.Backoff == 0 {
+		opts.Backoff = 500 * time.Millisecond
+	}
+	if opts.BatchSize == 0 {
+		// 每条告警单独请求, 失败重放时不会重复推送同批的其他告警
+		opts.BatchSize = 1
+	}
+	if opts.FlushInterval == 0 {
+		opts.FlushInterval = 100 * time.Millisecond
+	}
+	tr := &alertTransport{
+		opts:      opts,
+		client:    &http.Client{Timeout: opts.Timeout},
+		httpRetry: newHTTPRetry(opts.MaxRetries, opts.Backoff, opts.NetSinkOptions),
+	}
+	ns, err := NewNetSink(tr, opts.NetSinkOptions)
+	if err != nil {
+		return nil, err
+	}
+	as := &AlertSink{
+		NetSink: ns,
+		opts:    opts,
+		groups:  map[string]*alertGroup{},
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go as.run()
+	return as, nil
+}
+
+func (as *AlertSink) Core(opts *Options, enab zapcore.LevelEnabler) zapcore.Core {
+	return &alertCore{
+		LevelEnabler: enab,
+		sink:         as,
+		service:      opts.ServiceName,
+		logger:       opts.GetName(),
+		traceKey:     opts.registry().traceIdKey,
+	}
+}
+
+func (as *AlertSink) Close() error {
+	as.once.Do(func() {
+		close(as.stop)
+		<-as.done
+	})
+	return as.NetSink.Close()
+}
+
+// 每个窗口结束时推送抑制汇总并重置计数
+func (as *AlertSink) run() {
+	defer close(as.done)
+	ticker := time.NewTicker(as.opts.Window)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			as.rollWindow()
+		case <-as.stop:
+			as.rollWindow()
+			return
+		}
+	}
+}
+
+func (as *AlertSink) rollWindow() {
+	as.mu.Lock()
+	groups := as.groups
+	as.groups = map[string]*alertGroup{}
+	as.mu.Unlock()
+
+	fps := make([]string, 0, len(groups))
+	for fp := range groups {
+		fps = append(fps, fp)
+	}
+	sort.Strings(fps)
+	for _, fp := range fps {
+		g := groups[fp]
+		if g.suppressed == 0 {
+			continue
+		}
+		summary := g.sample
+		summary.Suppressed = g.suppressed
+		summary.Time = time.Now()
+		as.push(summary)
+	}
+}
+
+// 按指纹计数, 超出窗口配额时只记录抑制条数
+func (as *AlertSink) allow(rec alertRecord) bool {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	g, ok := as.groups[rec.Fingerprint]
+	if !ok {
+		g = &alertGroup{sample: rec}
+		as.groups[rec.Fingerprint] = g
+	}
+	if g.sent < as.opts.MaxPerWindow {
+		g.sent++
+		return true
+	}
+	g.suppressed++
+	return false
+}
+
+func (as *AlertSink) push(rec alertRecord) {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+	as.NetSink.Write(b)
+}
+
+type alertCore struct {
+	zapcore.LevelEnabler
+	sink     *AlertSink
+	service  string
+	logger   string
+	traceKey string
+	fields   []zapcore.Field
+}
+
+func (ac *alertCore) Enabled(lvl zapcore.Level) bool {
+	return lvl >= ac.sink.opts.Level && ac.LevelEnabler.Enabled(lvl)
+}
+
+func (ac *alertCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *ac
+	clone.fields = append(append([]zapcore.Field(nil), ac.fields...), fields...)
+	return &clone
+}
+
+func (ac *alertCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if ac.Enabled(ent.Level) {
+		return ce.AddCore(ent, ac)
+	}
+	return ce
+}
+
+func (ac *alertCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	all := fields
+	if len(ac.fields) > 0 {
+		all = append(append([]zapcore.Field(nil), ac.fields...), fields...)
+	}
+	values := fieldsToMap(all)
+	delete(values, "service_name")
+	rec := alertRecord{
+		Fingerprint: fingerprint(ent, all),
+		Level:       ent.Level.CapitalString(),
+		Service:     ac.service,
+		Logger:      ac.logger,
+		Message:     ent.Message,
+		Time:        ent.Time,
+		Stack:       ent.Stack,
+	}
+	if ent.Caller.Defined {
+		rec.Caller = ent.Caller.TrimmedPath()
+	}
+	if id, ok := values[ac.traceKey]; ok {
+		if id != nil {
+			rec.TraceId = fmt.Sprint(id)
+		}
+		delete(values, ac.traceKey)
+	}
+	if len(values) > 0 {
+		rec.Fields = values
+	}
+	if ac.sink.allow(rec) {
+		ac.sink.push(rec)
+	}
+	if ent.Level > zapcore.ErrorLevel {
+		// Panic 和 Fatal 之后进程可能退出, 立即发送
+		return ac.sink.Sync()
+	}
+	return nil
+}
+
+func (ac *alertCore) Sync() error {
+	return ac.sink.Sync()
+}
+
+type alertTransport struct {
+	opts   AlertOptions
+	client *http.Client
+	httpRetry
+}
+
+func (at *alertTransport) Send(records [][]byte) error {
+	for _, raw := range records {
+		var rec alertRecord
+		if err := json.Unmarshal(raw, &rec); err != nil {
+			continue
+		}
+		body, err := at.render(rec)
+		if err != nil {
+			continue
+		}
+		if err := at.post(body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (at *alertTransport) post(body []byte) error {
+	target := at.opts.URL
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	if len(at.opts.Secret) > 0 {
+		now := time.Now()
+		if at.opts.Format == AlertDingTalk {
+			target = dingTalkSign(target, at.opts.Secret, now)
+		} else {
+			ts := strconv.FormatInt(now.Unix(), 10)
+			header.Set(alertTimestampHeader, ts)
+			header.Set(alertSignatureHeader, SignAlert(at.opts.Secret, ts, body))
+		}
+	}
+	resp, err := at.postWithRetry(at.client, target, header, body)
+	if err != nil {
+		return err
+	}
+	if at.opts.Format == AlertDingTalk || at.opts.Format == AlertWeCom {
+		// 机器人接口出错时仍返回 200, 错误码在响应体中
+		var r struct {
+			ErrCode int    `json:"errcode"`
+			ErrMsg  string `json:"errmsg"`
+		}
+		if json.Unmarshal(resp, &r) == nil && r.ErrCode != 0 {
+			return permanentError{fmt.Errorf("alert webhook: %d %s", r.ErrCode, r.ErrMsg)}
+		}
+	}
+	return nil
+}
+
+// 通用签名: hex(hmac-sha256(secret, timestamp + "." + body)), 接收方据此校验来源
+func SignAlert(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// 钉钉加签: base64(hmac-sha256(secret, timestamp + "\n" + secret)), 毫秒时间戳
+func dingTalkSign(target, secret string, now time.Time) string {
+	ts := strconv.FormatInt(now.UnixNano()/int64(time.Millisecond), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "\n" + secret))
+	sign := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	sep := "?"
+	if strings.Contains(target, "?") {
+		sep = "&"
+	}
+	return target + sep + "timestamp=" + ts + "&sign=" + url.QueryEscape(sign)
+}
+
+func (at *alertTransport) render(rec alertRecord) ([]byte, error) {
+	switch at.opts.Format {
+	case AlertDingTalk:
+		title := alertTitle(rec)
+		return json.Marshal(map[string]interface{}{
+			"msgtype":  "markdown",
+			"markdown": map[string]string{"title": title, "text": "### " + title + "\n" + alertText(rec)},
+		})
+	case AlertWeCom:
+		return json.Marshal(map[string]interface{}{
+			"msgtype":  "markdown",
+			"markdown": map[string]string{"content": "**" + alertTitle(rec) + "**\n" + alertText(rec)},
+		})
+	case AlertSlack:
+		return json.Marshal(map[string]string{"text": "*" + alertTitle(rec) + "*\n" + alertText(rec)})
+	}
+	return json.Marshal(rec)
+}
+
+func alertTitle(rec alertRecord) string {
+	name := rec.Logger
+	if len(rec.Service) > 0 {
+		name = rec.Service + "/" + rec.Logger
+	}
+	return "[" + rec.Level + "] " + name
+}
+
+func alertText(rec alertRecord) string {
+	var sb strings.Builder
+	sb.WriteString("> " + rec.Message + "\n\n")
+	if rec.Suppressed > 0 {
+		sb.WriteString(fmt.Sprintf("- suppressed: %d similar alerts in the last window\n", rec.Suppressed))
+	}
+	sb.WriteString("- time: " + rec.Time.Format(time.RFC3339) + "\n")
+	if len(rec.Caller) > 0 {
+		sb.WriteString("- caller: " + rec.Caller + "\n")
+	}
+	if len(rec.TraceId) > 0 {
+		sb.WriteString("- trace_id: " + rec.TraceId + "\n")
+	}
+	keys := make([]string, 0, len(rec.Fields))
+	for k := range rec.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		sb.WriteString(fmt.Sprintf("- %s: %v\n", k, rec.Fields[k]))
+	}
+	sb.WriteString("- fingerprint: " + rec.Fingerprint)
+	return sb.String()
+}
+
+func (at *alertTransport) Close() error {
+	return nil
+}
@@ -0,0 +1,136 @@
+package logging
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type webhookServer struct {
+	*httptest.Server
+	mu   sync.Mutex
+	reqs []*http.Request
+	body []string
+}
+
+func newWebhookServer(resp string) *webhookServer {
+	ws := &webhookServer{}
+	ws.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		ws.mu.Lock()
+		ws.reqs = append(ws.reqs, r)
+		ws.body = append(ws.body, string(b))
+		ws.mu.Unlock()
+		w.Write([]byte(resp))
+	}))
+	return ws
+}
+
+func (ws *webhookServer) received() ([]*http.Request, []string) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	return append([]*http.Request(nil), ws.reqs...), append([]string(nil), ws.body...)
+}
+
+func TestAlertSinkRateLimit(t *testing.T) {
+	srv := newWebhookServer("ok")
+	defer srv.Close()
+
+	as, err := NewAlertSink(AlertOptions{URL: srv.URL, Secret: "s3cret", Window: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lg := zap.New(as.Core(&Options{ServiceName: "order", FileName: "api"}, zapcore.DebugLevel), zap.AddCaller())
+	lg.Warn("ignored")
+	for i := 0; i < 3; i++ {
+		lg.Error("order 100"+string(rune('0'+i))+" failed", zap.String("trace_id", "t1"))
+	}
+	lg.Error("other")
+	as.Sync()
+
+	reqs, bodies := srv.received()
+	if len(bodies) != 2 {
+		t.Fatalf("want 2 alerts, got %d: %v", len(bodies), bodies)
+	}
+	ts := reqs[0].Header.Get(alertTimestampHeader)
+	if reqs[0].Header.Get(alertSignatureHeader) != SignAlert("s3cret", ts, []byte(bodies[0])) {
+		t.Fatal("bad signature")
+	}
+	var first alertRecord
+	json.Unmarshal([]byte(bodies[0]), &first)
+	if first.Message != "order 1000 failed" || first.TraceId != "t1" || first.Service != "order" || first.Level != "ERROR" {
+		t.Fatalf("unexpected alert %+v", first)
+	}
+
+	// 关闭时推送窗口内的抑制汇总
+	as.Close()
+	_, bodies = srv.received()
+	if len(bodies) != 3 {
+		t.Fatalf("want summary alert, got %v", bodies)
+	}
+	var summary alertRecord
+	json.Unmarshal([]byte(bodies[2]), &summary)
+	if summary.Suppressed != 2 || summary.Fingerprint != first.Fingerprint {
+		t.Fatalf("unexpected summary %+v", summary)
+	}
+}
+
+func TestAlertSinkDingTalk(t *testing.T) {
+	srv := newWebhookServer(`{"errcode":0,"errmsg":"ok"}`)
+	defer srv.Close()
+
+	as, err := NewAlertSink(AlertOptions{URL: srv.URL + "/robot/send?access_token=x", Format: AlertDingTalk, Secret: "SEC"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer as.Close()
+	zap.New(as.Core(&Options{FileName: "api"}, zapcore.DebugLevel)).Error("db down", zap.String("db", "main"))
+	as.Sync()
+
+	reqs, bodies := srv.received()
+	if len(reqs) != 1 {
+		t.Fatalf("want 1 request, got %d", len(reqs))
+	}
+	q := reqs[0].URL.Query()
+	if q.Get("access_token") != "x" || len(q.Get("timestamp")) != 13 || len(q.Get("sign")) == 0 {
+		t.Fatalf("unexpected query %v", q)
+	}
+	var msg struct {
+		MsgType  string `json:"msgtype"`
+		Markdown struct {
+			Title string `json:"title"`
+			Text  string `json:"text"`
+		} `json:"markdown"`
+	}
+	json.Unmarshal([]byte(bodies[0]), &msg)
+	if msg.MsgType != "markdown" || msg.Markdown.Title != "[ERROR] api" || !strings.Contains(msg.Markdown.Text, "- db: main") {
+		t.Fatalf("unexpected payload %s", bodies[0])
+	}
+}
+
+func TestAlertSinkSlack(t *testing.T) {
+	srv := newWebhookServer("ok")
+	defer srv.Close()
+
+	as, err := NewAlertSink(AlertOptions{URL: srv.URL, Format: AlertSlack})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer as.Close()
+	zap.New(as.Core(&Options{ServiceName: "order", FileName: "api"}, zapcore.DebugLevel)).DPanic("bad state")
+
+	_, bodies := srv.received()
+	var msg map[string]string
+	if len(bodies) != 1 || json.Unmarshal([]byte(bodies[0]), &msg) != nil || !strings.HasPrefix(msg["text"], "*[DPANIC] order/api*") {
+		t.Fatalf("unexpected payload %v", bodies)
+	}
+}
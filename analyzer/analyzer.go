@@ -0,0 +1,359 @@
+// joker 调用点静态检查, 可通过 go vet -vettool 使用:
+// 键值对数量为奇数、键不是字符串、*f 模板与参数不匹配、
+// 以 err.Error() 为消息且存在 ctx 时未使用 *wc 方法
+package analyzer
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+const jokerPath = "github.com/braveghost/joker"
+
+var Analyzer = &analysis.Analyzer{
+	Name:     "joker",
+	Doc:      "check calls to joker logging functions and *Logging methods",
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run:      run,
+}
+
+type callKind int
+
+const (
+	kindW  callKind = iota + 1 // msg, keysAndValues...
+	kindWc                     // msg, ctx, keysAndValues...
+	kindF                      // template, args...
+	kindKV                     // keysAndValues...
+)
+
+var levels = []string{"Debug", "Info", "Warn", "Error", "DPanic", "Panic", "Fatal"}
+
+// 方法名到调用类型
+var kinds = func() map[string]callKind {
+	m := map[string]callKind{"With": kindKV}
+	for _, l := range levels {
+		m[l+"w"] = kindW
+		m[l+"wc"] = kindWc
+		m[l+"f"] = kindF
+	}
+	return m
+}()
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	ins := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+	nodes := []ast.Node{(*ast.CallExpr)(nil)}
+	ins.WithStack(nodes, func(n ast.Node, push bool, stack []ast.Node) bool {
+		if !push {
+			return true
+		}
+		call := n.(*ast.CallExpr)
+		name, kind := jokerCall(pass, call)
+		switch kind {
+		case kindW:
+			checkKV(pass, call, 1)
+			checkErrorMsg(pass, call, name, stack)
+		case kindWc:
+			checkKV(pass, call, 2)
+		case kindKV:
+			checkKV(pass, call, 0)
+		case kindF:
+			checkFormat(pass, call)
+		}
+		return true
+	})
+	return nil, nil
+}
+
+// 是否为 joker 的包级函数或 *Logging 方法
+func jokerCall(pass *analysis.Pass, call *ast.CallExpr) (string, callKind) {
+	fn, ok := typeutil.Callee(pass.TypesInfo, call).(*types.Func)
+	if !ok || fn.Pkg() == nil || fn.Pkg().Path() != jokerPath {
+		return "", 0
+	}
+	sig := fn.Type().(*types.Signature)
+	if recv := sig.Recv(); recv != nil {
+		ptr, ok := recv.Type().(*types.Pointer)
+		if !ok {
+			return "", 0
+		}
+		named, ok := ptr.Elem().(*types.Named)
+		if !ok || named.Obj().Name() != "Logging" {
+			return "", 0
+		}
+	} else if fn.Name() == "With" {
+		return "", 0
+	}
+	return fn.Name(), kinds[fn.Name()]
+}
+
+// 检查键值对: 键必须是字符串, 数量必须为偶数; zap.Field 可单独出现
+func checkKV(pass *analysis.Pass, call *ast.CallExpr, start int) {
+	if call.Ellipsis.IsValid() || len(call.Args) <= start {
+		return
+	}
+	args := call.Args[start:]
+	for i := 0; i < len(args); {
+		arg := args[i]
+		t := pass.TypesInfo.TypeOf(arg)
+		if isField(t) {
+			i++
+			continue
+		}
+		if !isString(t) {
+			d := analysis.Diagnostic{
+				Pos:     arg.Pos(),
+				End:     arg.End(),
+				Message: fmt.Sprintf("key %s is not a string, key-value pairs are probably shifted", types.ExprString(arg)),
+			}
+			if key := keyName(pass, arg); len(key) > 0 {
+				d.SuggestedFixes = []analysis.SuggestedFix{{
+					Message:   fmt.Sprintf("add key %q", key),
+					TextEdits: []analysis.TextEdit{{Pos: arg.Pos(), End: arg.Pos(), NewText: []byte(strconv.Quote(key) + ", ")}},
+				}}
+			}
+			pass.Report(d)
+			return
+		}
+		if i+1 == len(args) {
+			pass.Report(analysis.Diagnostic{
+				Pos:     arg.Pos(),
+				End:     arg.End(),
+				Message: fmt.Sprintf("key %s has no value, odd number of key-value arguments", types.ExprString(arg)),
+				SuggestedFixes: []analysis.SuggestedFix{{
+					Message:   "add nil value",
+					TextEdits: []analysis.TextEdit{{Pos: arg.End(), End: arg.End(), NewText: []byte(", nil")}},
+				}},
+			})
+			return
+		}
+		i += 2
+	}
+}
+
+// 由缺少键的值推断键名: 变量名、字段名或 error 类型的 err
+func keyName(pass *analysis.Pass, arg ast.Expr) string {
+	switch e := arg.(type) {
+	case *ast.Ident:
+		return e.Name
+	case *ast.SelectorExpr:
+		return e.Sel.Name
+	}
+	if types.Implements(pass.TypesInfo.TypeOf(arg), errorType) {
+		return "err"
+	}
+	return ""
+}
+
+var errorType = types.Universe.Lookup("error").Type().Underlying().(*types.Interface)
+
+func isString(t types.Type) bool {
+	b, ok := t.Underlying().(*types.Basic)
+	return ok && b.Info()&types.IsString != 0
+}
+
+func isField(t types.Type) bool {
+	named, ok := types.Unalias(t).(*types.Named)
+	if !ok || named.Obj().Pkg() == nil {
+		return false
+	}
+	return named.Obj().Name() == "Field" && named.Obj().Pkg().Path() == "go.uber.org/zap/zapcore"
+}
+
+// Xw(err.Error(), ...) 且所在函数有 ctx 参数时, 建议改用 Xwc 带上 trace id
+func checkErrorMsg(pass *analysis.Pass, call *ast.CallExpr, name string, stack []ast.Node) {
+	if len(call.Args) == 0 {
+		return
+	}
+	msg, ok := call.Args[0].(*ast.CallExpr)
+	if !ok || len(msg.Args) != 0 {
+		return
+	}
+	sel, ok := msg.Fun.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Error" || !types.Implements(pass.TypesInfo.TypeOf(sel.X), errorType) {
+		return
+	}
+	ctx := contextParam(pass, stack)
+	if len(ctx) == 0 {
+		return
+	}
+	fun := call.Fun
+	if s, ok := fun.(*ast.SelectorExpr); ok {
+		fun = s.Sel
+	}
+	pass.Report(analysis.Diagnostic{
+		Pos:     call.Pos(),
+		End:     call.End(),
+		Message: fmt.Sprintf("%s(%s) drops the trace id of %s, use %sc", name, types.ExprString(msg), ctx, name),
+		SuggestedFixes: []analysis.SuggestedFix{{
+			Message: fmt.Sprintf("use %sc with %s", name, ctx),
+			TextEdits: []analysis.TextEdit{
+				{Pos: fun.End(), End: fun.End(), NewText: []byte("c")},
+				{Pos: msg.End(), End: msg.End(), NewText: []byte(", " + ctx)},
+			},
+		}},
+	})
+}
+
+// 最近的外层函数中 context.Context 类型的参数名
+func contextParam(pass *analysis.Pass, stack []ast.Node) string {
+	for i := len(stack) - 1; i >= 0; i-- {
+		var ft *ast.FuncType
+		switch f := stack[i].(type) {
+		case *ast.FuncDecl:
+			ft = f.Type
+		case *ast.FuncLit:
+			ft = f.Type
+		default:
+			continue
+		}
+		for _, field := range ft.Params.List {
+			if !isContext(pass.TypesInfo.TypeOf(field.Type)) {
+				continue
+			}
+			for _, n := range field.Names {
+				if n.Name != "_" {
+					return n.Name
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func isContext(t types.Type) bool {
+	named, ok := types.Unalias(t).(*types.Named)
+	if !ok || named.Obj().Pkg() == nil {
+		return false
+	}
+	return named.Obj().Name() == "Context" && named.Obj().Pkg().Path() == "context"
+}
+
+// 检查 *f 方法的模板: 动词数量与参数数量一致, 常见动词与参数类型匹配
+func checkFormat(pass *analysis.Pass, call *ast.CallExpr) {
+	if call.Ellipsis.IsValid() || len(call.Args) == 0 {
+		return
+	}
+	tv, ok := pass.TypesInfo.Types[call.Args[0]]
+	if !ok || tv.Value == nil || tv.Value.Kind() != constant.String {
+		return
+	}
+	verbs, ok := parseVerbs(constant.StringVal(tv.Value))
+	if !ok {
+		// 带有 * 宽度或显式参数下标时不检查
+		return
+	}
+	args := call.Args[1:]
+	if len(verbs) != len(args) {
+		pass.Reportf(call.Args[0].Pos(), "format %s has %d verbs but %d args", types.ExprString(call.Args[0]), len(verbs), len(args))
+		return
+	}
+	for i, v := range verbs {
+		if matchVerb(v.verb, pass.TypesInfo.TypeOf(args[i])) {
+			continue
+		}
+		pos := call.Args[0].Pos() + token.Pos(v.offset)
+		d := analysis.Diagnostic{
+			Pos:     args[i].Pos(),
+			End:     args[i].End(),
+			Message: fmt.Sprintf("%%%c verb with arg %s of type %s", v.verb, types.ExprString(args[i]), pass.TypesInfo.TypeOf(args[i])),
+		}
+		if lit, ok := call.Args[0].(*ast.BasicLit); ok && !strings.Contains(lit.Value, `\`) {
+			// 无转义的字面量中偏移可直接换算为位置, 跳过引号和 % 以及标志, 建议改为 %v
+			at := pos + 2 + token.Pos(v.width)
+			d.SuggestedFixes = []analysis.SuggestedFix{{
+				Message:   "use %v",
+				TextEdits: []analysis.TextEdit{{Pos: at, End: at + 1, NewText: []byte("v")}},
+			}}
+		}
+		pass.Report(d)
+	}
+}
+
+type verb struct {
+	verb   rune
+	offset int // % 在模板中的位置
+	width  int // % 与动词之间的标志和宽度长度
+}
+
+// 解析模板中的动词, 含 * 或 [n] 时返回 false
+func parseVerbs(format string) ([]verb, bool) {
+	var verbs []verb
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		j := i + 1
+		for j < len(format) && strings.IndexByte("+-# 0123456789.", format[j]) >= 0 {
+			j++
+		}
+		if j >= len(format) {
+			break
+		}
+		c := format[j]
+		if c == '*' || c == '[' {
+			return nil, false
+		}
+		if c != '%' {
+			verbs = append(verbs, verb{verb: rune(c), offset: i, width: j - i - 1})
+		}
+		i = j
+	}
+	return verbs, true
+}
+
+// 常见动词的类型检查, 其余动词不判断
+func matchVerb(v rune, t types.Type) bool {
+	if t == nil {
+		return true
+	}
+	if _, ok := t.Underlying().(*types.Interface); ok {
+		return true
+	}
+	b, basic := t.Underlying().(*types.Basic)
+	switch v {
+	case 'd':
+		return basic && b.Info()&types.IsInteger != 0
+	case 'f', 'e', 'g':
+		return basic && b.Info()&(types.IsFloat|types.IsInteger) == types.IsFloat
+	case 't':
+		return basic && b.Kind() == types.Bool
+	case 's', 'q':
+		if basic {
+			return b.Info()&types.IsString != 0
+		}
+		if s, ok := t.Underlying().(*types.Slice); ok {
+			if e, ok := s.Elem().(*types.Basic); ok && e.Kind() == types.Byte {
+				return true
+			}
+		}
+		return implementsStringer(t)
+	}
+	return true
+}
+
+func implementsStringer(t types.Type) bool {
+	if types.Implements(t, errorType) {
+		return true
+	}
+	ms := types.NewMethodSet(t)
+	if _, ok := t.(*types.Pointer); !ok {
+		ms = types.NewMethodSet(types.NewPointer(t))
+	}
+	for i := 0; i < ms.Len(); i++ {
+		if m := ms.At(i).Obj(); m.Name() == "String" {
+			sig := m.Type().(*types.Signature)
+			return sig.Params().Len() == 0 && sig.Results().Len() == 1 && isString(sig.Results().At(0).Type())
+		}
+	}
+	return false
+}
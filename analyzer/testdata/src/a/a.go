@@ -0,0 +1,47 @@
+package a
+
+import (
+	"context"
+	"errors"
+
+	logging "github.com/braveghost/joker"
+)
+
+type user struct {
+	ID int
+}
+
+func kv(lg *logging.Logging, u user, err error) {
+	logging.Infow("ok", "id", u.ID, logging.String("k", "v"))
+	logging.Infow("odd", "id", u.ID, "name") // want `key "name" has no value`
+	lg.Errorw("shifted", u.ID, "name")       // want `key u.ID is not a string`
+	lg.Infow("error", "id", 1, err)          // want `key err is not a string`
+	lg.With("id", 1, 2)                      // want `key 2 is not a string`
+	kvs := []interface{}{"a"}
+	lg.Infow("spread", kvs...)
+}
+
+func wc(ctx context.Context) {
+	logging.Infowc("ok", ctx, "id", 1)
+	logging.Infowc("odd", ctx, "id") // want `key "id" has no value`
+}
+
+func format(lg *logging.Logging, name string, n int) {
+	logging.Infof("%s has %d items", name, n)
+	logging.Infof("100%% %s", name)
+	logging.Infof("%s has %d items", name) // want `format "%s has %d items" has 2 verbs but 1 args`
+	lg.Debugf("%d items", name)            // want `%d verb with arg name of type string`
+	lg.Debugf("%5.2f", n)                  // want `%f verb with arg n of type int`
+	lg.Debugf("%*d", 3, n)
+	lg.Debugf("%s", errors.New("x"))
+}
+
+func errMsg(ctx context.Context, lg *logging.Logging, err error) {
+	lg.Errorw(err.Error(), "id", 1) // want `Errorw\(err.Error\(\)\) drops the trace id of ctx, use Errorwc`
+	logging.Errorw(err.Error())     // want `Errorw\(err.Error\(\)\) drops the trace id of ctx, use Errorwc`
+	logging.Errorw("failed", "err", err)
+}
+
+func noCtx(lg *logging.Logging, err error) {
+	lg.Errorw(err.Error())
+}
@@ -0,0 +1,26 @@
+// 测试用的 joker 接口桩
+package logging
+
+import (
+	"context"
+
+	"go.uber.org/zap/zapcore"
+)
+
+type Field = zapcore.Field
+
+func String(key, val string) Field { return Field{Key: key} }
+
+type Logging struct{}
+
+func (lg *Logging) With(keysAndValues ...interface{}) *Logging                            { return lg }
+func (lg *Logging) Infow(msg string, keysAndValues ...interface{})                        {}
+func (lg *Logging) Errorw(msg string, keysAndValues ...interface{})                       {}
+func (lg *Logging) Errorwc(msg string, ctx context.Context, keysAndValues ...interface{}) {}
+func (lg *Logging) Debugf(template string, args ...interface{})                           {}
+
+func Infow(msg string, keysAndValues ...interface{})                        {}
+func Errorw(msg string, keysAndValues ...interface{})                       {}
+func Infowc(msg string, ctx context.Context, keysAndValues ...interface{})  {}
+func Errorwc(msg string, ctx context.Context, keysAndValues ...interface{}) {}
+func Infof(template string, args ...interface{})                            {}
@@ -0,0 +1,171 @@
+package logging
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func newDiscardCore(lvl zapcore.Level) zapcore.Core {
+	return zapcore.NewCore(zapcore.NewJSONEncoder(*defaultEncoderConfig), zapcore.AddSync(ioutil.Discard), lvl)
+}
+
+func newBenchZap() *zap.Logger {
+	return zap.New(newDiscardCore(zapcore.InfoLevel), zap.AddCaller())
+}
+
+// 以下基准对比 joker 与直接使用 zap 的各类方法, Disabled 为级别未开启的情况
+
+func BenchmarkJokerInfo(b *testing.B) {
+	lg := newDiscardLogger(b, nil)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		lg.Info("message")
+	}
+}
+
+func BenchmarkZapSugarInfo(b *testing.B) {
+	s := newBenchZap().Sugar()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		s.Info("message")
+	}
+}
+
+func BenchmarkJokerInfof(b *testing.B) {
+	lg := newDiscardLogger(b, nil)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		lg.Infof("message %d", i)
+	}
+}
+
+func BenchmarkZapSugarInfof(b *testing.B) {
+	s := newBenchZap().Sugar()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		s.Infof("message %d", i)
+	}
+}
+
+func BenchmarkJokerInfow(b *testing.B) {
+	lg := newDiscardLogger(b, nil)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		lg.Infow("message", "k", "v", "n", i)
+	}
+}
+
+func BenchmarkZapSugarInfow(b *testing.B) {
+	s := newBenchZap().Sugar()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		s.Infow("message", "k", "v", "n", i)
+	}
+}
+
+func BenchmarkJokerInfowc(b *testing.B) {
+	lg := newDiscardLogger(b, nil)
+	ctx := WithTraceId(context.Background(), "t1")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		lg.Infowc("message", ctx, "k", "v", "n", i)
+	}
+}
+
+// 开启尾部采样和错误汇总, 每个 trace 一条日志, 结束时按比例丢弃
+func BenchmarkJokerInfowcSampled(b *testing.B) {
+	lg := newDiscardLogger(b, &Options{TailSampling: &TailRule{SampleRate: 0.1}, Digest: GetDefaultDigestRule()})
+	ctx := WithTraceId(context.Background(), "t1")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		lg.Infowc("message", ctx, "k", "v", "n", i)
+		lg.Finish(ctx)
+	}
+}
+
+func BenchmarkZapSugarInfowTrace(b *testing.B) {
+	s := newBenchZap().Sugar()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		s.Infow("message", "k", "v", "n", i, "trace_id", "t1")
+	}
+}
+
+func BenchmarkJokerInfoz(b *testing.B) {
+	lg := newDiscardLogger(b, nil)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		lg.Infoz("message", String("k", "v"), Int("n", i))
+	}
+}
+
+func BenchmarkZapInfo(b *testing.B) {
+	l := newBenchZap()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.Info("message", zap.String("k", "v"), zap.Int("n", i))
+	}
+}
+
+func BenchmarkJokerInfozc(b *testing.B) {
+	lg := newDiscardLogger(b, nil)
+	ctx := WithTraceId(context.Background(), "t1")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		lg.Infozc("message", ctx, String("k", "v"), Int("n", i))
+	}
+}
+
+func BenchmarkJokerDebugwDisabled(b *testing.B) {
+	lg := newDiscardLogger(b, nil)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		lg.Debugw("message", "k", "v")
+	}
+}
+
+func BenchmarkZapSugarDebugwDisabled(b *testing.B) {
+	s := newBenchZap().Sugar()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		s.Debugw("message", "k", "v")
+	}
+}
+
+func BenchmarkJokerDebugwcDisabled(b *testing.B) {
+	lg := newDiscardLogger(b, nil)
+	ctx := WithTraceId(context.Background(), "t1")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		lg.Debugwc("message", ctx, "k", "v")
+	}
+}
+
+func BenchmarkJokerDebugzDisabled(b *testing.B) {
+	lg := newDiscardLogger(b, nil)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		lg.Debugz("message", String("k", "v"))
+	}
+}
+
+func BenchmarkJokerDebugzcDisabled(b *testing.B) {
+	lg := newDiscardLogger(b, nil)
+	ctx := WithTraceId(context.Background(), "t1")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		lg.Debugzc("message", ctx, String("k", "v"))
+	}
+}
+
+func BenchmarkZapDebugDisabled(b *testing.B) {
+	l := newBenchZap()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.Debug("message", zap.String("k", "v"))
+	}
+}
@@ -0,0 +1,259 @@
+package logging
+
+import (
+	"context"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// 日志名称, 子日志为以点分隔的完整名称
+func (lg *Logging) Name() string {
+	if len(lg.name) > 0 {
+		return lg.name
+	}
+	if lg.opts == nil {
+		return ""
+	}
+	return lg.opts.GetName()
+}
+
+// 复制日志对象, 与父日志共享输出、采样和汇总
+func (lg *Logging) clone() *Logging {
+	child := *lg
+	return &child
+}
+
+// With 返回附加键值对的子日志, 之后的每条日志都带有这些字段
+func (lg *Logging) With(keysAndValues ...interface{}) *Logging {
+	if !lg.status || len(keysAndValues) == 0 {
+		return lg
+	}
+	if lg.strict {
+		lg.validateKV("With", "", keysAndValues, false)
+	}
+	child := lg.clone()
+	child.withKeys = appendKeys(lg.withKeys[:len(lg.withKeys):len(lg.withKeys)], keysAndValues)
+	child.logger = lg.logger.With(keysAndValues...)
+	if lg.debugLogger != nil {
+		child.debugLogger = lg.debugLogger.With(keysAndValues...)
+	}
+	child.derive()
+	return child
+}
+
+// 键值对中的键, 强类型字段取其键名
+func appendKeys(keys []string, keysAndValues []interface{}) []string {
+	for i := 0; i < len(keysAndValues); {
+		if f, ok := keysAndValues[i].(zapcore.Field); ok {
+			keys = append(keys, f.Key)
+			i++
+			continue
+		}
+		if key, ok := keysAndValues[i].(string); ok {
+			keys = append(keys, key)
+		}
+		i += 2
+	}
+	return keys
+}
+
+// Named 返回名为 父名称.sub 的子日志, 级别可通过注册表按名称设置
+func (lg *Logging) Named(sub string) *Logging {
+	if !lg.status || len(sub) == 0 {
+		return lg
+	}
+	child := lg.clone()
+	child.name = lg.Name() + "." + sub
+	child.logger = lg.named(lg.logger).Named(sub).Desugar().WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return bindName(core, child.name)
+	})).Sugar()
+	if lg.debugLogger != nil {
+		child.debugLogger = lg.named(lg.debugLogger).Named(sub)
+	}
+	child.derive()
+	return child
+}
+
+// 将引擎中的 nameLevelCore 绑定到子日志的名称, 名称级别只在注册表变化后重新查找
+func bindName(core zapcore.Core, name string) zapcore.Core {
+	switch c := core.(type) {
+	case *nameLevelCore:
+		clone := *c
+		clone.bound, clone.cache = name, &levelCache{}
+		return &clone
+	case *tailCore:
+		clone := *c
+		clone.Core = bindName(c.Core, name)
+		return &clone
+	case *errorFieldCore:
+		clone := *c
+		clone.Core = bindName(c.Core, name)
+		return &clone
+	}
+	return core
+}
+
+// 根日志输出时不带名称, 派生子日志时先补上
+func (lg *Logging) named(s *zap.SugaredLogger) *zap.SugaredLogger {
+	if len(lg.name) > 0 {
+		return s
+	}
+	return s.Named(lg.Name())
+}
+
+// WithContext 返回附加 ctx 中 trace id 和 span id 的子日志, ctx 开启 debug 时子日志输出 debug 级别;
+// 子日志的 *wc 方法不再重复追加 trace id
+func (lg *Logging) WithContext(ctx context.Context) *Logging {
+	if !lg.status || ctx == nil {
+		return lg
+	}
+	reg := lg.registry()
+	var kv []interface{}
+	if id := reg.GetTraceId(ctx); id != nil {
+		kv = append(kv, reg.traceIdKey, id)
+	}
+	if id := reg.GetSpanId(ctx); id != nil {
+		kv = append(kv, reg.SpanIdKey(), id)
+	}
+	child := lg.With(kv...)
+	if len(kv) > 0 {
+		child.traced = true
+	}
+	if child.debugLogger != nil && IsDebug(ctx) {
+		if child == lg {
+			child = lg.clone()
+		}
+		child.logger = child.debugLogger
+		child.derive()
+	}
+	return child
+}
+
+type loggerCtxKey struct{}
+
+// ToContext 将日志对象存入 ctx, 之后通过 FromContext 取出
+func ToContext(ctx context.Context, lg *Logging) context.Context {
+	return context.WithValue(ctx, loggerCtxKey{}, lg)
+}
+
+// FromContext 取出 ctx 中的日志对象, 不存在时返回附加了 ctx 中 trace id 的默认日志
+func FromContext(ctx context.Context) *Logging {
+	if lg := loggerFromContext(ctx); lg != nil {
+		return lg
+	}
+	return defaultRegistry.Default().WithContext(ctx)
+}
+
+// ctx 中的日志对象, 不存在时为默认日志, 供包级 *wc 方法使用
+func contextLogger(ctx context.Context) *Logging {
+	if lg := loggerFromContext(ctx); lg != nil {
+		return lg.fromPackage()
+	}
+	return defaultRegistry.Default().fromPackage()
+}
+
+func loggerFromContext(ctx context.Context) *Logging {
+	if ctx == nil {
+		return nil
+	}
+	lg, _ := ctx.Value(loggerCtxKey{}).(*Logging)
+	return lg
+}
+
+// 按注册表中的名称级别过滤, 级别低于日志本身时改由 debug 引擎输出
+type nameLevelCore struct {
+	zapcore.Core
+	debug zapcore.Core // 默认级别高于 debug 时存在
+	reg   *Registry
+	root  string      // 根日志的名称, 根日志条目不带 LoggerName
+	bound string      // Named 派生时绑定的名称, 为空表示根日志
+	cache *levelCache // 绑定名称的级别, With 派生的引擎共用
+}
+
+func newNameLevelCore(core, debug zapcore.Core, reg *Registry, root string) *nameLevelCore {
+	return &nameLevelCore{Core: core, debug: debug, reg: reg, root: root, cache: &levelCache{}}
+}
+
+// 缓存的名称级别及解析时注册表的版本
+type levelCacheEntry struct {
+	gen uint32
+	lvl zapcore.Level
+	ok  bool
+}
+
+type levelCache struct {
+	v atomic.Value // levelCacheEntry
+}
+
+// 注册表的名称级别未变化时直接使用缓存, 否则重新查找
+func (lc *levelCache) get(reg *Registry, name string) (zapcore.Level, bool) {
+	gen := reg.levelsGeneration()
+	if e, ok := lc.v.Load().(levelCacheEntry); ok && e.gen == gen {
+		return e.lvl, e.ok
+	}
+	lvl, ok := reg.levelOf(name)
+	lc.v.Store(levelCacheEntry{gen: gen, lvl: lvl, ok: ok})
+	return lvl, ok
+}
+
+func (nc *nameLevelCore) name(ent zapcore.Entry) string {
+	if len(ent.LoggerName) > 0 {
+		return ent.LoggerName
+	}
+	return nc.root
+}
+
+func (nc *nameLevelCore) boundName() string {
+	if len(nc.bound) > 0 {
+		return nc.bound
+	}
+	return nc.root
+}
+
+// 绑定名称使用缓存, 直接通过 zap 派生的其他名称每次查找
+func (nc *nameLevelCore) levelOf(name string) (zapcore.Level, bool) {
+	if !nc.reg.hasLevels() {
+		return 0, false
+	}
+	if nc.cache == nil || name != nc.boundName() {
+		return nc.reg.levelOf(name)
+	}
+	return nc.cache.get(nc.reg, name)
+}
+
+func (nc *nameLevelCore) Enabled(lvl zapcore.Level) bool {
+	if nc.Core.Enabled(lvl) {
+		return true
+	}
+	if nc.debug == nil {
+		return false
+	}
+	// 低于默认级别时按绑定名称的级别判断
+	min, ok := nc.levelOf(nc.boundName())
+	return ok && lvl >= min
+}
+
+func (nc *nameLevelCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *nc
+	clone.Core = nc.Core.With(fields)
+	if nc.debug != nil {
+		clone.debug = nc.debug.With(fields)
+	}
+	return &clone
+}
+
+func (nc *nameLevelCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	lvl, ok := nc.levelOf(nc.name(ent))
+	if !ok {
+		return nc.Core.Check(ent, ce)
+	}
+	if ent.Level < lvl {
+		return ce
+	}
+	if nc.Core.Enabled(ent.Level) || nc.debug == nil {
+		return nc.Core.Check(ent, ce)
+	}
+	return nc.debug.Check(ent, ce)
+}
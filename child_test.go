@@ -0,0 +1,152 @@
+package logging
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestChildLogger(t *testing.T) {
+	reg := NewRegistry()
+	core, logs := observer.New(zapcore.InfoLevel)
+	debugCore, debugLogs := observer.New(zapcore.DebugLevel)
+	lg := &Logging{status: true, opts: &Options{FileName: "order"}, level: zapcore.InfoLevel, reg: reg}
+	lg.debugLogger = lg.newSugar(debugCore)
+	lg.logger = lg.newSugar(newNameLevelCore(core, debugCore, reg, "order"))
+
+	child := lg.Named("payment").With("order_id", 7)
+	if child.Name() != "order.payment" || lg.Name() != "order" {
+		t.Fatalf("unexpected names %s %s", child.Name(), lg.Name())
+	}
+	child.Info("paid")
+	child.Debug("hidden")
+	if logs.Len() != 1 || debugLogs.Len() != 0 {
+		t.Fatalf("unexpected entries %d %d", logs.Len(), debugLogs.Len())
+	}
+	e := logs.All()[0]
+	if e.LoggerName != "order.payment" || e.ContextMap()["order_id"] != int64(7) {
+		t.Fatalf("unexpected entry %+v", e)
+	}
+
+	// 子名称的级别优先于父名称
+	reg.SetLevel("order.payment", zapcore.DebugLevel)
+	reg.SetLevel("order", zapcore.WarnLevel)
+	child.Named("refund").Debug("debug")
+	lg.Info("dropped")
+	lg.Warn("kept")
+	if debugLogs.Len() != 1 || debugLogs.All()[0].LoggerName != "order.payment.refund" {
+		t.Fatalf("child debug should use debug core, got %d", debugLogs.Len())
+	}
+	if logs.Len() != 2 || logs.All()[1].Message != "kept" {
+		t.Fatalf("root level not applied, got %d", logs.Len())
+	}
+
+	reg.ResetLevel("order")
+	reg.ResetLevel("order.payment")
+	ctx := reg.WithTraceId(WithDebug(context.Background()), "t1")
+	lg.WithContext(ctx).Debug("traced")
+	if debugLogs.Len() != 2 || debugLogs.All()[1].ContextMap()["trace_id"] != "t1" {
+		t.Fatalf("context child should carry trace id and debug level")
+	}
+}
+
+func TestContextLogger(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	lg := &Logging{status: true, opts: &Options{FileName: "api"}}
+	lg.logger = lg.newSugar(core)
+
+	ctx := WithTraceId(context.Background(), "t1")
+	ctx = ToContext(ctx, lg.WithContext(ctx).With("user", 1))
+	if FromContext(ctx).Name() != "api" {
+		t.Fatal("FromContext should return the stored logger")
+	}
+	Infowc("handled", ctx, "n", 2)
+	if logs.Len() != 1 {
+		t.Fatalf("package Infowc should use the context logger, got %d", logs.Len())
+	}
+	e := logs.All()[0]
+	traces := 0
+	for _, f := range e.Context {
+		if f.Key == "trace_id" {
+			traces++
+		}
+	}
+	if traces != 1 || e.ContextMap()["user"] != int64(1) || e.ContextMap()["n"] != int64(2) {
+		t.Fatalf("unexpected entry %+v", e)
+	}
+
+	fallback := FromContext(WithTraceId(context.Background(), "t2"))
+	if !fallback.traced || fallback.Name() != defaultRegistry.Default().Name() {
+		t.Fatal("fallback should be the default logger with trace id")
+	}
+}
+
+// ctx 中的日志和默认日志回退都经过尾部采样
+func TestContextLoggerTailSampling(t *testing.T) {
+	lg, logs := newTailTestLogger(&TailRule{MaxEntries: 10, MaxTraces: 10})
+	defer lg.tail.close()
+	useDefaultLogger(t, lg)
+
+	stored := WithTraceId(context.Background(), "stored")
+	stored = ToContext(stored, lg.WithContext(stored))
+	FromContext(stored).Infow("a")
+	Infowc("b", stored)
+
+	fallback := WithTraceId(context.Background(), "fallback")
+	FromContext(fallback).Errorw("c")
+	if logs.Len() != 0 {
+		t.Fatalf("traced entries should be buffered, got %d", logs.Len())
+	}
+
+	lg.Finish(stored)
+	lg.Finish(fallback)
+	if logs.Len() != 1 || logs.All()[0].Message != "c" || logs.All()[0].ContextMap()["trace_id"] != "fallback" {
+		t.Fatalf("only the failed trace should be flushed, got %v", logs.All())
+	}
+}
+
+// 子日志缓存按名称解析的级别, Enabled 按绑定名称判断, 注册表级别变化后重新解析
+func TestNameLevelCache(t *testing.T) {
+	reg := NewRegistry()
+	core, _ := observer.New(zapcore.InfoLevel)
+	debugCore, debugLogs := observer.New(zapcore.DebugLevel)
+	lg := &Logging{status: true, opts: &Options{FileName: "order"}, level: zapcore.InfoLevel, reg: reg}
+	lg.debugLogger = lg.newSugar(debugCore)
+	lg.logger = lg.newSugar(newNameLevelCore(core, debugCore, reg, "order"))
+	child := lg.Named("payment")
+	enabled := func(l *Logging) bool { return l.logger.Desugar().Core().Enabled(zapcore.DebugLevel) }
+
+	reg.SetLevel("order.payment", zapcore.DebugLevel)
+	if enabled(lg) || !enabled(child) {
+		t.Fatal("only the child should enable debug")
+	}
+	child.Debug("a")
+
+	// 已缓存时不再读取注册表, 持有注册表的锁也能写入
+	reg.mu.Lock()
+	done := make(chan struct{})
+	go func() {
+		child.Debug("b")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("cached level should not take the registry lock")
+	}
+	reg.mu.Unlock()
+
+	reg.ResetLevel("order.payment")
+	child.Debug("dropped")
+	if enabled(child) || debugLogs.Len() != 2 {
+		t.Fatalf("reset level should take effect, got %d entries", debugLogs.Len())
+	}
+	reg.SetLevel("order", zapcore.DebugLevel)
+	child.Debug("c")
+	if debugLogs.Len() != 3 {
+		t.Fatal("parent level should apply after the cache is invalidated")
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"sort"
+
+	logging "github.com/braveghost/joker"
+	"github.com/braveghost/joker/reader"
+)
+
+func runGrep(args []string) error {
+	fs := flag.NewFlagSet("grep", flag.ExitOnError)
+	var (
+		sf sourceFlags
+		ff filterFlags
+	)
+	sf.register(fs)
+	ff.register(fs)
+	traceKey := fs.String("trace-key", "trace_id", "field name of the trace id")
+	asJSON := fs.Bool("json", false, "print JSON lines")
+	fs.Parse(args)
+
+	f, err := ff.filter(*traceKey)
+	if err != nil {
+		return err
+	}
+	it, err := sf.source().Open(f)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	write := writeConsole
+	if *asJSON {
+		write = writeJSON
+	}
+	for it.Next() {
+		if err := write(w, it.Entry()); err != nil {
+			return err
+		}
+	}
+	return it.Err()
+}
+
+// 控制台格式转为 JSON 行, 参数为文件时只转换这些文件
+func runConvert(args []string) error {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	var sf sourceFlags
+	sf.register(fs)
+	fs.Usage = func() {
+		fs.Output().Write([]byte("usage: joker convert [flags] [files...]\n"))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	src := sf.source()
+	var (
+		it  *reader.Iterator
+		err error
+	)
+	if fs.NArg() > 0 {
+		it, err = src.OpenFiles(fs.Args(), reader.Filter{})
+	} else {
+		it, err = src.Open(reader.Filter{})
+	}
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	for it.Next() {
+		if err := writeJSON(w, it.Entry()); err != nil {
+			return err
+		}
+	}
+	return it.Err()
+}
+
+// 与 joker 默认编码一致的时间格式
+const outTimeLayout = "2006-01-02T15:04:05.0000"
+
+// 按 joker 的控制台格式输出
+func writeConsole(w *bufio.Writer, e *reader.Entry) error {
+	w.WriteString(e.Time.Format(outTimeLayout))
+	w.WriteByte('\t')
+	w.WriteString(e.Level.CapitalString())
+	for _, s := range []string{e.Logger, e.Caller} {
+		if len(s) > 0 {
+			w.WriteByte('\t')
+			w.WriteString(s)
+		}
+	}
+	w.WriteByte('\t')
+	w.WriteString(e.Message)
+	if len(e.Fields) > 0 {
+		b, err := marshal(e.Fields)
+		if err != nil {
+			return err
+		}
+		w.WriteByte('\t')
+		w.Write(b)
+	}
+	if len(e.Stack) > 0 {
+		w.WriteByte('\n')
+		w.WriteString(e.Stack)
+	}
+	return w.WriteByte('\n')
+}
+
+// 按 joker 默认编码的键输出 JSON 行, 固定字段在前, 其余字段按键排序
+func writeJSON(w *bufio.Writer, e *reader.Entry) error {
+	ec := logging.Options{}.GetEncoderConfig()
+	type kv struct {
+		key string
+		val interface{}
+	}
+	pairs := []kv{{ec.TimeKey, e.Time.Format(outTimeLayout)}, {ec.LevelKey, e.Level.String()}}
+	if len(e.Logger) > 0 {
+		pairs = append(pairs, kv{ec.NameKey, e.Logger})
+	}
+	if len(e.Caller) > 0 {
+		pairs = append(pairs, kv{ec.CallerKey, e.Caller})
+	}
+	pairs = append(pairs, kv{ec.MessageKey, e.Message})
+	keys := make([]string, 0, len(e.Fields))
+	for k := range e.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		pairs = append(pairs, kv{k, e.Fields[k]})
+	}
+	if len(e.Stack) > 0 {
+		pairs = append(pairs, kv{ec.StacktraceKey, e.Stack})
+	}
+
+	w.WriteByte('{')
+	for i, p := range pairs {
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		if err := writeJSONPair(w, p.key, p.val); err != nil {
+			return err
+		}
+	}
+	w.WriteString("}\n")
+	return nil
+}
+
+func writeJSONPair(w *bufio.Writer, key string, val interface{}) error {
+	k, err := marshal(key)
+	if err != nil {
+		return err
+	}
+	v, err := marshal(val)
+	if err != nil {
+		return err
+	}
+	w.Write(k)
+	w.WriteByte(':')
+	_, err = w.Write(v)
+	return err
+}
+
+// 不转义 HTML 字符, 与 zap 的输出一致
+func marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
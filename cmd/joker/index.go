@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/braveghost/joker/index"
+	"github.com/braveghost/joker/reader"
+)
+
+// 为切割后的文件补建索引, 当前文件仍在写入, 不建立索引
+func runIndex(args []string) error {
+	fs := flag.NewFlagSet("index", flag.ExitOnError)
+	var sf sourceFlags
+	sf.register(fs)
+	traceKey := fs.String("trace-key", "trace_id", "field name of the trace id")
+	bucket := fs.Duration("bucket", time.Minute, "size of the time buckets")
+	force := fs.Bool("force", false, "rebuild existing indexes")
+	show := fs.Bool("show", false, "only list the files and their indexes")
+	fs.Usage = func() {
+		fs.Output().Write([]byte("usage: joker index [flags] [files...]\n"))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	src := sf.source()
+	files := fs.Args()
+	if len(files) == 0 {
+		all, err := src.Files()
+		if err != nil {
+			return err
+		}
+		active := activeFile(src, all)
+		for _, f := range all {
+			if f != active {
+				files = append(files, f)
+			}
+		}
+	}
+	if *show {
+		return showIndexes(files)
+	}
+
+	opts := index.Options{TraceKey: *traceKey, Bucket: *bucket}
+	if len(sf.timeLayout) > 0 {
+		opts.TimeLayouts = []string{sf.timeLayout}
+	}
+	for _, f := range files {
+		if ix, err := index.Open(f); err == nil && ix.Matches(f) && !*force {
+			continue
+		}
+		if err := index.Build(f, opts); err != nil {
+			return fmt.Errorf("%s: %v", f, err)
+		}
+		fmt.Println(index.Path(f))
+	}
+	return nil
+}
+
+// 仍在写入的文件: 大小切割时为 <name>.log, 时间切割时 <name>.log 是软链接,
+// 指向最新的 <name>.log.%Y%m%d, 没有软链接时同样取最新的按时间切割的文件
+func activeFile(src reader.Source, files []string) string {
+	current := src.Current()
+	if fi, err := os.Lstat(current); err == nil && fi.Mode()&os.ModeSymlink == 0 {
+		return current
+	}
+	if target, err := filepath.EvalSymlinks(current); err == nil {
+		if abs, err := filepath.Abs(target); err == nil {
+			for _, f := range files {
+				if fa, _ := filepath.Abs(f); fa == abs {
+					return f
+				}
+			}
+		}
+	}
+	prefix := src.Name + ".log."
+	for i := len(files) - 1; i >= 0; i-- {
+		base := filepath.Base(files[i])
+		if strings.HasPrefix(base, prefix) && !strings.HasSuffix(base, ".gz") {
+			return files[i]
+		}
+	}
+	return ""
+}
+
+func showIndexes(files []string) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "FILE\tTRACE KEY\tFIRST\tLAST\tINDEX")
+	for _, f := range files {
+		ix, err := index.Open(f)
+		if err != nil {
+			status := "missing"
+			if !os.IsNotExist(err) {
+				status = err.Error()
+			}
+			fmt.Fprintf(w, "%s\t\t\t\t%s\n", f, status)
+			continue
+		}
+		first, last := ix.Range()
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", f, ix.TraceKey(),
+			first.Format(outTimeLayout), last.Format(outTimeLayout), index.Path(f))
+	}
+	return w.Flush()
+}
@@ -0,0 +1,170 @@
+// joker 查询和跟踪日志文件, 按 trace id、级别和时间范围过滤:
+//
+//	joker tail -f -dir /data/logs -name order
+//	joker grep --trace-id 8f2c... -since 2h
+//	joker stats -level warn
+//	joker convert -name order > order.jsonl
+//	joker index -name order
+//
+// 文件按 <name>.log.%Y%m%d 和 <name>-<时间>.log 查找, 含 .gz, -error 时读取 <name>_error 文件;
+// 切割后的文件有旁路索引时, grep 和 stats 据此跳过无关文件并直接定位到匹配的行
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/braveghost/joker/reader"
+)
+
+// 与 joker 设置日志路径的环境变量一致
+const envKeyLogPath = "LOGGING_JOKER_PATH"
+
+const usage = `usage: joker <command> [flags]
+
+commands:
+  tail     print the end of the current file, -f follows it across rotations
+  grep     search every rotated and compressed file by trace id, level, time and fields
+  stats    count entries per level, caller and message
+  convert  turn console format into JSON lines
+  index    build sidecar indexes for rotated files, used by grep and stats
+
+run "joker <command> -h" for the flags of a command
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var err error
+	switch cmd, args := os.Args[1], os.Args[2:]; cmd {
+	case "tail":
+		err = runTail(args)
+	case "grep":
+		err = runGrep(args)
+	case "stats":
+		err = runStats(args)
+	case "convert":
+		err = runConvert(args)
+	case "index":
+		err = runIndex(args)
+	case "-h", "-help", "--help", "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "joker: unknown command %q\n\n%s", cmd, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "joker:", err)
+		os.Exit(1)
+	}
+}
+
+// 各命令共用的文件定位参数
+type sourceFlags struct {
+	dir        string
+	name       string
+	errorLog   bool
+	timeLayout string
+	noIndex    bool
+}
+
+func (sf *sourceFlags) register(fs *flag.FlagSet) {
+	dir := os.Getenv(envKeyLogPath)
+	if len(dir) == 0 {
+		dir = "."
+	}
+	fs.StringVar(&sf.dir, "dir", dir, "log directory, defaults to $"+envKeyLogPath)
+	fs.StringVar(&sf.name, "name", "joker", "log file name without .log")
+	fs.BoolVar(&sf.errorLog, "error", false, "read <name>_error files")
+	fs.StringVar(&sf.timeLayout, "time-layout", "", "time layout of the files, empty tries the common ones")
+	fs.BoolVar(&sf.noIndex, "no-index", false, "ignore sidecar indexes and read every file in full")
+}
+
+func (sf *sourceFlags) source() reader.Source {
+	src := reader.Source{Dir: sf.dir, Name: sf.name, TimeLayout: sf.timeLayout, NoIndex: sf.noIndex}
+	if sf.errorLog {
+		src.Name += "_error"
+	}
+	return src
+}
+
+// 过滤参数
+type filterFlags struct {
+	traceId string
+	level   string
+	since   string
+	until   string
+	fields  fieldFlag
+}
+
+func (ff *filterFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&ff.traceId, "trace-id", "", "only entries with this trace id")
+	fs.StringVar(&ff.level, "level", "", "minimum level, e.g. warn")
+	fs.StringVar(&ff.since, "since", "", "start time, e.g. 2h, 2006-01-02 or 2006-01-02T15:04:05")
+	fs.StringVar(&ff.until, "until", "", "end time, same formats as -since")
+	fs.Var(&ff.fields, "field", "key=value the entry must have, repeatable")
+}
+
+func (ff *filterFlags) filter(traceKey string) (reader.Filter, error) {
+	f := reader.Filter{Level: ff.level, Fields: map[string]string{}}
+	for _, kv := range ff.fields {
+		i := strings.IndexByte(kv, '=')
+		f.Fields[kv[:i]] = kv[i+1:]
+	}
+	if len(ff.traceId) > 0 {
+		f.Fields[traceKey] = ff.traceId
+	}
+	var err error
+	if f.Since, err = parseTime(ff.since); err != nil {
+		return f, err
+	}
+	f.Until, err = parseTime(ff.until)
+	return f, err
+}
+
+type fieldFlag []string
+
+func (f *fieldFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *fieldFlag) Set(s string) error {
+	if strings.IndexByte(s, '=') <= 0 {
+		return errors.New("want key=value")
+	}
+	*f = append(*f, s)
+	return nil
+}
+
+var timeLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// 时间参数, 时长表示距现在多久之前
+func parseTime(s string) (time.Time, error) {
+	if len(s) == 0 {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", s)
+}
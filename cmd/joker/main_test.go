@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/braveghost/joker/index"
+	"github.com/braveghost/joker/reader"
+	"go.uber.org/zap/zapcore"
+)
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func appendFile(t *testing.T, name, s string) {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(s)
+	f.Close()
+}
+
+func waitFor(t *testing.T, out *syncBuffer, want string) {
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(out.String(), want) {
+		if time.Now().After(deadline) {
+			t.Fatalf("output %q does not contain %q", out.String(), want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// 跟随软链接切换到新文件, 旧文件的剩余内容不丢失
+func TestTailFollowsRotation(t *testing.T) {
+	dir := t.TempDir()
+	link := filepath.Join(dir, "app.log")
+	day1 := filepath.Join(dir, "app.log.20261017")
+	day2 := filepath.Join(dir, "app.log.20261018")
+	appendFile(t, day1, "1\n2\n3\n")
+	if err := os.Symlink(day1, link); err != nil {
+		t.Fatal(err)
+	}
+
+	out := &syncBuffer{}
+	stop := make(chan struct{})
+	done := make(chan error)
+	tl := &tailer{path: link, out: out, interval: 5 * time.Millisecond}
+	go func() { done <- tl.follow(2, stop) }()
+
+	waitFor(t, out, "2\n3\n")
+	appendFile(t, day1, "4\n")
+	waitFor(t, out, "4\n")
+
+	appendFile(t, day2, "6\n")
+	os.Remove(link)
+	appendFile(t, day1, "5\n")
+	os.Symlink(day2, link)
+	appendFile(t, day2, "7\n")
+	waitFor(t, out, "7\n")
+	close(stop)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); got != "2\n3\n4\n5\n6\n7\n" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+// 控制台格式转换为 JSON 后可以被原样读回
+func TestConvertRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	in := &reader.Entry{
+		Time:    time.Date(2026, 10, 17, 10, 0, 0, 123400000, time.Local),
+		Level:   zapcore.ErrorLevel,
+		Logger:  "order",
+		Caller:  "svc/order.go:12",
+		Message: "pay <failed>",
+		Stack:   "goroutine 1 [running]:\n\tsvc/order.go:12",
+		Fields:  map[string]interface{}{"trace_id": "t1", "n": 2},
+	}
+	for i, write := range []func(*bufio.Writer, *reader.Entry) error{writeConsole, writeJSON} {
+		var buf bytes.Buffer
+		w := bufio.NewWriter(&buf)
+		if err := write(w, in); err != nil {
+			t.Fatal(err)
+		}
+		w.Flush()
+		if i == 1 && !strings.HasPrefix(buf.String(), `{"time":"2026-10-17T10:00:00.1234","level":"error","logger":"order"`) {
+			t.Fatalf("json %s", buf.String())
+		}
+		name := filepath.Join(dir, "out.log")
+		ioutil.WriteFile(name, buf.Bytes(), 0644)
+
+		it, err := reader.Source{Dir: dir, Name: "out"}.Open(reader.Filter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !it.Next() {
+			t.Fatal("no entry")
+		}
+		e := it.Entry()
+		it.Close()
+		if !e.Time.Equal(in.Time) || e.Level != in.Level || e.Logger != in.Logger || e.Caller != in.Caller ||
+			e.Message != in.Message || e.Stack != in.Stack {
+			t.Fatalf("writer %d: got %+v", i, e)
+		}
+		if id, _ := e.Field("trace_id"); id != "t1" {
+			t.Fatalf("writer %d: fields %v", i, e.Fields)
+		}
+	}
+}
+
+// 不为软链接指向的当前文件建立索引, 文件大小变化后重建索引
+func TestIndexSkipsActiveFile(t *testing.T) {
+	dir := t.TempDir()
+	day1 := filepath.Join(dir, "app.log.20261017")
+	day2 := filepath.Join(dir, "app.log.20261018")
+	appendFile(t, day1, "2026-10-17T10:00:00.0000\tINFO\ta.go:1\tm\t{\"trace_id\": \"t1\"}\n")
+	appendFile(t, day2, "2026-10-18T10:00:00.0000\tINFO\ta.go:1\tm\t{\"trace_id\": \"t2\"}\n")
+	if err := os.Symlink(day2, filepath.Join(dir, "app.log")); err != nil {
+		t.Fatal(err)
+	}
+	args := []string{"-dir", dir, "-name", "app"}
+	if err := runIndex(args); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := index.Open(day2); !os.IsNotExist(err) {
+		t.Fatalf("active file indexed: %v", err)
+	}
+	if ix, err := index.Open(day1); err != nil || !ix.Matches(day1) {
+		t.Fatalf("index of %s: %v", day1, err)
+	}
+
+	appendFile(t, day1, "2026-10-17T11:00:00.0000\tINFO\ta.go:1\tm\t{\"trace_id\": \"t3\"}\n")
+	if err := runIndex(args); err != nil {
+		t.Fatal(err)
+	}
+	if ix, err := index.Open(day1); err != nil || !ix.Matches(day1) || !ix.MayContain("t3") {
+		t.Fatalf("stale index of %s kept: %v", day1, err)
+	}
+}
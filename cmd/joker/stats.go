@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"go.uber.org/zap/zapcore"
+)
+
+type counter map[string]int
+
+type stats struct {
+	total    int
+	levels   map[zapcore.Level]int
+	callers  counter
+	messages counter
+}
+
+func runStats(args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	var (
+		sf sourceFlags
+		ff filterFlags
+	)
+	sf.register(fs)
+	ff.register(fs)
+	traceKey := fs.String("trace-key", "trace_id", "field name of the trace id")
+	top := fs.Int("top", 10, "number of callers and messages to show")
+	fs.Parse(args)
+
+	f, err := ff.filter(*traceKey)
+	if err != nil {
+		return err
+	}
+	it, err := sf.source().Open(f)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+
+	st := &stats{levels: map[zapcore.Level]int{}, callers: counter{}, messages: counter{}}
+	for it.Next() {
+		e := it.Entry()
+		st.total++
+		st.levels[e.Level]++
+		st.callers[e.Caller]++
+		st.messages[e.Message]++
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+	return st.print(os.Stdout, *top)
+}
+
+func (st *stats) print(out io.Writer, top int) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "TOTAL\t%d\n\nLEVEL\tCOUNT\n", st.total)
+	for lvl := zapcore.DebugLevel; lvl <= zapcore.FatalLevel; lvl++ {
+		if n := st.levels[lvl]; n > 0 {
+			fmt.Fprintf(w, "%s\t%d\n", lvl.CapitalString(), n)
+		}
+	}
+	fmt.Fprint(w, "\nCALLER\tCOUNT\n")
+	st.callers.print(w, top)
+	fmt.Fprint(w, "\nMESSAGE\tCOUNT\n")
+	st.messages.print(w, top)
+	return w.Flush()
+}
+
+// 按数量倒序输出前 top 项
+func (c counter) print(w io.Writer, top int) {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if c[keys[i]] != c[keys[j]] {
+			return c[keys[i]] > c[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if top > 0 && len(keys) > top {
+		keys = keys[:top]
+	}
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s\t%d\n", k, c[k])
+	}
+}
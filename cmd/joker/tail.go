@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"time"
+)
+
+func runTail(args []string) error {
+	fs := flag.NewFlagSet("tail", flag.ExitOnError)
+	var sf sourceFlags
+	sf.register(fs)
+	follow := fs.Bool("f", false, "keep reading new lines, following the file across rotations")
+	lines := fs.Int("n", 10, "number of lines to print first")
+	interval := fs.Duration("interval", 250*time.Millisecond, "poll interval of -f")
+	fs.Parse(args)
+
+	t := &tailer{path: sf.source().Current(), out: os.Stdout, interval: *interval}
+	if !*follow {
+		f, err := os.Open(t.path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = lastLines(f, *lines, t.out)
+		return err
+	}
+	return t.follow(*lines, nil)
+}
+
+// 跟踪当前文件; 时间切割时路径是指向最新文件的软链接, 大小切割时旧文件被改名,
+// 两种情况下路径指向的文件变化后, 读完旧文件剩余内容再从头读取新文件
+type tailer struct {
+	path     string
+	out      io.Writer
+	interval time.Duration
+
+	file   *os.File
+	info   os.FileInfo
+	offset int64
+}
+
+// 先输出最后 n 行, 之后持续输出新内容, stop 关闭时返回
+func (t *tailer) follow(n int, stop <-chan struct{}) error {
+	for t.file == nil {
+		if err := t.open(); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if t.file == nil && !t.wait(stop) {
+			return nil
+		}
+	}
+	defer func() { t.file.Close() }()
+	var err error
+	if t.offset, err = lastLines(t.file, n, t.out); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 32*1024)
+	for {
+		if err := t.drain(buf); err != nil {
+			return err
+		}
+		if err := t.check(buf); err != nil {
+			return err
+		}
+		if !t.wait(stop) {
+			return nil
+		}
+	}
+}
+
+func (t *tailer) open() error {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	t.file, t.info, t.offset = f, info, 0
+	return nil
+}
+
+// 输出当前文件的新内容
+func (t *tailer) drain(buf []byte) error {
+	for {
+		n, err := t.file.ReadAt(buf, t.offset)
+		if n > 0 {
+			if _, werr := t.out.Write(buf[:n]); werr != nil {
+				return werr
+			}
+			t.offset += int64(n)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// 文件被截断时从头读, 路径指向新文件时切换
+func (t *tailer) check(buf []byte) error {
+	if info, err := t.file.Stat(); err == nil && info.Size() < t.offset {
+		t.offset = 0
+		return nil
+	}
+	info, err := os.Stat(t.path)
+	if err != nil || os.SameFile(info, t.info) {
+		// 切割过程中路径可能短暂不存在
+		return nil
+	}
+	if err := t.drain(buf); err != nil {
+		return err
+	}
+	old := t.file
+	if err := t.open(); err != nil {
+		return nil
+	}
+	old.Close()
+	return t.drain(buf)
+}
+
+func (t *tailer) wait(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return false
+	case <-time.After(t.interval):
+		return true
+	}
+}
+
+// 输出文件最后 n 行, 返回文件末尾的偏移
+func lastLines(f *os.File, n int, out io.Writer) (int64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	size := info.Size()
+	start := size
+	const block = 32 * 1024
+	var tail []byte
+	for start > 0 && bytes.Count(bytes.TrimSuffix(tail, []byte("\n")), []byte("\n")) < n {
+		read := int64(block)
+		if start < read {
+			read = start
+		}
+		start -= read
+		chunk := make([]byte, read)
+		if _, err := f.ReadAt(chunk, start); err != nil && err != io.EOF {
+			return 0, err
+		}
+		tail = append(chunk, tail...)
+	}
+	if n <= 0 {
+		return size, nil
+	}
+	lines := bytes.SplitAfter(tail, []byte("\n"))
+	if len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	for _, l := range lines {
+		if _, err := out.Write(l); err != nil {
+			return 0, err
+		}
+	}
+	return size, nil
+}
@@ -0,0 +1,14 @@
+// jokervet 检查 joker 日志调用, 配合 go vet 使用:
+//
+//	go install github.com/braveghost/joker/cmd/jokervet
+//	go vet -vettool=$(which jokervet) ./...
+package main
+
+import (
+	"github.com/braveghost/joker/analyzer"
+	"golang.org/x/tools/go/analysis/unitchecker"
+)
+
+func main() {
+	unitchecker.Main(analyzer.Analyzer)
+}
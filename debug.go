@@ -0,0 +1,87 @@
+package logging
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// 开启单次请求 debug 日志的请求头, 值为 SignDebugToken 生成的签名
+	debugHeader = "X-Debug-Log"
+	// 签名密钥, 为空时忽略请求头
+	debugSecret []byte
+)
+
+type debugCtxKey struct{}
+
+// 标记 ctx, *wc 方法在该 ctx 下忽略级别限制输出 debug 日志
+func WithDebug(ctx context.Context) context.Context {
+	return context.WithValue(ctx, debugCtxKey{}, true)
+}
+
+// ctx 是否开启了 debug 日志
+func IsDebug(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	on, _ := ctx.Value(debugCtxKey{}).(bool)
+	return on
+}
+
+func SetDebugHeader(header string) {
+	debugHeader = header
+}
+
+func GetDebugHeader() string {
+	return debugHeader
+}
+
+// 设置请求头签名密钥
+func SetDebugSecret(secret []byte) {
+	debugSecret = secret
+}
+
+// 生成 debug 请求头的值, 格式为 "过期时间戳.签名", 签名包含 trace id,
+// 令牌只对该 trace id 的请求有效, 泄露后不能用于其他请求
+func SignDebugToken(secret []byte, traceId string, expire time.Time) string {
+	ts := strconv.FormatInt(expire.Unix(), 10)
+	return ts + "." + debugSign(secret, ts, traceId)
+}
+
+// 校验 debug 请求头, 未设置密钥、trace id 为空、签名错误、trace id 不一致或已过期均返回 false
+func VerifyDebugToken(token, traceId string) bool {
+	if len(debugSecret) == 0 || len(token) == 0 || len(traceId) == 0 {
+		return false
+	}
+	idx := strings.IndexByte(token, '.')
+	if idx <= 0 {
+		return false
+	}
+	ts, sign := token[:idx], token[idx+1:]
+	expire, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || time.Now().Unix() > expire {
+		return false
+	}
+	return hmac.Equal([]byte(sign), []byte(debugSign(debugSecret, ts, traceId)))
+}
+
+func debugSign(secret []byte, ts, traceId string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(ts + "." + traceId))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// 根据 ctx 选择日志引擎, 开启 debug 时使用 debug 级别引擎
+func (lg *Logging) sugar(ctx context.Context) *zap.SugaredLogger {
+	if lg.debugLogger != nil && IsDebug(ctx) {
+		return lg.debugLogger
+	}
+	return lg.logger
+}
@@ -0,0 +1,98 @@
+package logging
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestDebugToken(t *testing.T) {
+	secret := []byte("joker")
+	SetDebugSecret(secret)
+	defer SetDebugSecret(nil)
+
+	if !VerifyDebugToken(SignDebugToken(secret, "t1", time.Now().Add(time.Minute)), "t1") {
+		t.Fatal("valid token rejected")
+	}
+	if VerifyDebugToken(SignDebugToken(secret, "t1", time.Now().Add(-time.Minute)), "t1") {
+		t.Fatal("expired token accepted")
+	}
+	if VerifyDebugToken(SignDebugToken([]byte("other"), "t1", time.Now().Add(time.Minute)), "t1") {
+		t.Fatal("forged token accepted")
+	}
+	if VerifyDebugToken(SignDebugToken(secret, "t1", time.Now().Add(time.Minute)), "t2") {
+		t.Fatal("token of another trace accepted")
+	}
+	if VerifyDebugToken(SignDebugToken(secret, "", time.Now().Add(time.Minute)), "") {
+		t.Fatal("token without trace id accepted")
+	}
+}
+
+func TestDebugMiddleware(t *testing.T) {
+	secret := []byte("joker")
+	SetDebugSecret(secret)
+	defer SetDebugSecret(nil)
+
+	var debug bool
+	h := HTTPMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		debug = IsDebug(r.Context())
+	}))
+
+	token := SignDebugToken(secret, "t1", time.Now().Add(time.Minute))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(GetTraceIdHeader(), "t1")
+	req.Header.Set(GetDebugHeader(), token)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if !debug {
+		t.Fatal("signed header should enable debug")
+	}
+
+	// 令牌与请求的 trace id 不一致, 或未传 trace id 时由中间件生成
+	for _, tid := range []string{"t2", ""} {
+		req = httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(GetTraceIdHeader(), tid)
+		req.Header.Set(GetDebugHeader(), token)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		if debug {
+			t.Fatalf("token of t1 should not enable debug for trace %q", tid)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(GetDebugHeader(), "1.xxx")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if debug {
+		t.Fatal("unsigned header should be ignored")
+	}
+
+	lg := &Logging{logger: defaultRegistry.Default().logger, debugLogger: zap.NewNop().Sugar()}
+	if lg.sugar(WithDebug(context.Background())) != lg.debugLogger {
+		t.Fatal("debug ctx should use debug logger")
+	}
+	if lg.sugar(context.Background()) != lg.logger {
+		t.Fatal("plain ctx should use default logger")
+	}
+}
+
+// 中间件包装的 ResponseWriter 保留 Flusher, 并能通过 ResponseController 找到底层对象
+func TestMiddlewareFlusher(t *testing.T) {
+	var flushed, hijackErr bool
+	h := HTTPMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("chunk"))
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		flushed = http.NewResponseController(w).Flush() == nil
+		_, _, err := http.NewResponseController(w).Hijack()
+		hijackErr = err != nil
+	}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if !rec.Flushed || !flushed || !hijackErr {
+		t.Fatalf("flushed %v %v, hijack error %v", rec.Flushed, flushed, hijackErr)
+	}
+}
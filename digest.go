@@ -0,0 +1,293 @@
+package logging
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var (
+	defaultDigestRule = DigestRule{
+		Interval:  10 * time.Minute,
+		TopN:      10,
+		MaxGroups: 1000,
+	}
+)
+
+func GetDefaultDigestRule() *DigestRule {
+	rule := defaultDigestRule
+	return &rule
+}
+
+// 错误汇总规则, Error 及以上的日志按指纹分组计数, 定期输出出现最多的分组
+type DigestRule struct {
+	Interval  time.Duration // 汇总间隔
+	TopN      int           // 每次汇总的分组数
+	MaxGroups int           // 最多保留的分组数, 超出时淘汰最久未出现的
+	// 不为空时汇总结果交给回调, 否则以一条 Warn 日志输出
+	Callback func(name string, groups []ErrorGroup)
+}
+
+func (r DigestRule) withDefaults() DigestRule {
+	if r.Interval <= 0 {
+		r.Interval = defaultDigestRule.Interval
+	}
+	if r.TopN <= 0 {
+		r.TopN = defaultDigestRule.TopN
+	}
+	if r.MaxGroups <= 0 {
+		r.MaxGroups = defaultDigestRule.MaxGroups
+	}
+	return r
+}
+
+// 一组指纹相同的错误
+type ErrorGroup struct {
+	Fingerprint string    `json:"fingerprint"`
+	Message     string    `json:"message"` // 最近一次的消息
+	Caller      string    `json:"caller,omitempty"`
+	ErrorType   string    `json:"error_type,omitempty"`
+	Count       int64     `json:"count"`  // 累计次数
+	Recent      int64     `json:"recent"` // 上次汇总以来的次数
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+	TraceId     string    `json:"trace_id,omitempty"` // 最近一次带 trace id 的样例
+}
+
+type errorDigest struct {
+	name   string
+	key    string // trace id 字段名
+	rule   DigestRule
+	emit   func(groups []ErrorGroup)
+	mu     sync.Mutex
+	groups map[string]*ErrorGroup
+	stop   chan struct{}
+	once   sync.Once
+}
+
+func newErrorDigest(name, key string, rule *DigestRule, emit func(groups []ErrorGroup)) *errorDigest {
+	ed := &errorDigest{
+		name:   name,
+		key:    key,
+		rule:   rule.withDefaults(),
+		emit:   emit,
+		groups: map[string]*ErrorGroup{},
+		stop:   make(chan struct{}),
+	}
+	if ed.rule.Callback != nil {
+		ed.emit = func(groups []ErrorGroup) { ed.rule.Callback(name, groups) }
+	}
+	go ed.run()
+	return ed
+}
+
+func (ed *errorDigest) run() {
+	ticker := time.NewTicker(ed.rule.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			ed.report()
+		case <-ed.stop:
+			return
+		}
+	}
+}
+
+func (ed *errorDigest) close() {
+	ed.once.Do(func() { close(ed.stop) })
+}
+
+// 输出上次汇总以来出现最多的分组, 没有新错误时不输出
+func (ed *errorDigest) report() {
+	ed.mu.Lock()
+	var top []ErrorGroup
+	for _, g := range ed.groups {
+		if g.Recent > 0 {
+			top = append(top, *g)
+			g.Recent = 0
+		}
+	}
+	ed.mu.Unlock()
+	if len(top) == 0 {
+		return
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Recent != top[j].Recent {
+			return top[i].Recent > top[j].Recent
+		}
+		return top[i].Fingerprint < top[j].Fingerprint
+	})
+	if len(top) > ed.rule.TopN {
+		top = top[:ed.rule.TopN]
+	}
+	ed.emit(top)
+}
+
+func (ed *errorDigest) observe(ent zapcore.Entry, fields []zapcore.Field) {
+	fp := fingerprint(ent, fields)
+	var traceId string
+	for _, f := range fields {
+		if f.Key == ed.key && f.Type == zapcore.StringType {
+			traceId = f.String
+		}
+	}
+
+	ed.mu.Lock()
+	defer ed.mu.Unlock()
+	g, ok := ed.groups[fp]
+	if !ok {
+		if len(ed.groups) >= ed.rule.MaxGroups {
+			ed.evict()
+		}
+		g = &ErrorGroup{Fingerprint: fp, ErrorType: errorType(fields), FirstSeen: ent.Time}
+		if ent.Caller.Defined {
+			g.Caller = ent.Caller.TrimmedPath()
+		}
+		ed.groups[fp] = g
+	}
+	g.Message = ent.Message
+	g.Count++
+	g.Recent++
+	g.LastSeen = ent.Time
+	if len(traceId) > 0 {
+		g.TraceId = traceId
+	}
+}
+
+// 淘汰最久未出现的分组
+func (ed *errorDigest) evict() {
+	var oldest *ErrorGroup
+	for _, g := range ed.groups {
+		if oldest == nil || g.LastSeen.Before(oldest.LastSeen) {
+			oldest = g
+		}
+	}
+	if oldest != nil {
+		delete(ed.groups, oldest.Fingerprint)
+	}
+}
+
+// 全部分组, 按累计次数从多到少
+func (ed *errorDigest) snapshot() []ErrorGroup {
+	ed.mu.Lock()
+	groups := make([]ErrorGroup, 0, len(ed.groups))
+	for _, g := range ed.groups {
+		groups = append(groups, *g)
+	}
+	ed.mu.Unlock()
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Count != groups[j].Count {
+			return groups[i].Count > groups[j].Count
+		}
+		return groups[i].Fingerprint < groups[j].Fingerprint
+	})
+	return groups
+}
+
+// 只观察 Error 及以上的日志, 不产生输出
+type digestCore struct {
+	digest *errorDigest
+	fields []zapcore.Field
+}
+
+func (dc *digestCore) Enabled(lvl zapcore.Level) bool {
+	return lvl >= zapcore.ErrorLevel
+}
+
+func (dc *digestCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *dc
+	clone.fields = append(append([]zapcore.Field(nil), dc.fields...), fields...)
+	return &clone
+}
+
+func (dc *digestCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if dc.Enabled(ent.Level) {
+		return ce.AddCore(ent, dc)
+	}
+	return ce
+}
+
+func (dc *digestCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	all := fields
+	if len(dc.fields) > 0 {
+		all = append(append([]zapcore.Field(nil), dc.fields...), fields...)
+	}
+	dc.digest.observe(ent, all)
+	return nil
+}
+
+func (dc *digestCore) Sync() error {
+	return nil
+}
+
+// 汇总以一条 Warn 日志输出, 本身不会再被统计
+func (lg *Logging) emitDigest(groups []ErrorGroup) {
+	lg.logger.Desugar().WithOptions(zap.WithCaller(false)).Warn("error digest",
+		zap.Duration("interval", lg.digest.rule.Interval),
+		zap.Any("groups", groups))
+}
+
+// 当前的错误分组, 按累计次数从多到少, 未开启错误汇总时为空
+func (lg *Logging) ErrorGroups() []ErrorGroup {
+	if lg.digest == nil {
+		return nil
+	}
+	return lg.digest.snapshot()
+}
+
+// 指纹: 消息模板 + 调用位置 + 错误类型
+func fingerprint(ent zapcore.Entry, fields []zapcore.Field) string {
+	h := fnv.New64a()
+	h.Write([]byte(messageTemplate(ent.Message)))
+	if ent.Caller.Defined {
+		h.Write([]byte{0})
+		h.Write([]byte(ent.Caller.File))
+		h.Write([]byte(strconv.Itoa(ent.Caller.Line)))
+	}
+	h.Write([]byte{0})
+	h.Write([]byte(errorType(fields)))
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+// 消息中的数字替换为 ?, 使只有 id、耗时等不同的消息归为一组
+func messageTemplate(msg string) string {
+	var sb strings.Builder
+	digits := false
+	for _, r := range msg {
+		if r >= '0' && r <= '9' {
+			if !digits {
+				sb.WriteByte('?')
+			}
+			digits = true
+			continue
+		}
+		digits = false
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// 字段中 error 值的具体类型, 多个时以逗号分隔
+func errorType(fields []zapcore.Field) string {
+	var types []string
+	for _, f := range fields {
+		switch v := f.Interface.(type) {
+		case error:
+			if f.Type == zapcore.ErrorType {
+				types = append(types, fmt.Sprintf("%T", v))
+			}
+		case errorObject:
+			// 已按 ErrorFields 展开的错误
+			types = append(types, fmt.Sprintf("%T", v.err))
+		}
+	}
+	return strings.Join(types, ",")
+}
@@ -0,0 +1,90 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestErrorDigest(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	lg := &Logging{status: true, opts: &Options{FileName: "digest"}}
+	lg.digest = newErrorDigest("digest", "trace_id", &DigestRule{Interval: time.Hour, TopN: 1}, lg.emitDigest)
+	defer lg.digest.close()
+	lg.logger = zap.New(zapcore.NewTee(core, &digestCore{digest: lg.digest}), zap.AddCaller(), zap.AddCallerSkip(1)).Sugar()
+
+	query := func(id int, err error) {
+		lg.Errorw(fmt.Sprintf("query user %d failed", id), "trace_id", fmt.Sprintf("t%d", id), "err", err)
+	}
+	// 只有数字不同的消息归为一组, 错误类型不同时分开
+	for i := 1; i <= 3; i++ {
+		query(i, errors.New("not found"))
+	}
+	query(9, &os.PathError{Op: "open", Path: "/tmp", Err: os.ErrNotExist})
+	lg.Warnw("not counted")
+
+	groups := lg.ErrorGroups()
+	if len(groups) != 2 {
+		t.Fatalf("want 2 groups, got %+v", groups)
+	}
+	g := groups[0]
+	if g.Count != 3 || g.Message != "query user 3 failed" || g.TraceId != "t3" || g.ErrorType != "*errors.errorString" {
+		t.Fatalf("unexpected group %+v", g)
+	}
+	if g.FirstSeen.After(g.LastSeen) || len(g.Caller) == 0 {
+		t.Fatalf("unexpected group %+v", g)
+	}
+
+	lg.digest.report()
+	entries := logs.FilterMessage("error digest").All()
+	if len(entries) != 1 {
+		t.Fatalf("want one digest entry, got %d", len(entries))
+	}
+	top := entries[0].ContextMap()["groups"].([]ErrorGroup)
+	if len(top) != 1 || top[0].Fingerprint != g.Fingerprint || top[0].Recent != 3 {
+		t.Fatalf("unexpected digest %+v", top)
+	}
+
+	// 没有新错误时不输出汇总
+	lg.digest.report()
+	if n := logs.FilterMessage("error digest").Len(); n != 1 {
+		t.Fatalf("want no new digest, got %d", n)
+	}
+	if groups := lg.ErrorGroups(); groups[0].Recent != 0 || groups[0].Count != 3 {
+		t.Fatalf("recent count not reset %+v", groups[0])
+	}
+}
+
+func TestErrorDigestCallback(t *testing.T) {
+	got := make(chan []ErrorGroup, 1)
+	ed := newErrorDigest("api", "trace_id", &DigestRule{
+		Interval:  20 * time.Millisecond,
+		MaxGroups: 1,
+		Callback: func(name string, groups []ErrorGroup) {
+			if name == "api" {
+				got <- groups
+			}
+		},
+	}, nil)
+	defer ed.close()
+
+	lg := zap.New(&digestCore{digest: ed})
+	lg.Error("first")
+	lg.Error("second")
+
+	select {
+	case groups := <-got:
+		// 超出 MaxGroups 时淘汰最久未出现的分组
+		if len(groups) != 1 || groups[0].Message != "second" {
+			t.Fatalf("unexpected groups %+v", groups)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("callback not called")
+	}
+}
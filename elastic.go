@@ -0,0 +1,249 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/lestrrat-go/strftime"
+	"go.uber.org/zap/zapcore"
+)
+
+const ecsVersion = "1.12.0"
+
+type ElasticOptions struct {
+	NetSinkOptions
+	URL           string        // 集群地址, 如 http://es:9200
+	IndexTemplate string        // 索引名模板, 支持 strftime 日期和 {service}, 如 logs-{service}-%Y.%m.%d
+	Username      string        // basic auth
+	Password      string        // basic auth
+	APIKey        string        // 优先于 basic auth
+	OpType        string        // index 或 create, 写 data stream 时需为 create
+	FieldsKey     string        // 键值对放入的对象名, 为空时为 labels
+	Timeout       time.Duration // 单次请求超时
+	MaxRetries    int           // 429 和 5xx 的重试次数
+	Backoff       time.Duration // 首次重试等待
+}
+
+// Elasticsearch/OpenSearch 输出, 通过 _bulk 写入 ECS 格式文档
+type ElasticSink struct {
+	*NetSink
+	opts  ElasticOptions
+	index *strftime.Strftime
+}
+
+func NewElasticSink(opts ElasticOptions) (*ElasticSink, error) {
+	if len(opts.Name) == 0 {
+		opts.Name = "elastic"
+	}
+	if len(opts.IndexTemplate) == 0 {
+		opts.IndexTemplate = "logs-{service}-%Y.%m.%d"
+	}
+	if len(opts.OpType) == 0 {
+		opts.OpType = "index"
+	}
+	if len(opts.FieldsKey) == 0 {
+		opts.FieldsKey = "labels"
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.Backoff == 0 {
+		opts.Backoff = 500 * time.Millisecond
+	}
+	if opts.BatchBytes == 0 {
+		opts.BatchBytes = 5 << 20
+	}
+	if opts.BlockTimeout == 0 {
+		// 集群写入跟不上时阻塞写入方, 而不是直接丢弃
+		opts.BlockTimeout = 100 * time.Millisecond
+	}
+	index, err := strftime.New(opts.IndexTemplate)
+	if err != nil {
+		return nil, err
+	}
+	tr := &elasticTransport{
+		opts:      opts,
+		client:    &http.Client{Timeout: opts.Timeout},
+		httpRetry: newHTTPRetry(opts.MaxRetries, opts.Backoff, opts.NetSinkOptions),
+	}
+	ns, err := NewNetSink(tr, opts.NetSinkOptions)
+	if err != nil {
+		return nil, err
+	}
+	return &ElasticSink{NetSink: ns, opts: opts, index: index}, nil
+}
+
+// 缓存和传输中的单条记录, 文档 id 在编码时生成, 重放时不会重复写入
+type elasticRecord struct {
+	Index string          `json:"index"`
+	Id    string          `json:"id"`
+	Doc   json.RawMessage `json:"doc"`
+}
+
+func (es *ElasticSink) Core(opts *Options, enab zapcore.LevelEnabler) zapcore.Core {
+	service := opts.ServiceName
+	logger := opts.GetName()
+	traceKey := opts.registry().traceIdKey
+	return es.newRecordCore(enab, func(ent zapcore.Entry, fields []zapcore.Field) ([]byte, error) {
+		doc, err := json.Marshal(ecsDocument(service, logger, traceKey, es.opts.FieldsKey, ent, fields))
+		if err != nil {
+			return nil, err
+		}
+		index := strings.Replace(es.index.FormatString(ent.Time), "{service}", strings.ToLower(service), -1)
+		return json.Marshal(elasticRecord{Index: index, Id: NewTraceId(), Doc: doc})
+	})
+}
+
+// 按 Elastic Common Schema 组织文档
+func ecsDocument(service, logger, traceKey, fieldsKey string, ent zapcore.Entry, fields []zapcore.Field) map[string]interface{} {
+	values := fieldsToMap(fields)
+	doc := map[string]interface{}{
+		"@timestamp": ent.Time.UTC().Format(time.RFC3339Nano),
+		"message":    ent.Message,
+		"ecs":        map[string]interface{}{"version": ecsVersion},
+	}
+	lg := map[string]interface{}{
+		"level":  ent.Level.String(),
+		"logger": logger,
+	}
+	if ent.Caller.Defined {
+		lg["origin"] = map[string]interface{}{
+			"file": map[string]interface{}{
+				"name": filepath.Base(ent.Caller.File),
+				"line": ent.Caller.Line,
+			},
+		}
+	}
+	doc["log"] = lg
+	if len(service) > 0 {
+		doc["service"] = map[string]interface{}{"name": service}
+	}
+	delete(values, "service_name")
+	if id, ok := values[traceKey]; ok {
+		if id != nil {
+			doc["trace"] = map[string]interface{}{"id": fmt.Sprint(id)}
+		}
+		delete(values, traceKey)
+	}
+	if len(ent.Stack) > 0 {
+		doc["error"] = map[string]interface{}{"stack_trace": ent.Stack}
+	}
+	if len(values) > 0 {
+		doc[fieldsKey] = values
+	}
+	return doc
+}
+
+type elasticTransport struct {
+	opts   ElasticOptions
+	client *http.Client
+	httpRetry
+}
+
+type bulkResponse struct {
+	Errors bool                                `json:"errors"`
+	Items  []map[string]bulkResponseItemResult `json:"items"`
+}
+
+type bulkResponseItemResult struct {
+	Status int             `json:"status"`
+	Error  json.RawMessage `json:"error"`
+}
+
+func (et *elasticTransport) Send(records [][]byte) error {
+	pending := make([]elasticRecord, 0, len(records))
+	for _, raw := range records {
+		var rec elasticRecord
+		if err := json.Unmarshal(raw, &rec); err == nil {
+			pending = append(pending, rec)
+		}
+	}
+
+	backoff := et.opts.Backoff
+	for i := 0; len(pending) > 0; i++ {
+		if i > 0 {
+			if !et.pause(backoff) {
+				return fmt.Errorf("elastic bulk: %d items not sent before close", len(pending))
+			}
+			backoff *= 2
+		}
+		retry, err := et.bulk(pending)
+		if err != nil {
+			return err
+		}
+		if len(retry) > 0 && i >= et.opts.MaxRetries {
+			// 整批重放, 已写入的文档因 id 相同不会重复
+			return fmt.Errorf("elastic bulk: %d items rejected", len(retry))
+		}
+		pending = retry
+	}
+	return nil
+}
+
+// 发送一次 bulk 请求, 返回可重试的条目, 不可重试的条目记录后丢弃
+func (et *elasticTransport) bulk(records []elasticRecord) ([]elasticRecord, error) {
+	var body bytes.Buffer
+	for _, rec := range records {
+		action, _ := json.Marshal(map[string]interface{}{
+			et.opts.OpType: map[string]string{"_index": rec.Index, "_id": rec.Id},
+		})
+		body.Write(action)
+		body.WriteByte('\n')
+		body.Write(rec.Doc)
+		body.WriteByte('\n')
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/x-ndjson")
+	if len(et.opts.APIKey) > 0 {
+		header.Set("Authorization", "ApiKey "+et.opts.APIKey)
+	} else if len(et.opts.Username) > 0 {
+		auth := base64.StdEncoding.EncodeToString([]byte(et.opts.Username + ":" + et.opts.Password))
+		header.Set("Authorization", "Basic "+auth)
+	}
+	url := strings.TrimSuffix(et.opts.URL, "/") + "/_bulk"
+	respBody, err := et.postWithRetry(et.client, url, header, body.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	var resp bulkResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, permanentError{err}
+	}
+	if !resp.Errors {
+		return nil, nil
+	}
+	var retry []elasticRecord
+	for i, item := range resp.Items {
+		if i >= len(records) {
+			break
+		}
+		for _, res := range item {
+			switch {
+			case res.Status/100 == 2:
+			case res.Status == http.StatusConflict && et.opts.OpType == "create":
+				// 重放时文档已存在
+			case res.Status == http.StatusTooManyRequests || res.Status >= 500:
+				retry = append(retry, records[i])
+			default:
+				atomic.AddUint64(metrics.counter("sink_dropped_total", et.opts.Name), 1)
+				log.Printf("Logging.ElasticSink.BulkItem.Error || index=%s | status=%d | err=%s\n",
+					records[i].Index, res.Status, res.Error)
+			}
+		}
+	}
+	return retry, nil
+}
+
+func (et *elasticTransport) Close() error {
+	return nil
+}
@@ -0,0 +1,87 @@
+package logging
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestElasticSinkBulk(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		docs  = map[string]map[string]interface{}{}
+		calls int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		sc := bufio.NewScanner(r.Body)
+		var items []map[string]interface{}
+		for i := 0; sc.Scan(); i++ {
+			var action map[string]map[string]string
+			json.Unmarshal(sc.Bytes(), &action)
+			sc.Scan()
+			var doc map[string]interface{}
+			json.Unmarshal(sc.Bytes(), &doc)
+			meta := action["index"]
+			status := 201
+			// 第一次请求的第一条返回 429, 其余的第一条返回 400
+			if i == 0 {
+				status = 400
+				if calls == 1 {
+					status = 429
+				}
+			}
+			if status == 201 || status == 200 {
+				docs[meta["_index"]+"/"+meta["_id"]] = doc
+			}
+			items = append(items, map[string]interface{}{"index": map[string]interface{}{"status": status}})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"errors": true, "items": items})
+	}))
+	defer srv.Close()
+
+	es, err := NewElasticSink(ElasticOptions{
+		URL:           srv.URL,
+		IndexTemplate: "logs-{service}-%Y.%m",
+		MaxRetries:    2,
+		Backoff:       time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer es.Close()
+
+	lg := zap.New(es.Core(&Options{ServiceName: "Order", FileName: "api"}, zapcore.DebugLevel), zap.AddCaller())
+	lg.Info("rejected")
+	lg.Warn("indexed", zap.String("trace_id", "t-1"), zap.Int("n", 2))
+	es.Sync()
+
+	mu.Lock()
+	defer mu.Unlock()
+	// 429 的条目重试后返回 400, 被丢弃, 第二条写入一次
+	if calls != 2 || len(docs) != 1 {
+		t.Fatalf("calls=%d docs=%d", calls, len(docs))
+	}
+	for key, doc := range docs {
+		if want := "logs-order-" + time.Now().Format("2006.01") + "/"; key[:len(want)] != want {
+			t.Fatalf("unexpected index %s", key)
+		}
+		lg := doc["log"].(map[string]interface{})
+		origin := lg["origin"].(map[string]interface{})["file"].(map[string]interface{})
+		if doc["message"] != "indexed" || lg["level"] != "warn" || origin["name"] != "elastic_test.go" ||
+			doc["service"].(map[string]interface{})["name"] != "Order" ||
+			doc["trace"].(map[string]interface{})["id"] != "t-1" ||
+			doc["labels"].(map[string]interface{})["n"] != float64(2) {
+			t.Fatalf("unexpected doc %v", doc)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package logging
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type errorStackMode int
+
+const (
+	// 堆栈放在错误对象内的字段中
+	ErrorStackNested errorStackMode = iota
+	// 堆栈写入日志条目的 StacktraceKey, 条目已有堆栈时仍放在错误对象内
+	ErrorStackEntry
+	// 不输出堆栈
+	ErrorStackNone
+)
+
+var (
+	defaultErrorFieldRule = ErrorFieldRule{
+		Stack:    ErrorStackNested,
+		StackKey: "stack",
+		MaxDepth: 10,
+	}
+)
+
+func GetDefaultErrorFieldRule() *ErrorFieldRule {
+	rule := defaultErrorFieldRule
+	return &rule
+}
+
+// 错误字段展开规则, 键值对中的 error 展开为消息、类型、错误链和堆栈
+type ErrorFieldRule struct {
+	Stack    errorStackMode // 堆栈的输出位置
+	StackKey string         // 错误对象内的堆栈字段名
+	MaxDepth int            // 错误链最多展开的层数
+}
+
+func (r ErrorFieldRule) withDefaults() ErrorFieldRule {
+	if len(r.StackKey) == 0 {
+		r.StackKey = defaultErrorFieldRule.StackKey
+	}
+	if r.MaxDepth <= 0 {
+		r.MaxDepth = defaultErrorFieldRule.MaxDepth
+	}
+	return r
+}
+
+// pkg/errors 带堆栈的错误
+type stackTracer interface {
+	StackTrace() errors.StackTrace
+}
+
+// errors.Join 和多个 %w 生成的错误
+type multiUnwrapper interface {
+	Unwrap() []error
+}
+
+// 展开后的错误对象
+type errorObject struct {
+	err   error
+	rule  *ErrorFieldRule
+	stack bool // 是否在对象内输出堆栈
+}
+
+func (eo errorObject) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("msg", eo.err.Error())
+	enc.AddString("type", fmt.Sprintf("%T", eo.err))
+
+	chain, joined := unwrapChain(eo.err, eo.rule.MaxDepth)
+	if len(chain) > 0 {
+		enc.AddArray("chain", zapcore.ArrayMarshalerFunc(func(arr zapcore.ArrayEncoder) error {
+			for _, e := range chain {
+				arr.AppendObject(zapcore.ObjectMarshalerFunc(func(o zapcore.ObjectEncoder) error {
+					o.AddString("msg", e.Error())
+					o.AddString("type", fmt.Sprintf("%T", e))
+					return nil
+				}))
+			}
+			return nil
+		}))
+	}
+	if len(joined) > 0 {
+		enc.AddArray("errors", zapcore.ArrayMarshalerFunc(func(arr zapcore.ArrayEncoder) error {
+			for _, e := range joined {
+				arr.AppendObject(errorObject{err: e, rule: eo.rule, stack: eo.stack})
+			}
+			return nil
+		}))
+	}
+	if eo.stack {
+		if st := errorStack(eo.err, eo.rule.MaxDepth); len(st) > 0 {
+			enc.AddString(eo.rule.StackKey, st)
+		}
+	}
+	return nil
+}
+
+// 沿 Unwrap 和 Cause 展开错误链, 跳过与上一层消息相同的包装 (如 pkg/errors 的 withStack),
+// 遇到 Join 时停止并返回其中的各个错误
+func unwrapChain(err error, depth int) (chain []error, joined []error) {
+	last := err.Error()
+	for i := 0; i < depth; i++ {
+		if mu, ok := err.(multiUnwrapper); ok {
+			return chain, mu.Unwrap()
+		}
+		next := errors.Unwrap(err)
+		if next == nil {
+			if c, ok := err.(interface{ Cause() error }); ok {
+				next = c.Cause()
+			}
+		}
+		if next == nil {
+			return chain, nil
+		}
+		if msg := next.Error(); msg != last {
+			chain = append(chain, next)
+			last = msg
+		}
+		err = next
+	}
+	return chain, nil
+}
+
+// 错误链中最内层的 pkg/errors 堆栈, 即错误产生的位置, Join 时取第一个带堆栈的错误
+func errorStack(err error, depth int) string {
+	var st stackTracer
+	for i := 0; i <= depth && err != nil; i++ {
+		if s, ok := err.(stackTracer); ok {
+			st = s
+		}
+		if mu, ok := err.(multiUnwrapper); ok {
+			for _, e := range mu.Unwrap() {
+				if s := errorStack(e, depth-i); len(s) > 0 {
+					return s
+				}
+			}
+			break
+		}
+		next := errors.Unwrap(err)
+		if next == nil {
+			if c, ok := err.(interface{ Cause() error }); ok {
+				next = c.Cause()
+			}
+		}
+		err = next
+	}
+	if st == nil {
+		return ""
+	}
+	return strings.TrimPrefix(fmt.Sprintf("%+v", st.StackTrace()), "\n")
+}
+
+// 将 error 类型的字段替换为展开后的对象, 返回 Entry 模式下取出的堆栈
+func (r *ErrorFieldRule) expand(fields []zapcore.Field, entryStack bool) ([]zapcore.Field, string) {
+	var (
+		out   []zapcore.Field
+		stack string
+	)
+	for i, f := range fields {
+		err, ok := f.Interface.(error)
+		if f.Type != zapcore.ErrorType || !ok {
+			if out != nil {
+				out = append(out, f)
+			}
+			continue
+		}
+		if out == nil {
+			out = append(make([]zapcore.Field, 0, len(fields)), fields[:i]...)
+		}
+		obj := errorObject{err: err, rule: r, stack: r.Stack == ErrorStackNested}
+		if r.Stack == ErrorStackEntry {
+			if entryStack && len(stack) == 0 {
+				stack = errorStack(err, r.MaxDepth)
+			} else {
+				obj.stack = true
+			}
+		}
+		out = append(out, zap.Object(f.Key, obj))
+	}
+	if out == nil {
+		return fields, stack
+	}
+	return out, stack
+}
+
+func (r *ErrorFieldRule) wrap(core zapcore.Core) zapcore.Core {
+	return &errorFieldCore{Core: core, rule: r}
+}
+
+type errorFieldCore struct {
+	zapcore.Core
+	rule *ErrorFieldRule
+}
+
+func (ec *errorFieldCore) With(fields []zapcore.Field) zapcore.Core {
+	// With 的字段不属于某一条日志, 堆栈只能放在对象内
+	fields, _ = ec.rule.expand(fields, false)
+	return &errorFieldCore{Core: ec.Core.With(fields), rule: ec.rule}
+}
+
+func (ec *errorFieldCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if ec.Enabled(ent.Level) {
+		return ce.AddCore(ent, ec)
+	}
+	return ce
+}
+
+func (ec *errorFieldCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	fields, stack := ec.rule.expand(fields, len(ent.Stack) == 0)
+	if len(stack) > 0 {
+		ent.Stack = stack
+	}
+	writeThrough(ec.Core, ent, fields)
+	return nil
+}
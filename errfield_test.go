@@ -0,0 +1,71 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	pkgerrors "github.com/pkg/errors"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func newErrorFieldLogger(rule *ErrorFieldRule) (*Logging, *observer.ObservedLogs) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	lg := &Logging{status: true, opts: &Options{ErrorFields: rule}}
+	lg.logger = lg.newSugar(core)
+	return lg, logs
+}
+
+func TestErrorFieldsNested(t *testing.T) {
+	lg, logs := newErrorFieldLogger(&ErrorFieldRule{})
+
+	cause := pkgerrors.New("connection refused")
+	err := fmt.Errorf("load user: %w", pkgerrors.Wrap(cause, "query"))
+	lg.Errorw("failed", "err", err)
+
+	entry := logs.All()[0]
+	obj := entry.ContextMap()["err"].(map[string]interface{})
+	if obj["msg"] != "load user: query: connection refused" || obj["type"] != "*fmt.wrapError" {
+		t.Fatalf("unexpected error object %v", obj)
+	}
+	chain := obj["chain"].([]interface{})
+	if len(chain) != 2 {
+		t.Fatalf("want 2 causes, got %v", chain)
+	}
+	last := chain[1].(map[string]interface{})
+	if last["msg"] != "connection refused" || last["type"] != "*errors.fundamental" {
+		t.Fatalf("unexpected root cause %v", last)
+	}
+	if st, _ := obj["stack"].(string); !strings.Contains(st, "TestErrorFieldsNested") {
+		t.Fatalf("missing stack %q", st)
+	}
+	if len(entry.Stack) != 0 {
+		t.Fatalf("entry stack should be empty in nested mode")
+	}
+}
+
+func TestErrorFieldsEntryStack(t *testing.T) {
+	lg, logs := newErrorFieldLogger(&ErrorFieldRule{Stack: ErrorStackEntry})
+
+	err := errors.Join(pkgerrors.New("disk full"), io.EOF)
+	lg.Warnw("flush", "err", err, "n", 1)
+
+	entry := logs.All()[0]
+	if !strings.Contains(entry.Stack, "TestErrorFieldsEntryStack") {
+		t.Fatalf("stack should move to the entry, got %q", entry.Stack)
+	}
+	obj := entry.ContextMap()["err"].(map[string]interface{})
+	if _, ok := obj["stack"]; ok {
+		t.Fatalf("stack should not be nested: %v", obj)
+	}
+	joined := obj["errors"].([]interface{})
+	if len(joined) != 2 || joined[1].(map[string]interface{})["msg"] != "EOF" {
+		t.Fatalf("unexpected joined errors %v", joined)
+	}
+	if entry.ContextMap()["n"] != int64(1) {
+		t.Fatalf("other fields changed: %v", entry.ContextMap())
+	}
+}
@@ -0,0 +1,213 @@
+package logging
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// 强类型字段, 与 zap.Field 相同, 可直接使用 zap 的字段构造函数
+type Field = zapcore.Field
+
+func String(key, val string) Field {
+	return zap.String(key, val)
+}
+
+func Strings(key string, val []string) Field {
+	return zap.Strings(key, val)
+}
+
+func Int(key string, val int) Field {
+	return zap.Int(key, val)
+}
+
+func Int64(key string, val int64) Field {
+	return zap.Int64(key, val)
+}
+
+func Uint64(key string, val uint64) Field {
+	return zap.Uint64(key, val)
+}
+
+func Float64(key string, val float64) Field {
+	return zap.Float64(key, val)
+}
+
+func Bool(key string, val bool) Field {
+	return zap.Bool(key, val)
+}
+
+func Duration(key string, val time.Duration) Field {
+	return zap.Duration(key, val)
+}
+
+func Time(key string, val time.Time) Field {
+	return zap.Time(key, val)
+}
+
+// 以 err 为键的错误字段
+func Err(err error) Field {
+	return zap.Error(err)
+}
+
+func NamedErr(key string, err error) Field {
+	return zap.NamedError(key, err)
+}
+
+// 任意类型, 按实际类型选择编码方式, 非基础类型会有额外分配
+func Any(key string, val interface{}) Field {
+	return zap.Any(key, val)
+}
+
+// 由 logger 和 debugLogger 派生不带语法糖的引擎以及包级函数使用的日志对象, 日志引擎变化后调用
+func (lg *Logging) derive() {
+	// 经过 *z 方法和 writez 两层, 比语法糖方法多跳过一层
+	lg.base = lg.logger.Desugar().WithOptions(zap.AddCallerSkip(1))
+	lg.debugBase = nil
+	if lg.debugLogger != nil {
+		lg.debugBase = lg.debugLogger.Desugar().WithOptions(zap.AddCallerSkip(1))
+	}
+
+	// 包级函数多包装一层, 各引擎再跳过一层
+	outer := *lg
+	outer.outer = nil
+	outer.skip = 1
+	outer.logger = addSkip(lg.logger)
+	outer.debugLogger = addSkip(lg.debugLogger)
+	outer.base = lg.base.WithOptions(zap.AddCallerSkip(1))
+	if lg.debugBase != nil {
+		outer.debugBase = lg.debugBase.WithOptions(zap.AddCallerSkip(1))
+	}
+	lg.outer = &outer
+}
+
+func addSkip(s *zap.SugaredLogger) *zap.SugaredLogger {
+	if s == nil {
+		return nil
+	}
+	return s.Desugar().WithOptions(zap.AddCallerSkip(1)).Sugar()
+}
+
+// 包级函数使用的日志对象, 未派生时为自身
+func (lg *Logging) fromPackage() *Logging {
+	if lg != nil && lg.outer != nil {
+		return lg.outer
+	}
+	return lg
+}
+
+// 根据 ctx 选择不带语法糖的日志引擎, 开启 debug 时使用 debug 级别引擎
+func (lg *Logging) zapLogger(ctx context.Context) *zap.Logger {
+	if lg.debugBase != nil && ctx != nil && IsDebug(ctx) {
+		return lg.debugBase
+	}
+	return lg.base
+}
+
+// 级别未开启时不构造任何对象, 开启时严格模式先校验字段, ctx 不为空时追加 trace id 和 span id;
+// 开启时复制 fields 后写入, 调用方的变参切片不会逃逸到堆上, 也不会被修改
+func (lg *Logging) writez(ctx context.Context, lvl zapcore.Level, msg string, fields []Field) {
+	if !lg.status || lg.base == nil {
+		log.Println("GetLoggerIsNull", msg, fieldsToMap(fields))
+		return
+	}
+	ce := lg.zapLogger(ctx).Check(lvl, msg)
+	if ce == nil {
+		return
+	}
+	if lg.strict {
+		lg.validateFields(ctx, lvl, msg, fields)
+	}
+	buf := fieldsPool.Get().(*[]Field)
+	all := append((*buf)[:0], fields...)
+	if ctx != nil && !lg.traced {
+		reg := lg.registry()
+		all = append(all, zap.Any(reg.traceIdKey, reg.GetTraceId(ctx)))
+		if span := reg.GetSpanId(ctx); span != nil {
+			all = append(all, zap.Any(reg.SpanIdKey(), span))
+		}
+	}
+	ce.Write(all...)
+	putFields(buf, all)
+}
+
+// writez 复用的字段切片; 调用方的切片直接交给引擎会逃逸到堆上, 级别未开启时也会分配,
+// 因此复制到复用的切片中再写入, 引擎需要保留字段时自行复制
+var fieldsPool = sync.Pool{New: func() interface{} {
+	fields := make([]Field, 0, 16)
+	return &fields
+}}
+
+func putFields(buf *[]Field, all []Field) {
+	if cap(all) > 256 {
+		// 偶尔的超长字段列表不放回, 避免长期占用内存
+		return
+	}
+	for i := range all {
+		all[i] = Field{}
+	}
+	*buf = all[:0]
+	fieldsPool.Put(buf)
+}
+
+// *z 方法使用强类型字段, 级别未开启时没有内存分配
+func (lg *Logging) Debugz(msg string, fields ...Field) {
+	lg.writez(nil, zapcore.DebugLevel, msg, fields)
+}
+
+func (lg *Logging) Infoz(msg string, fields ...Field) {
+	lg.writez(nil, zapcore.InfoLevel, msg, fields)
+}
+
+func (lg *Logging) Warnz(msg string, fields ...Field) {
+	lg.writez(nil, zapcore.WarnLevel, msg, fields)
+}
+
+func (lg *Logging) Errorz(msg string, fields ...Field) {
+	lg.writez(nil, zapcore.ErrorLevel, msg, fields)
+}
+
+func (lg *Logging) DPanicz(msg string, fields ...Field) {
+	lg.writez(nil, zapcore.DPanicLevel, msg, fields)
+}
+
+func (lg *Logging) Panicz(msg string, fields ...Field) {
+	lg.writez(nil, zapcore.PanicLevel, msg, fields)
+}
+
+func (lg *Logging) Fatalz(msg string, fields ...Field) {
+	lg.writez(nil, zapcore.FatalLevel, msg, fields)
+}
+
+// *zc 方法额外追加 ctx 中的 trace id 和 span id, ctx 开启 debug 时输出 debug 日志
+func (lg *Logging) Debugzc(msg string, ctx context.Context, fields ...Field) {
+	lg.writez(ctx, zapcore.DebugLevel, msg, fields)
+}
+
+func (lg *Logging) Infozc(msg string, ctx context.Context, fields ...Field) {
+	lg.writez(ctx, zapcore.InfoLevel, msg, fields)
+}
+
+func (lg *Logging) Warnzc(msg string, ctx context.Context, fields ...Field) {
+	lg.writez(ctx, zapcore.WarnLevel, msg, fields)
+}
+
+func (lg *Logging) Errorzc(msg string, ctx context.Context, fields ...Field) {
+	lg.writez(ctx, zapcore.ErrorLevel, msg, fields)
+}
+
+func (lg *Logging) DPaniczc(msg string, ctx context.Context, fields ...Field) {
+	lg.writez(ctx, zapcore.DPanicLevel, msg, fields)
+}
+
+func (lg *Logging) Paniczc(msg string, ctx context.Context, fields ...Field) {
+	lg.writez(ctx, zapcore.PanicLevel, msg, fields)
+}
+
+func (lg *Logging) Fatalzc(msg string, ctx context.Context, fields ...Field) {
+	lg.writez(ctx, zapcore.FatalLevel, msg, fields)
+}
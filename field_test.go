@@ -0,0 +1,150 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"testing"
+	"time"
+
+	"github.com/braveghost/meteor/mode"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func newTypedLogger(core zapcore.Core) *Logging {
+	lg := &Logging{status: true, opts: &Options{FileName: "typed"}}
+	lg.logger = lg.newSugar(core)
+	lg.derive()
+	return lg
+}
+
+// 通过 Registry.NewLogger 构造 info 级别的日志对象, 与业务代码经过相同的引擎、按名称的级别和致命钩子;
+// 注册表未设置路径, 不打开文件, 输出为空的 MultiWriteSyncer, 编码后直接丢弃
+func newDiscardLogger(tb testing.TB, opts *Options) *Logging {
+	if opts == nil {
+		opts = &Options{}
+	}
+	opts.FileName, opts.Mode = "discard", mode.ModePro
+	reg := NewRegistry()
+	tb.Cleanup(func() { reg.Close() })
+	if err := reg.NewLogger(opts); err != nil {
+		tb.Fatal(err)
+	}
+	return reg.Logger("discard")
+}
+
+func TestTypedFields(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	lg := newTypedLogger(core)
+
+	fields := make([]Field, 1, 4)
+	fields[0] = Int("n", 3)
+	ctx := WithTraceId(context.Background(), "t1")
+	lg.Infozc("typed", ctx, fields...)
+	lg.Warnz("plain", String("k", "v"), Err(errors.New("boom")), Duration("d", time.Second))
+
+	if logs.Len() != 2 {
+		t.Fatalf("want 2 entries, got %d", logs.Len())
+	}
+	m := logs.All()[0].ContextMap()
+	if m["n"] != int64(3) || m["trace_id"] != "t1" {
+		t.Fatalf("unexpected fields %v", m)
+	}
+	if len(fields[:cap(fields)][1].Key) != 0 {
+		t.Fatal("caller slice must not be modified")
+	}
+	m = logs.All()[1].ContextMap()
+	if m["k"] != "v" || m["error"] != "boom" || logs.All()[1].Caller.File == "" {
+		t.Fatalf("unexpected fields %v", m)
+	}
+
+	// 未初始化的日志对象只输出到标准日志
+	(&Logging{}).Infoz("missing", String("k", "v"))
+}
+
+func TestTypedDisabledZeroAlloc(t *testing.T) {
+	lg := newDiscardLogger(t, nil)
+	ctx := WithTraceId(context.Background(), "t1")
+	allocs := testing.AllocsPerRun(100, func() {
+		lg.Debugz("disabled", String("k", "v"), Int("n", 1))
+		lg.Debugzc("disabled", ctx, String("k", "v"), Int("n", 1))
+	})
+	if allocs != 0 {
+		t.Fatalf("disabled level should not allocate, got %v", allocs)
+	}
+}
+
+func TestCallerSkip(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	lg := newTypedLogger(core)
+	useDefaultLogger(t, lg)
+
+	_, file, _, _ := runtime.Caller(0)
+	named := newTypedLogger(core).Named("child")
+	ctx := ToContext(context.Background(), named)
+
+	lg.Info("direct")
+	lg.Infoz("typed")
+	Info("package")
+	Infowc("package context", ctx)
+	named.Infowc("child", ctx)
+	named.Infozc("child typed", ctx)
+	FromContext(ctx).Warnw("from context")
+
+	if logs.Len() != 7 {
+		t.Fatalf("want 7 entries, got %d", logs.Len())
+	}
+	for _, e := range logs.All() {
+		if filepath.Base(e.Caller.File) != filepath.Base(file) {
+			t.Errorf("%q: caller %s, want %s", e.Message, e.Caller.File, file)
+		}
+	}
+}
+
+func TestWcDoesNotModifyArgs(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	lg := newTypedLogger(core)
+	kv := make([]interface{}, 2, 8)
+	kv[0], kv[1] = "k", "v"
+	lg.Infowc("msg", WithTraceId(context.Background(), "t1"), kv...)
+	if kv[:cap(kv)][2] != nil || logs.All()[0].ContextMap()["trace_id"] != "t1" {
+		t.Fatal("*wc must not write into the caller's slice")
+	}
+}
+
+// 竞态检测下 sync.Pool 会随机丢弃放回的对象, 分配次数不稳定
+func raceEnabled() bool {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return false
+	}
+	for _, s := range info.Settings {
+		if s.Key == "-race" {
+			return s.Value == "true"
+		}
+	}
+	return false
+}
+
+// 级别开启时字段写入复用的切片, 不再逐条分配
+func TestTypedEnabledReusesFields(t *testing.T) {
+	if raceEnabled() {
+		t.Skip("allocation counts are not stable with the race detector")
+	}
+	lg := newTypedLogger(zapcore.NewNopCore())
+	lg.logger = lg.newSugar(newDiscardCore(zapcore.InfoLevel))
+	lg.derive()
+	// 同一引擎直接用 zap 写入不带字段的日志作为基准
+	plain := testing.AllocsPerRun(100, func() {
+		lg.base.Info("enabled")
+	})
+	allocs := testing.AllocsPerRun(100, func() {
+		lg.Infoz("enabled", String("k", "v"), Int("n", 1))
+	})
+	if allocs != plain {
+		t.Fatalf("fields should reuse the pooled slice, got %v allocs, %v without fields", allocs, plain)
+	}
+}
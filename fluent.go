@@ -0,0 +1,257 @@
+package logging
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"go.uber.org/zap/zapcore"
+)
+
+type FluentOptions struct {
+	NetSinkOptions
+	Addr       string        // forward 输入地址, 如 127.0.0.1:24224
+	Tag        string        // 为空时取 ServiceName.日志名称
+	RequireAck bool          // 要求对端按 chunk id 确认
+	Timeout    time.Duration // 连接和写入超时
+	AckTimeout time.Duration // 等待确认的超时
+}
+
+// Fluentd/fluent-bit forward 协议输出, 按 tag 以 PackedForward 模式批量发送
+type FluentSink struct {
+	*NetSink
+	opts FluentOptions
+}
+
+func NewFluentSink(opts FluentOptions) (*FluentSink, error) {
+	if len(opts.Name) == 0 {
+		opts.Name = "fluent"
+	}
+	if len(opts.Addr) == 0 {
+		opts.Addr = "127.0.0.1:24224"
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 3 * time.Second
+	}
+	if opts.AckTimeout == 0 {
+		opts.AckTimeout = 10 * time.Second
+	}
+	tr := &fluentTransport{opts: opts}
+	ns, err := NewNetSink(tr, opts.NetSinkOptions)
+	if err != nil {
+		return nil, err
+	}
+	return &FluentSink{NetSink: ns, opts: opts}, nil
+}
+
+// 缓存和传输中的单条记录, Entry 为 msgpack 编码的 [EventTime, record]
+type fluentRecord struct {
+	Tag   string `json:"tag"`
+	Entry []byte `json:"entry"`
+}
+
+func (fs *FluentSink) Core(opts *Options, enab zapcore.LevelEnabler) zapcore.Core {
+	tag := fs.opts.Tag
+	if len(tag) == 0 {
+		tag = fluentTag(opts.ServiceName, opts.GetName())
+	}
+	cfg := *defaultEncoderConfig
+	if opts.EncoderConfig != nil {
+		cfg = *opts.EncoderConfig
+	}
+	return fs.newRecordCore(enab, func(ent zapcore.Entry, fields []zapcore.Field) ([]byte, error) {
+		entry, err := encodeFluentEntry(&cfg, ent, fields)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(fluentRecord{Tag: tag, Entry: entry})
+	})
+}
+
+// tag 由点分隔, 各段只保留字母数字和 _-
+func fluentTag(parts ...string) string {
+	var segs []string
+	for _, p := range parts {
+		p = strings.Map(func(r rune) rune {
+			switch {
+			case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_', r == '-', r == '.':
+				return r
+			case r >= 'A' && r <= 'Z':
+				return r + 'a' - 'A'
+			}
+			return '_'
+		}, p)
+		if p = strings.Trim(p, "."); len(p) > 0 {
+			segs = append(segs, p)
+		}
+	}
+	if len(segs) == 0 {
+		return "joker"
+	}
+	return strings.Join(segs, ".")
+}
+
+func encodeFluentEntry(cfg *zapcore.EncoderConfig, ent zapcore.Entry, fields []zapcore.Field) ([]byte, error) {
+	record := fieldsToMap(fields)
+	for k, v := range record {
+		record[k] = fluentValue(v)
+	}
+	if len(cfg.MessageKey) > 0 {
+		record[cfg.MessageKey] = ent.Message
+	}
+	if len(cfg.LevelKey) > 0 {
+		record[cfg.LevelKey] = ent.Level.CapitalString()
+	}
+	if len(cfg.NameKey) > 0 && len(ent.LoggerName) > 0 {
+		record[cfg.NameKey] = ent.LoggerName
+	}
+	if len(cfg.CallerKey) > 0 && ent.Caller.Defined {
+		record[cfg.CallerKey] = ent.Caller.TrimmedPath()
+	}
+	if len(cfg.StacktraceKey) > 0 && len(ent.Stack) > 0 {
+		record[cfg.StacktraceKey] = ent.Stack
+	}
+
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.EncodeArrayLen(2)
+	// EventTime: ext type 0, 秒和纳秒各 4 字节大端
+	enc.EncodeExtHeader(0, 8)
+	var ts [8]byte
+	binary.BigEndian.PutUint32(ts[:4], uint32(ent.Time.Unix()))
+	binary.BigEndian.PutUint32(ts[4:], uint32(ent.Time.Nanosecond()))
+	buf.Write(ts[:])
+	if err := enc.Encode(record); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// msgpack 的时间扩展类型对端未必支持, 统一转为字符串
+func fluentValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case time.Time:
+		return val.Format(time.RFC3339Nano)
+	case time.Duration:
+		return val.String()
+	case map[string]interface{}:
+		for k, sub := range val {
+			val[k] = fluentValue(sub)
+		}
+	case []interface{}:
+		for i, sub := range val {
+			val[i] = fluentValue(sub)
+		}
+	}
+	return v
+}
+
+type fluentTransport struct {
+	opts FluentOptions
+	conn net.Conn
+	r    *bufio.Reader // 探测连接和读取 ack 共用, 探测时不消费数据
+	dec  *msgpack.Decoder
+}
+
+type fluentChunk struct {
+	tag     string
+	size    int
+	entries bytes.Buffer
+}
+
+// 每个 tag 一条 [tag, entries, option] 消息, 部分 tag 失败时整批重发, 对端可能收到重复数据
+func (ft *fluentTransport) Send(records [][]byte) error {
+	var (
+		chunks []*fluentChunk
+		index  = map[string]*fluentChunk{}
+	)
+	for _, raw := range records {
+		var rec fluentRecord
+		if err := json.Unmarshal(raw, &rec); err != nil {
+			continue
+		}
+		ch, ok := index[rec.Tag]
+		if !ok {
+			ch = &fluentChunk{tag: rec.Tag}
+			index[rec.Tag] = ch
+			chunks = append(chunks, ch)
+		}
+		ch.entries.Write(rec.Entry)
+		ch.size++
+	}
+	for _, ch := range chunks {
+		if err := ft.send(ch); err != nil {
+			ft.Close()
+			return err
+		}
+	}
+	return nil
+}
+
+func (ft *fluentTransport) send(ch *fluentChunk) error {
+	if ft.conn != nil && !ft.opts.RequireAck && !connAlive(ft.conn, ft.r) {
+		ft.Close()
+	}
+	if ft.conn == nil {
+		conn, err := net.DialTimeout("tcp", ft.opts.Addr, ft.opts.Timeout)
+		if err != nil {
+			return err
+		}
+		ft.conn, ft.r = conn, bufio.NewReader(conn)
+		ft.dec = msgpack.NewDecoder(ft.r)
+	}
+
+	option := map[string]interface{}{"size": ch.size}
+	var chunk string
+	if ft.opts.RequireAck {
+		var id [16]byte
+		rand.Read(id[:])
+		chunk = base64.StdEncoding.EncodeToString(id[:])
+		option["chunk"] = chunk
+	}
+	var msg bytes.Buffer
+	enc := msgpack.NewEncoder(&msg)
+	enc.EncodeArrayLen(3)
+	enc.EncodeString(ch.tag)
+	enc.EncodeBytes(ch.entries.Bytes())
+	if err := enc.Encode(option); err != nil {
+		return permanentError{err}
+	}
+
+	ft.conn.SetWriteDeadline(time.Now().Add(ft.opts.Timeout))
+	if _, err := ft.conn.Write(msg.Bytes()); err != nil {
+		return err
+	}
+	if !ft.opts.RequireAck {
+		return nil
+	}
+
+	ft.conn.SetReadDeadline(time.Now().Add(ft.opts.AckTimeout))
+	defer ft.conn.SetReadDeadline(time.Time{})
+	resp, err := ft.dec.DecodeMap()
+	if err != nil {
+		return err
+	}
+	if ack, _ := resp["ack"].(string); ack != chunk {
+		return fmt.Errorf("fluent ack mismatch: want %s, got %v", chunk, resp["ack"])
+	}
+	return nil
+}
+
+func (ft *fluentTransport) Close() error {
+	if ft.conn != nil {
+		err := ft.conn.Close()
+		ft.conn = nil
+		ft.r, ft.dec = nil, nil
+		return err
+	}
+	return nil
+}
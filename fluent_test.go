@@ -0,0 +1,179 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type forwardEntry struct {
+	tag    string
+	time   time.Time
+	record map[string]interface{}
+}
+
+// 解析 PackedForward 消息的本地 forward 服务
+type forwardServer struct {
+	ack     bool
+	mu      sync.Mutex
+	entries []forwardEntry
+	conns   []net.Conn
+	ln      net.Listener
+}
+
+func (fs *forwardServer) start(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs.ln = ln
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			fs.mu.Lock()
+			fs.conns = append(fs.conns, conn)
+			fs.mu.Unlock()
+			go fs.serve(t, conn)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func (fs *forwardServer) serve(t *testing.T, conn net.Conn) {
+	defer conn.Close()
+	dec := msgpack.NewDecoder(conn)
+	for {
+		if n, err := dec.DecodeArrayLen(); err != nil || n != 3 {
+			return
+		}
+		tag, _ := dec.DecodeString()
+		packed, _ := dec.DecodeBytes()
+		option, err := dec.DecodeMap()
+		if err != nil {
+			t.Errorf("decode option: %v", err)
+			return
+		}
+
+		var got []forwardEntry
+		ed := msgpack.NewDecoder(bytes.NewReader(packed))
+		for {
+			if _, err := ed.DecodeArrayLen(); err != nil {
+				break
+			}
+			id, size, _ := ed.DecodeExtHeader()
+			ts := make([]byte, size)
+			ed.ReadFull(ts)
+			if id != 0 || size != 8 {
+				t.Errorf("want EventTime, got ext %d/%d", id, size)
+			}
+			record, _ := ed.DecodeMap()
+			got = append(got, forwardEntry{
+				tag:    tag,
+				time:   time.Unix(int64(binary.BigEndian.Uint32(ts[:4])), int64(binary.BigEndian.Uint32(ts[4:]))),
+				record: record,
+			})
+		}
+		if fmt.Sprint(option["size"]) != fmt.Sprint(len(got)) {
+			t.Errorf("option size %v, decoded %d entries", option["size"], len(got))
+		}
+		fs.mu.Lock()
+		fs.entries = append(fs.entries, got...)
+		fs.mu.Unlock()
+
+		if fs.ack {
+			b, _ := msgpack.Marshal(map[string]interface{}{"ack": option["chunk"]})
+			conn.Write(b)
+		}
+	}
+}
+
+// 断开当前所有连接, 监听保持
+func (fs *forwardServer) drop() {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for _, c := range fs.conns {
+		c.Close()
+	}
+}
+
+func (fs *forwardServer) received() []forwardEntry {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return append([]forwardEntry(nil), fs.entries...)
+}
+
+func TestFluentSinkAck(t *testing.T) {
+	srv := &forwardServer{ack: true}
+	addr := srv.start(t)
+	defer srv.ln.Close()
+
+	fs, err := NewFluentSink(FluentOptions{Addr: addr, RequireAck: true, AckTimeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Close()
+
+	opts := &Options{ServiceName: "Order", FileName: "api"}
+	lg := zap.New(fs.Core(opts, zapcore.DebugLevel))
+	now := time.Now()
+	lg.Info("hello", zap.String("user", "u1"), zap.Duration("cost", time.Second))
+	lg.Error("boom")
+	fs.Sync()
+
+	got := srv.received()
+	if len(got) != 2 {
+		t.Fatalf("want 2 entries, got %d", len(got))
+	}
+	e := got[0]
+	if e.tag != "order.api" || e.record["msg"] != "hello" || e.record["level"] != "INFO" || e.record["user"] != "u1" || e.record["cost"] != "1s" {
+		t.Fatalf("unexpected entry %+v", e)
+	}
+	if d := e.time.Sub(now); d < 0 || d > time.Second {
+		t.Fatalf("unexpected event time %v", e.time)
+	}
+	if _, n := fs.SpoolDepth(); n != 0 {
+		t.Fatalf("acked entries should not be spooled")
+	}
+}
+
+func TestFluentSinkReconnect(t *testing.T) {
+	srv := &forwardServer{}
+	addr := srv.start(t)
+	defer srv.ln.Close()
+
+	fs, err := NewFluentSink(FluentOptions{Addr: addr, Tag: "app.test", NetSinkOptions: NetSinkOptions{
+		FlushInterval: 10 * time.Millisecond,
+		MinBackoff:    10 * time.Millisecond,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Close()
+
+	lg := zap.New(fs.Core(&Options{}, zapcore.DebugLevel))
+	lg.Info("first")
+	fs.Sync()
+	waitFor(t, func() bool { return len(srv.received()) == 1 })
+
+	// 对端断开后重新建立连接
+	srv.drop()
+	lg.Info("second")
+	fs.Sync()
+	waitFor(t, func() bool { return len(srv.received()) == 2 })
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if len(srv.conns) != 2 || srv.entries[1].tag != "app.test" || srv.entries[1].record["msg"] != "second" {
+		t.Fatalf("conns=%d entries=%+v", len(srv.conns), srv.entries)
+	}
+}
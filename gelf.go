@@ -0,0 +1,251 @@
+package logging
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"encoding/json"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+type gelfProtocol int
+
+const (
+	GelfUDP gelfProtocol = iota
+	GelfTCP
+)
+
+type gelfCompression int
+
+const (
+	GelfGzip gelfCompression = iota
+	GelfZlib
+	GelfNone
+)
+
+const (
+	gelfChunkHeader = 12
+	gelfMaxChunks   = 128
+)
+
+type GelfOptions struct {
+	NetSinkOptions
+	Addr        string          // Graylog GELF 输入地址, 如 graylog:12201
+	Protocol    gelfProtocol    // UDP 或 TCP
+	Compression gelfCompression // 仅 UDP 有效, TCP 不支持压缩
+	ChunkSize   int             // UDP 单个数据包上限, 超出时分片, 默认 1420
+	Timeout     time.Duration   // 连接和写入超时
+}
+
+// GELF 1.1 输出, 级别按 syslog 严重度, 键值对写为 _ 开头的附加字段
+type GelfSink struct {
+	*NetSink
+	opts GelfOptions
+}
+
+func NewGelfSink(opts GelfOptions) (*GelfSink, error) {
+	if len(opts.Name) == 0 {
+		opts.Name = "gelf"
+	}
+	if len(opts.Addr) == 0 {
+		opts.Addr = "127.0.0.1:12201"
+	}
+	if opts.ChunkSize <= gelfChunkHeader {
+		opts.ChunkSize = 1420
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 3 * time.Second
+	}
+	var tr Transport
+	if opts.Protocol == GelfTCP {
+		tr = gelfTCPTransport{NewTCPTransport(opts.Addr, opts.Timeout)}
+	} else {
+		tr = &gelfUDPTransport{opts: opts}
+	}
+	ns, err := NewNetSink(tr, opts.NetSinkOptions)
+	if err != nil {
+		return nil, err
+	}
+	return &GelfSink{NetSink: ns, opts: opts}, nil
+}
+
+// zap 级别对应的 syslog 严重度
+func gelfLevel(lvl zapcore.Level) int {
+	switch lvl {
+	case zapcore.DebugLevel:
+		return 7
+	case zapcore.InfoLevel:
+		return 6
+	case zapcore.WarnLevel:
+		return 4
+	case zapcore.ErrorLevel:
+		return 3
+	case zapcore.DPanicLevel:
+		return 2
+	case zapcore.PanicLevel:
+		return 1
+	}
+	return 0
+}
+
+func (gs *GelfSink) Core(opts *Options, enab zapcore.LevelEnabler) zapcore.Core {
+	host := opts.ServiceName
+	if len(host) == 0 {
+		host, _ = os.Hostname()
+	}
+	service := opts.ServiceName
+	logger := opts.GetName()
+	return gs.newRecordCore(enab, func(ent zapcore.Entry, fields []zapcore.Field) ([]byte, error) {
+		return json.Marshal(gelfMessage(host, service, logger, ent, fields))
+	})
+}
+
+func gelfMessage(host, service, logger string, ent zapcore.Entry, fields []zapcore.Field) map[string]interface{} {
+	msg := map[string]interface{}{}
+	for k, v := range fieldsToMap(fields) {
+		msg[gelfFieldName(k)] = v
+	}
+	delete(msg, "_service_name")
+	msg["version"] = "1.1"
+	msg["host"] = host
+	msg["short_message"] = ent.Message
+	msg["timestamp"] = float64(ent.Time.UnixNano()/int64(time.Millisecond)) / 1000
+	msg["level"] = gelfLevel(ent.Level)
+	if len(service) > 0 {
+		msg["_service"] = service
+	}
+	msg["_logger"] = logger
+	if ent.Caller.Defined {
+		msg["_file"] = ent.Caller.TrimmedPath()
+		msg["_line"] = ent.Caller.Line
+	}
+	if len(ent.Stack) > 0 {
+		msg["full_message"] = ent.Message + "\n" + ent.Stack
+	}
+	return msg
+}
+
+// 附加字段名只允许字母数字和 _.-, _id 为保留字段
+func gelfFieldName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '.', r == '-':
+			return r
+		}
+		return '_'
+	}, key)
+	if name == "id" {
+		name = "id_"
+	}
+	return "_" + name
+}
+
+// TCP 以空字节分隔消息
+type gelfTCPTransport struct {
+	*TCPTransport
+}
+
+func (gt gelfTCPTransport) Send(records [][]byte) error {
+	framed := make([][]byte, 0, len(records))
+	for _, rec := range records {
+		framed = append(framed, append(rec[:len(rec):len(rec)], 0))
+	}
+	return gt.TCPTransport.Send(framed)
+}
+
+type gelfUDPTransport struct {
+	opts GelfOptions
+	conn net.Conn
+}
+
+func (gu *gelfUDPTransport) Send(records [][]byte) error {
+	if gu.conn == nil {
+		conn, err := net.DialTimeout("udp", gu.opts.Addr, gu.opts.Timeout)
+		if err != nil {
+			return err
+		}
+		gu.conn = conn
+	}
+	for _, rec := range records {
+		payload, err := gu.compress(rec)
+		if err != nil {
+			return permanentError{err}
+		}
+		if err := gu.write(payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (gu *gelfUDPTransport) compress(rec []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	switch gu.opts.Compression {
+	case GelfGzip:
+		zw := gzip.NewWriter(&buf)
+		zw.Write(rec)
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+	case GelfZlib:
+		zw := zlib.NewWriter(&buf)
+		zw.Write(rec)
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+	default:
+		return rec, nil
+	}
+	return buf.Bytes(), nil
+}
+
+// 超过 ChunkSize 时按 GELF 分片格式发送: 0x1e 0x0f, 8 字节消息 id, 序号, 总数
+func (gu *gelfUDPTransport) write(payload []byte) error {
+	gu.conn.SetWriteDeadline(time.Now().Add(gu.opts.Timeout))
+	if len(payload) <= gu.opts.ChunkSize {
+		_, err := gu.conn.Write(payload)
+		return err
+	}
+	size := gu.opts.ChunkSize - gelfChunkHeader
+	count := (len(payload) + size - 1) / size
+	if count > gelfMaxChunks {
+		// 丢弃该条, 不影响同批其他消息
+		atomic.AddUint64(metrics.counter("sink_dropped_total", gu.opts.Name), 1)
+		log.Printf("Logging.GelfSink.Write.Error || size=%d | err=too many chunks\n", len(payload))
+		return nil
+	}
+	var id [8]byte
+	rand.Read(id[:])
+	chunk := make([]byte, 0, gu.opts.ChunkSize)
+	for i := 0; i < count; i++ {
+		end := (i + 1) * size
+		if end > len(payload) {
+			end = len(payload)
+		}
+		chunk = append(chunk[:0], 0x1e, 0x0f)
+		chunk = append(chunk, id[:]...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunk = append(chunk, payload[i*size:end]...)
+		if _, err := gu.conn.Write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (gu *gelfUDPTransport) Close() error {
+	if gu.conn != nil {
+		err := gu.conn.Close()
+		gu.conn = nil
+		return err
+	}
+	return nil
+}
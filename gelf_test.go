@@ -0,0 +1,173 @@
+package logging
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// 收集 UDP 数据包, 按 GELF 分片格式重组并解压
+func gelfUDPServer(t *testing.T) (string, <-chan map[string]interface{}) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	out := make(chan map[string]interface{}, 10)
+	go func() {
+		chunks := map[string][][]byte{}
+		buf := make([]byte, 65536)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			pkt := append([]byte(nil), buf[:n]...)
+			if pkt[0] == 0x1e && pkt[1] == 0x0f {
+				id, seq, count := string(pkt[2:10]), pkt[10], int(pkt[11])
+				if chunks[id] == nil {
+					chunks[id] = make([][]byte, count)
+				}
+				chunks[id][seq] = pkt[12:]
+				complete := true
+				for _, c := range chunks[id] {
+					complete = complete && c != nil
+				}
+				if !complete {
+					continue
+				}
+				pkt = bytes.Join(chunks[id], nil)
+				delete(chunks, id)
+			}
+			var r io.Reader = bytes.NewReader(pkt)
+			switch {
+			case pkt[0] == 0x1f && pkt[1] == 0x8b:
+				r, _ = gzip.NewReader(r)
+			case pkt[0] == 0x78:
+				r, _ = zlib.NewReader(r)
+			}
+			raw, _ := ioutil.ReadAll(r)
+			var msg map[string]interface{}
+			if err := json.Unmarshal(raw, &msg); err != nil {
+				t.Errorf("bad gelf payload %q", raw)
+				continue
+			}
+			out <- msg
+		}
+	}()
+	return conn.LocalAddr().String(), out
+}
+
+func recvGelf(t *testing.T, ch <-chan map[string]interface{}) map[string]interface{} {
+	select {
+	case msg := <-ch:
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatal("no gelf message")
+	}
+	return nil
+}
+
+func TestGelfSinkUDPChunked(t *testing.T) {
+	addr, ch := gelfUDPServer(t)
+	gs, err := NewGelfSink(GelfOptions{Addr: addr, ChunkSize: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gs.Close()
+
+	opts := &Options{ServiceName: "order", FileName: "api"}
+	lg := zap.New(gs.Core(opts, zapcore.DebugLevel), zap.AddCaller())
+	lg.Warn("large", zap.String("payload", strings.Repeat("x", 2000)), zap.Int("id", 7))
+	gs.Sync()
+
+	msg := recvGelf(t, ch)
+	if msg["version"] != "1.1" || msg["host"] != "order" || msg["_service"] != "order" || msg["short_message"] != "large" {
+		t.Fatalf("unexpected message %v", msg)
+	}
+	if msg["level"].(float64) != 4 || len(msg["_payload"].(string)) != 2000 || msg["_id_"].(float64) != 7 {
+		t.Fatalf("unexpected fields %v", msg)
+	}
+	if _, ok := msg["_file"]; !ok {
+		t.Fatalf("missing caller in %v", msg)
+	}
+}
+
+func TestGelfSinkUDPZlib(t *testing.T) {
+	addr, ch := gelfUDPServer(t)
+	gs, err := NewGelfSink(GelfOptions{Addr: addr, Compression: GelfZlib})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gs.Close()
+
+	zap.New(gs.Core(&Options{}, zapcore.DebugLevel)).Error("boom")
+	gs.Sync()
+	if msg := recvGelf(t, ch); msg["short_message"] != "boom" || msg["level"].(float64) != 3 {
+		t.Fatalf("unexpected message %v", msg)
+	}
+}
+
+func TestGelfSinkTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	got := make(chan string, 10)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		rd := bufio.NewReader(conn)
+		for {
+			frame, err := rd.ReadString(0)
+			if err != nil {
+				return
+			}
+			got <- strings.TrimSuffix(frame, "\x00")
+		}
+	}()
+
+	gs, err := NewGelfSink(GelfOptions{Addr: ln.Addr().String(), Protocol: GelfTCP})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gs.Close()
+
+	lg := zap.New(gs.Core(&Options{ServiceName: "order"}, zapcore.DebugLevel))
+	lg.Info("one", zap.String("trace_id", "t1"))
+	lg.Debug("two")
+	gs.Sync()
+
+	for _, want := range []string{"one", "two"} {
+		select {
+		case frame := <-got:
+			var msg map[string]interface{}
+			if err := json.Unmarshal([]byte(frame), &msg); err != nil {
+				t.Fatal(err)
+			}
+			if msg["short_message"] != want {
+				t.Fatalf("want %s, got %v", want, msg)
+			}
+			if want == "one" && msg["_trace_id"] != "t1" {
+				t.Fatalf("missing trace id in %v", msg)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("no frame")
+		}
+	}
+}
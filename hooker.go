@@ -46,6 +46,9 @@ type RollRule struct {
 	MaxAge       int           // 文件最多保存多少天
 	Compress     bool          // 是否压缩
 	RotationTime time.Duration // 日志切割时间间隔
+	Index        *IndexRule    // 切割后建立旁路索引, nil 表示不建立
+
+	traceKey string // 索引的 trace id 字段名, 由日志对象按注册表设置
 }
 
 func (rr RollRule) maxAge() time.Duration {
@@ -76,6 +79,7 @@ func getHook(rr *RollRule) zapcore.WriteSyncer {
 				rotatelogs.WithLinkName(rr.fullName()),       // 生成软链，指向最新日志文件
 				rotatelogs.WithMaxAge(rr.maxAge()),           // 文件最大保存时间
 				rotatelogs.WithRotationTime(rr.RotationTime), // 日志切割时间间隔
+				rotatelogs.WithHandler(rotatedHandler(rr)),
 			)
 
 			if err != nil {
@@ -91,7 +95,7 @@ func getHook(rr *RollRule) zapcore.WriteSyncer {
 				MaxAge:     rr.MaxAge,     // 文件最多保存多少天
 				Compress:   rr.Compress,   // 是否压缩
 			}
-			return zapcore.AddSync(&outHook)
+			return zapcore.AddSync(newIndexedWriter(&outHook, rr))
 		default:
 			log.Println("Logging.Hooker.GetHook.RotationType.Error")
 		}
@@ -101,18 +105,32 @@ func getHook(rr *RollRule) zapcore.WriteSyncer {
 	return nil
 }
 
+// 统计切割次数, 首次打开文件不计; 设置了索引规则时为切割前的文件建立索引
+func rotatedHandler(rr *RollRule) rotatelogs.Handler {
+	return rotatelogs.HandlerFunc(func(e rotatelogs.Event) {
+		if ev, ok := e.(*rotatelogs.FileRotatedEvent); ok && len(ev.PreviousFile()) > 0 {
+			metrics.rotated(rr.Filename)
+			if rr.Index != nil {
+				go rr.buildIndex(ev.PreviousFile())
+			}
+		}
+	})
+}
+
 func getErrHook(errRr *RollRule) zapcore.WriteSyncer {
 	return getHook(errRr)
 }
 
-// 默认全 level 日志切割规则
+// 默认全 level 日志切割规则, 每次返回副本
 func GetDefaultRollRule(fName string) *RollRule {
-	defaultRollRule.Filename = fName
-	return &defaultRollRule
+	rule := defaultRollRule
+	rule.Filename = fName
+	return &rule
 }
 
-// 默认 error 等级日志切割规则
+// 默认 error 等级日志切割规则, 每次返回副本
 func GetDefaultErrRollRule(fName string) *RollRule {
-	defaultErrRollRule.Filename = fName
-	return &defaultErrRollRule
+	rule := defaultErrRollRule
+	rule.Filename = fName
+	return &rule
 }
@@ -0,0 +1,55 @@
+package index
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+// 布隆过滤器, 使用双重哈希生成 k 个位置
+type bloom struct {
+	bits []byte
+	k    int
+}
+
+func newBloom(n int, fp float64) *bloom {
+	if n < 1 {
+		n = 1
+	}
+	m := int(math.Ceil(-float64(n) * math.Log(fp) / (math.Ln2 * math.Ln2)))
+	k := int(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &bloom{bits: make([]byte, (m+7)/8), k: k}
+}
+
+func (b *bloom) locations(s string) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	sum := h.Sum64()
+	return sum, sum>>32 | 1
+}
+
+func (b *bloom) add(s string) {
+	h1, h2 := b.locations(s)
+	m := uint64(len(b.bits)) * 8
+	for i := 0; i < b.k; i++ {
+		pos := (h1 + uint64(i)*h2) % m
+		b.bits[pos/8] |= 1 << (pos % 8)
+	}
+}
+
+func (b *bloom) has(s string) bool {
+	h1, h2 := b.locations(s)
+	m := uint64(len(b.bits)) * 8
+	if m == 0 {
+		return false
+	}
+	for i := 0; i < b.k; i++ {
+		pos := (h1 + uint64(i)*h2) % m
+		if b.bits[pos/8]&(1<<(pos%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
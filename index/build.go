@@ -0,0 +1,202 @@
+package index
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 未指定时间格式时依次尝试, 与 joker 的默认编码一致的格式在前
+var DefaultTimeLayouts = []string{
+	"2006-01-02T15:04:05.0000",
+	"2006-01-02T15:04:05.000Z0700",
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05",
+}
+
+// 建立索引的参数, 零值使用默认值
+type Options struct {
+	TraceKey      string         // trace id 字段名, 默认 trace_id
+	TimeKey       string         // JSON 编码的时间字段名, 默认 time
+	TimeLayouts   []string       // 时间格式, 默认 DefaultTimeLayouts
+	Location      *time.Location // 不带时区的时间所在时区, 默认本地时区
+	Bucket        time.Duration  // 时间桶大小, 默认 1 分钟
+	FalsePositive float64        // 布隆过滤器误判率, 默认 0.01
+}
+
+func (o Options) withDefaults() Options {
+	if len(o.TraceKey) == 0 {
+		o.TraceKey = "trace_id"
+	}
+	if len(o.TimeKey) == 0 {
+		o.TimeKey = "time"
+	}
+	if len(o.TimeLayouts) == 0 {
+		o.TimeLayouts = DefaultTimeLayouts
+	}
+	if o.Location == nil {
+		o.Location = time.Local
+	}
+	if o.Bucket <= 0 {
+		o.Bucket = time.Minute
+	}
+	if o.FalsePositive <= 0 || o.FalsePositive >= 1 {
+		o.FalsePositive = 0.01
+	}
+	return o
+}
+
+// 读取日志文件(可为 .gz)建立索引, 先写临时文件再改名, 读到的总是完整的索引
+func Build(file string, opts Options) error {
+	opts = opts.withDefaults()
+	ix, err := scan(file, opts)
+	if err != nil {
+		return err
+	}
+	out := Path(file)
+	tmp, err := ioutil.TempFile(filepath.Dir(out), filepath.Base(out)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(ix.encode()); err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), out)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+func scan(file string, opts Options) (*Index, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(file, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	ix := &Index{traceKey: opts.TraceKey, bucket: opts.Bucket, traces: map[string][]int64{}}
+	br := bufio.NewReaderSize(r, 64*1024)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			ix.add(line, ix.size, opts)
+			ix.size += int64(len(line))
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ix.bloom = newBloom(len(ix.traces), opts.FalsePositive)
+	for id := range ix.traces {
+		ix.bloom.add(id)
+	}
+	return ix, nil
+}
+
+// 记录一行的时间桶和 trace id, 堆栈等非日志起始行两者都取不到
+func (ix *Index) add(line []byte, offset int64, opts Options) {
+	if t, ok := lineTime(line, opts); ok {
+		if ix.first.IsZero() || t.Before(ix.first) {
+			ix.first = t
+		}
+		if t.After(ix.last) {
+			ix.last = t
+		}
+		start := t.Truncate(opts.Bucket).Unix()
+		if n := len(ix.buckets); n == 0 || start > ix.buckets[n-1].start {
+			ix.buckets = append(ix.buckets, bucket{start: start, offset: offset})
+		}
+	}
+	if id, ok := stringValue(line, opts.TraceKey); ok && len(id) > 0 {
+		ix.traces[id] = append(ix.traces[id], offset)
+	}
+}
+
+// 控制台编码取第一列, JSON 编码取时间字段
+func lineTime(line []byte, opts Options) (time.Time, bool) {
+	var s string
+	if len(line) > 0 && line[0] == '{' {
+		v, ok := stringValue(line, opts.TimeKey)
+		if !ok {
+			return time.Time{}, false
+		}
+		s = v
+	} else {
+		i := bytes.IndexByte(line, '\t')
+		if i <= 0 {
+			return time.Time{}, false
+		}
+		s = string(line[:i])
+	}
+	for _, layout := range opts.TimeLayouts {
+		if t, err := time.ParseInLocation(layout, s, opts.Location); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// 在一行中查找 "key": value 形式的字符串或数字值, 控制台编码的字段 JSON 冒号后带空格
+func stringValue(line []byte, key string) (string, bool) {
+	pattern := []byte(strconv.Quote(key) + ":")
+	i := bytes.Index(line, pattern)
+	if i < 0 {
+		return "", false
+	}
+	rest := bytes.TrimLeft(line[i+len(pattern):], " ")
+	if len(rest) == 0 {
+		return "", false
+	}
+	if rest[0] != '"' {
+		end := bytes.IndexAny(rest, ",} \t\r\n")
+		if end < 0 {
+			end = len(rest)
+		}
+		v := string(rest[:end])
+		if _, err := strconv.ParseFloat(v, 64); err != nil {
+			return "", false
+		}
+		return v, true
+	}
+	escaped := false
+	for j := 1; j < len(rest); j++ {
+		switch {
+		case escaped:
+			escaped = false
+		case rest[j] == '\\':
+			escaped = true
+		case rest[j] == '"':
+			if !bytes.ContainsRune(rest[1:j], '\\') {
+				return string(rest[1:j]), true
+			}
+			s, err := strconv.Unquote(string(rest[:j+1]))
+			return s, err == nil
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,299 @@
+// 切割后日志文件的旁路索引: 记录 trace id 的布隆过滤器、trace id 到行偏移的映射
+// 以及时间桶到行偏移的映射, 查询时据此跳过无关文件并直接定位到匹配的行;
+// 索引文件与日志文件同目录, 名称为去掉 .gz 后加 .idx
+package index
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const Ext = ".idx"
+
+const (
+	magic   = "JKIX"
+	version = 1
+)
+
+var FormatError = errors.New("invalid index file")
+
+// 日志文件对应的索引文件路径, 压缩前后共用同一个索引
+func Path(file string) string {
+	return strings.TrimSuffix(file, ".gz") + Ext
+}
+
+type bucket struct {
+	start  int64 // 桶起始时间, unix 秒
+	offset int64 // 桶内第一行的偏移
+}
+
+// 单个日志文件的索引
+type Index struct {
+	size        int64
+	traceKey    string
+	bucket      time.Duration
+	first, last time.Time
+	buckets     []bucket
+	bloom       *bloom
+
+	// trace id 映射在第一次查询时解码
+	raw    []byte
+	once   sync.Once
+	traces map[string][]int64
+	err    error
+}
+
+// 读取日志文件的索引, 不存在时返回的错误满足 os.IsNotExist
+func Open(file string) (*Index, error) {
+	b, err := ioutil.ReadFile(Path(file))
+	if err != nil {
+		return nil, err
+	}
+	return decode(b)
+}
+
+// 建立索引时日志内容的大小, 压缩文件为解压后的大小
+func (ix *Index) Size() int64 {
+	return ix.size
+}
+
+// 索引是否与日志文件当前内容一致: 普通文件比较大小, 压缩文件比较 gzip 尾部记录的解压大小 (对 2^32 取模);
+// 不一致说明建立索引后文件仍在写入或压缩, 需要重建
+func (ix *Index) Matches(file string) bool {
+	f, err := os.Open(file)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	if !strings.HasSuffix(file, ".gz") {
+		return fi.Size() == ix.size
+	}
+	var trailer [4]byte
+	if fi.Size() < 4 {
+		return false
+	}
+	if _, err := f.ReadAt(trailer[:], fi.Size()-4); err != nil {
+		return false
+	}
+	return uint32(ix.size) == binary.LittleEndian.Uint32(trailer[:])
+}
+
+// 索引的 trace id 字段名
+func (ix *Index) TraceKey() string {
+	return ix.traceKey
+}
+
+// 文件中日志的时间范围, 无法解析时间时为零值
+func (ix *Index) Range() (time.Time, time.Time) {
+	return ix.first, ix.last
+}
+
+// 文件可能包含该 trace id, 返回 false 时一定不包含
+func (ix *Index) MayContain(traceId string) bool {
+	return ix.bloom.has(traceId)
+}
+
+// 包含该 trace id 的日志行偏移, 按偏移升序
+func (ix *Index) Offsets(traceId string) ([]int64, error) {
+	if !ix.bloom.has(traceId) {
+		return nil, nil
+	}
+	ix.once.Do(ix.decodeTraces)
+	if ix.err != nil {
+		return nil, ix.err
+	}
+	return ix.traces[traceId], nil
+}
+
+// 从该偏移开始读取不会漏掉 t 之后的日志; 往前多退一个桶, 容忍并发写入造成的少量乱序
+func (ix *Index) Offset(t time.Time) int64 {
+	sec := t.Add(-ix.bucket).Unix()
+	i := sort.Search(len(ix.buckets), func(i int) bool { return ix.buckets[i].start > sec })
+	if i == 0 {
+		return 0
+	}
+	return ix.buckets[i-1].offset
+}
+
+// 格式: magic, 版本, 日志大小, trace 键, 桶大小, 时间范围, 时间桶, 布隆过滤器, trace id 映射;
+// 整数使用 varint, 偏移和时间按差值存储
+func (ix *Index) encode() []byte {
+	var e encoder
+	e.buf.WriteString(magic)
+	e.uvarint(version)
+	e.varint(ix.size)
+	e.string(ix.traceKey)
+	e.varint(int64(ix.bucket))
+	e.varint(unixNano(ix.first))
+	e.varint(unixNano(ix.last))
+	e.uvarint(uint64(len(ix.buckets)))
+	var prev bucket
+	for _, b := range ix.buckets {
+		e.varint(b.start - prev.start)
+		e.varint(b.offset - prev.offset)
+		prev = b
+	}
+	e.uvarint(uint64(ix.bloom.k))
+	e.uvarint(uint64(len(ix.bloom.bits)))
+	e.buf.Write(ix.bloom.bits)
+
+	ids := make([]string, 0, len(ix.traces))
+	for id := range ix.traces {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	e.uvarint(uint64(len(ids)))
+	for _, id := range ids {
+		e.string(id)
+		offsets := ix.traces[id]
+		e.uvarint(uint64(len(offsets)))
+		var last int64
+		for _, off := range offsets {
+			e.varint(off - last)
+			last = off
+		}
+	}
+	return e.buf.Bytes()
+}
+
+func decode(b []byte) (*Index, error) {
+	if !bytes.HasPrefix(b, []byte(magic)) {
+		return nil, FormatError
+	}
+	d := &decoder{b: b[len(magic):]}
+	if d.uvarint() != version {
+		return nil, FormatError
+	}
+	ix := &Index{size: d.varint(), traceKey: d.string(), bucket: time.Duration(d.varint())}
+	ix.first, ix.last = fromUnixNano(d.varint()), fromUnixNano(d.varint())
+	n := d.count()
+	ix.buckets = make([]bucket, 0, n)
+	var prev bucket
+	for i := 0; i < n && d.err == nil; i++ {
+		prev = bucket{start: prev.start + d.varint(), offset: prev.offset + d.varint()}
+		ix.buckets = append(ix.buckets, prev)
+	}
+	ix.bloom = &bloom{k: int(d.uvarint())}
+	ix.bloom.bits = d.bytes(d.count())
+	if d.err != nil {
+		return nil, d.err
+	}
+	ix.raw = d.b
+	return ix, nil
+}
+
+func (ix *Index) decodeTraces() {
+	d := &decoder{b: ix.raw}
+	n := d.count()
+	traces := make(map[string][]int64, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		id := d.string()
+		offsets := make([]int64, d.count())
+		var last int64
+		for j := range offsets {
+			last += d.varint()
+			offsets[j] = last
+		}
+		traces[id] = offsets
+	}
+	ix.traces, ix.err = traces, d.err
+}
+
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func fromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+type encoder struct {
+	buf bytes.Buffer
+	tmp [binary.MaxVarintLen64]byte
+}
+
+func (e *encoder) uvarint(v uint64) {
+	e.buf.Write(e.tmp[:binary.PutUvarint(e.tmp[:], v)])
+}
+
+func (e *encoder) varint(v int64) {
+	e.buf.Write(e.tmp[:binary.PutVarint(e.tmp[:], v)])
+}
+
+func (e *encoder) string(s string) {
+	e.uvarint(uint64(len(s)))
+	e.buf.WriteString(s)
+}
+
+// 解码出错后后续读取均返回零值
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		d.err = FormatError
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.b)
+	if n <= 0 {
+		d.err = FormatError
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+// 长度或数量, 不能超过剩余字节数
+func (d *decoder) count() int {
+	n := d.uvarint()
+	if n > uint64(len(d.b)) {
+		d.err = FormatError
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil || n > len(d.b) {
+		d.err = FormatError
+		return nil
+	}
+	b := d.b[:n]
+	d.b = d.b[n:]
+	return b
+}
+
+func (d *decoder) string() string {
+	return string(d.bytes(d.count()))
+}
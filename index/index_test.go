@@ -0,0 +1,114 @@
+package index
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var base = time.Date(2026, 10, 17, 10, 0, 0, 0, time.Local)
+
+func line(at time.Duration, trace string) string {
+	fields := ""
+	if len(trace) > 0 {
+		fields = fmt.Sprintf("\t{\"trace_id\": %q}", trace)
+	}
+	return base.Add(at).Format("2006-01-02T15:04:05.0000") + "\tINFO\tsvc/a.go:1\tmsg" + fields + "\n"
+}
+
+func TestBuildAndOpen(t *testing.T) {
+	dir := t.TempDir()
+	lines := []string{
+		line(0, "t1"),
+		line(30*time.Second, "t2"),
+		"goroutine 1 [running]:\n",
+		line(90*time.Second, "t1"),
+		line(3*time.Minute, ""),
+		`{"time":"2026-10-17T10:04:00.0000","trace_id":"t\"3","n":1}` + "\n",
+		`{"time":"2026-10-17T10:05:00.0000","trace_id":42}` + "\n",
+	}
+	var offsets []int64
+	var off int64
+	for _, l := range lines {
+		offsets = append(offsets, off)
+		off += int64(len(l))
+	}
+	content := strings.Join(lines, "")
+
+	plain := filepath.Join(dir, "app.log.20261017")
+	ioutil.WriteFile(plain, []byte(content), 0644)
+	gz := filepath.Join(dir, "app-2026-10-17T10-00-00.000.log.gz")
+	f, _ := os.Create(gz)
+	zw := gzip.NewWriter(f)
+	zw.Write([]byte(content))
+	zw.Close()
+	f.Close()
+
+	for _, file := range []string{plain, gz} {
+		if err := Build(file, Options{}); err != nil {
+			t.Fatal(err)
+		}
+		ix, err := Open(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ix.Size() != int64(len(content)) || ix.TraceKey() != "trace_id" {
+			t.Fatalf("%s: size %d key %s", file, ix.Size(), ix.TraceKey())
+		}
+		first, last := ix.Range()
+		if !first.Equal(base) || !last.Equal(base.Add(5*time.Minute)) {
+			t.Fatalf("range %v %v", first, last)
+		}
+		for id, want := range map[string][]int64{
+			"t1":  {offsets[0], offsets[3]},
+			"t2":  {offsets[1]},
+			`t"3`: {offsets[5]},
+			"42":  {offsets[6]},
+		} {
+			got, err := ix.Offsets(id)
+			if err != nil || !reflect.DeepEqual(got, want) || !ix.MayContain(id) {
+				t.Fatalf("%s: offsets %v, want %v (%v)", id, got, want, err)
+			}
+		}
+		if got, _ := ix.Offsets("missing"); got != nil {
+			t.Fatalf("missing trace %v", got)
+		}
+		// 往前多退一个桶
+		if got := ix.Offset(base.Add(3*time.Minute + 10*time.Second)); got != offsets[3] {
+			t.Fatalf("offset %d, want %d", got, offsets[3])
+		}
+		if got := ix.Offset(base.Add(-time.Hour)); got != 0 {
+			t.Fatalf("offset before range %d", got)
+		}
+	}
+	if Path(gz) != strings.TrimSuffix(gz, ".gz")+".idx" {
+		t.Fatalf("path %s", Path(gz))
+	}
+
+	ioutil.WriteFile(Path(plain), []byte("JKIX\x01\x05"), 0644)
+	if _, err := Open(plain); err != FormatError {
+		t.Fatalf("want FormatError, got %v", err)
+	}
+}
+
+func TestBloomFalsePositive(t *testing.T) {
+	b := newBloom(1000, 0.01)
+	for i := 0; i < 1000; i++ {
+		b.add(fmt.Sprintf("trace-%d", i))
+	}
+	fp := 0
+	for i := 0; i < 10000; i++ {
+		if b.has(fmt.Sprintf("other-%d", i)) {
+			fp++
+		}
+	}
+	if fp > 300 {
+		t.Fatalf("false positives %d/10000", fp)
+	}
+}
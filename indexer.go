@@ -0,0 +1,162 @@
+package logging
+
+import (
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/braveghost/joker/index"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// 切割后旁路索引规则, 零值使用默认值
+type IndexRule struct {
+	Bucket        time.Duration // 时间桶大小, 默认 1 分钟
+	FalsePositive float64       // 布隆过滤器误判率, 默认 0.01
+	TimeLayout    string        // 使用 TimeFormater 自定义时间格式时需设置
+}
+
+const indexBuildLogMsg = "Logging.Index.Build.Error || file=%s | err=%s\n"
+
+// 同一时间只建立一个索引, 避免切割频繁时占用过多 IO
+var indexMu sync.Mutex
+
+func (rr *RollRule) indexOptions() index.Options {
+	opts := index.Options{
+		TraceKey:      rr.traceKey,
+		Bucket:        rr.Index.Bucket,
+		FalsePositive: rr.Index.FalsePositive,
+	}
+	if len(rr.Index.TimeLayout) > 0 {
+		opts.TimeLayouts = []string{rr.Index.TimeLayout}
+	}
+	return opts
+}
+
+func (rr *RollRule) buildIndex(file string) {
+	indexMu.Lock()
+	defer indexMu.Unlock()
+	if err := index.Build(file, rr.indexOptions()); err != nil {
+		log.Printf(indexBuildLogMsg, file, err.Error())
+		return
+	}
+	atomic.AddUint64(metrics.counter("index_built_total", rr.Filename), 1)
+}
+
+// 为没有索引的 lumberjack 备份文件建立索引, 并删除备份已被清理的索引;
+// 开启 Compress 时 lumberjack 在后台压缩, 原文件仍在时 .gz 尚未写完, 以原文件建立索引,
+// 压缩完成后索引的内容大小与 .gz 记录的解压大小不一致时重建
+func (rr *RollRule) indexBackups() {
+	backup := regexp.MustCompile(`^` + regexp.QuoteMeta(rr.Filename) +
+		`-\d{4}-\d{2}-\d{2}T\d{2}-\d{2}-\d{2}\.\d{3}\.log(\.gz)?$`)
+	matches, err := filepath.Glob(path.Join(rr.Filepath, rr.Filename+"-*"))
+	if err != nil {
+		return
+	}
+	var orphans []string
+	for _, file := range matches {
+		if filepath.Ext(file) == index.Ext {
+			orphans = append(orphans, file)
+			continue
+		}
+		if !backup.MatchString(filepath.Base(file)) {
+			continue
+		}
+		if filepath.Ext(file) == ".gz" {
+			if exists(file[:len(file)-len(".gz")]) || gzipIndexed(file) {
+				continue
+			}
+			rr.buildIndex(file)
+			continue
+		}
+		if _, err := os.Stat(index.Path(file)); os.IsNotExist(err) {
+			rr.buildIndex(file)
+		}
+	}
+	for _, idx := range orphans {
+		file := idx[:len(idx)-len(index.Ext)]
+		if !exists(file) && !exists(file+".gz") {
+			os.Remove(idx)
+		}
+	}
+}
+
+// .gz 文件的索引是否完整, 由不完整内容建立的索引与 gzip 记录的解压大小不一致
+func gzipIndexed(file string) bool {
+	ix, err := index.Open(file)
+	return err == nil && ix.Matches(file)
+}
+
+func exists(file string) bool {
+	_, err := os.Stat(file)
+	return err == nil
+}
+
+// lumberjack 没有切割回调, 按写入量推算切割时机 (含打开已有文件时的切割), 切割后计入切割次数,
+// 设置了索引规则时为备份文件建立索引; 其他进程切割或删除文件时无法感知,
+// 这些备份在下一次切割时补建索引, 也可以用 joker index 建立
+type indexedWriter struct {
+	*lumberjack.Logger
+	rr *RollRule
+
+	mu   sync.Mutex
+	size int64 // 当前文件大小, -1 表示尚未读取
+}
+
+func newIndexedWriter(lj *lumberjack.Logger, rr *RollRule) *indexedWriter {
+	return &indexedWriter{Logger: lj, rr: rr, size: -1}
+}
+
+func (w *indexedWriter) max() int64 {
+	if w.MaxSize == 0 {
+		// 与 lumberjack 的默认值一致
+		return 100 * 1024 * 1024
+	}
+	return int64(w.MaxSize) * 1024 * 1024
+}
+
+func (w *indexedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	if w.size < 0 {
+		w.size = 0
+		if fi, err := os.Stat(w.Filename); err == nil {
+			w.size = fi.Size()
+		}
+	}
+	rotated := w.size > 0 && w.size+int64(len(p)) > w.max()
+	n, err := w.Logger.Write(p)
+	if rotated {
+		w.size = int64(n)
+	} else {
+		w.size += int64(n)
+	}
+	w.mu.Unlock()
+	if rotated && err == nil {
+		w.afterRotate()
+	}
+	return n, err
+}
+
+// 主动切割, 同样计入切割次数并建立索引
+func (w *indexedWriter) Rotate() error {
+	w.mu.Lock()
+	err := w.Logger.Rotate()
+	w.size = 0
+	w.mu.Unlock()
+	if err == nil {
+		w.afterRotate()
+	}
+	return err
+}
+
+func (w *indexedWriter) afterRotate() {
+	metrics.rotated(w.rr.Filename)
+	if w.rr.Index != nil {
+		go w.rr.indexBackups()
+	}
+}
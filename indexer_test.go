@@ -0,0 +1,130 @@
+package logging
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/braveghost/joker/index"
+	"github.com/braveghost/meteor/mode"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// 大小切割后为备份文件建立索引, 清理备份已删除的索引
+func TestIndexOnRotation(t *testing.T) {
+	dir := t.TempDir()
+	orphan := filepath.Join(dir, "sz-2020-01-01T00-00-00.000.log.idx")
+	ioutil.WriteFile(orphan, []byte("x"), 0644)
+
+	reg := NewRegistry()
+	defer reg.Close()
+	reg.SetTraceIdKey("tid")
+	err := reg.NewLogger(&Options{
+		Path: dir, FileName: "sz", Mode: mode.ModePro,
+		OutRr: &RollRule{RotationType: RotationSize, MaxSize: 1, MaxBackups: 3, Index: &IndexRule{}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lg := reg.Logger("sz")
+	pad := strings.Repeat("x", 200)
+	for i := 0; i < 6000; i++ {
+		lg.Infow(pad, "tid", "first")
+	}
+	lg.Infow("after", "tid", "second")
+
+	var backups []string
+	for deadline := time.Now().Add(3 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		backups, _ = filepath.Glob(filepath.Join(dir, "sz-*.log"+index.Ext))
+		if len(backups) == 1 && !exists(orphan) {
+			break
+		}
+	}
+	if len(backups) != 1 || exists(orphan) {
+		t.Fatalf("indexes %v, orphan kept %v", backups, exists(orphan))
+	}
+	ix, err := index.Open(strings.TrimSuffix(backups[0], index.Ext))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ix.TraceKey() != "tid" || !ix.MayContain("first") || ix.MayContain("second") {
+		t.Fatalf("index key %s", ix.TraceKey())
+	}
+}
+
+// 开启压缩时索引对应完整的 .gz 内容, 由不完整内容建立的索引在下次检查时重建
+func TestIndexOnRotationCompress(t *testing.T) {
+	dir := t.TempDir()
+	reg := NewRegistry()
+	defer reg.Close()
+	reg.SetTraceIdKey("tid")
+	rr := &RollRule{RotationType: RotationSize, MaxSize: 1, MaxBackups: 3, Compress: true, Index: &IndexRule{}}
+	err := reg.NewLogger(&Options{Path: dir, FileName: "gz", Mode: mode.ModePro, OutRr: rr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lg := reg.Logger("gz")
+	pad := strings.Repeat("x", 200)
+	for i := 0; i < 6000; i++ {
+		lg.Infow(pad, "tid", "first")
+	}
+	lg.Infow("after", "tid", "second")
+
+	var gz []string
+	var ix *index.Index
+	for deadline := time.Now().Add(3 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		gz, _ = filepath.Glob(filepath.Join(dir, "gz-*.log.gz"))
+		if len(gz) == 1 && !exists(strings.TrimSuffix(gz[0], ".gz")) {
+			if ix, err = index.Open(gz[0]); err == nil {
+				break
+			}
+		}
+	}
+	if ix == nil {
+		t.Fatalf("backups %v, index %v", gz, err)
+	}
+	if !gzipIndexed(gz[0]) || !ix.MayContain("first") || ix.MayContain("second") {
+		t.Fatalf("index size %d", ix.Size())
+	}
+	full := ix.Size()
+
+	// 模拟压缩未完成时读到部分内容建立的索引
+	plain := strings.TrimSuffix(gz[0], ".gz")
+	ioutil.WriteFile(plain, []byte(pad+"\n"), 0644)
+	if err := index.Build(plain, index.Options{TraceKey: "tid"}); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(plain)
+	if gzipIndexed(gz[0]) {
+		t.Fatal("partial index should be detected")
+	}
+	(&RollRule{Filepath: dir, Filename: "gz", Index: &IndexRule{}, traceKey: "tid"}).indexBackups()
+	if ix, err = index.Open(gz[0]); err != nil || ix.Size() != full {
+		t.Fatalf("rebuilt index %v %v, want size %d", ix, err, full)
+	}
+}
+
+// 主动切割同样为备份文件建立索引
+func TestIndexOnManualRotate(t *testing.T) {
+	dir := t.TempDir()
+	rr := &RollRule{Filepath: dir, Filename: "mr", Index: &IndexRule{}, traceKey: "tid"}
+	w := newIndexedWriter(&lumberjack.Logger{Filename: rr.fullName()}, rr)
+	defer w.Close()
+	w.Write([]byte(`{"time":"2026-10-17T10:00:00.0000","tid":"t1"}` + "\n"))
+	if err := w.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	var idx []string
+	for deadline := time.Now().Add(3 * time.Second); len(idx) == 0 && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		idx, _ = filepath.Glob(filepath.Join(dir, "mr-*.log"+index.Ext))
+	}
+	if len(idx) != 1 {
+		t.Fatalf("indexes %v", idx)
+	}
+	if ix, err := index.Open(strings.TrimSuffix(idx[0], index.Ext)); err != nil || !ix.MayContain("t1") {
+		t.Fatalf("index %v", err)
+	}
+}
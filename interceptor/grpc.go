@@ -0,0 +1,85 @@
+// gRPC 服务端拦截器, 从 metadata 读取 trace id 和 debug 签名写入 context
+package interceptor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	logging "github.com/braveghost/joker"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// 一元调用拦截器, lg 为 nil 时使用默认日志对象
+func UnaryServer(lg *logging.Logging) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx = prepare(lg, ctx)
+		resp, err := handler(ctx, req)
+		finish(lg, ctx, err)
+		return resp, err
+	}
+}
+
+// 流式调用拦截器, lg 为 nil 时使用默认日志对象
+func StreamServer(lg *logging.Logging) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := prepare(lg, ss.Context())
+		err := handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+		finish(lg, ctx, err)
+		return err
+	}
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func prepare(lg *logging.Logging, ctx context.Context) context.Context {
+	reg := logging.DefaultRegistry()
+	if lg != nil {
+		reg = lg.Registry()
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	if reg.GetTraceId(ctx) == nil {
+		id := first(md, logging.GetTraceIdHeader())
+		if len(id) == 0 {
+			id = logging.NewTraceId()
+		}
+		ctx = reg.WithTraceId(ctx, id)
+	}
+	if logging.VerifyDebugToken(first(md, logging.GetDebugHeader()), fmt.Sprint(reg.GetTraceId(ctx))) {
+		ctx = logging.WithDebug(ctx)
+	}
+	if lg == nil {
+		logging.Begin(ctx)
+	} else {
+		lg.Begin(ctx)
+	}
+	return ctx
+}
+
+func finish(lg *logging.Logging, ctx context.Context, err error) {
+	switch {
+	case lg == nil && err != nil:
+		logging.FinishWithError(ctx)
+	case lg == nil:
+		logging.Finish(ctx)
+	case err != nil:
+		lg.FinishWithError(ctx)
+	default:
+		lg.Finish(ctx)
+	}
+}
+
+func first(md metadata.MD, key string) string {
+	if vs := md.Get(strings.ToLower(key)); len(vs) > 0 {
+		return vs[0]
+	}
+	return ""
+}
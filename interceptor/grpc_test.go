@@ -0,0 +1,173 @@
+package interceptor
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	logging "github.com/braveghost/joker"
+	"github.com/braveghost/meteor/mode"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// 输出到 observer 的扩展输出
+type observerSink struct {
+	core zapcore.Core
+}
+
+func (s *observerSink) Core(opts *logging.Options, enab zapcore.LevelEnabler) zapcore.Core {
+	return s.core
+}
+
+func (s *observerSink) Sync() error {
+	return nil
+}
+
+func (s *observerSink) Close() error {
+	return nil
+}
+
+// 开启尾部采样的日志对象, 正常结束的 trace 全部丢弃, 超过 40ms 的保留
+func newTailLogger(t *testing.T) (*logging.Logging, *observer.ObservedLogs) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	reg := logging.NewRegistry()
+	reg.SetLogPath(t.TempDir())
+	err := reg.NewLogger(&logging.Options{
+		FileName:     "rpc",
+		Mode:         mode.ModePro,
+		TailSampling: &logging.TailRule{SlowThreshold: 40 * time.Millisecond, MaxEntries: 10, MaxTraces: 10},
+		Sinks:        []logging.Sink{&observerSink{core: core}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { reg.Close() })
+	return reg.Logger("rpc"), logs
+}
+
+// 启动挂载拦截器的 health 服务, handler 替代业务处理并接收拦截器准备好的 context
+func newHealthClient(t *testing.T, lg *logging.Logging, handler func(ctx context.Context) error) grpc_health_v1.HealthClient {
+	unary := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, _ grpc.UnaryHandler) (interface{}, error) {
+		if err := handler(ctx); err != nil {
+			return nil, err
+		}
+		return &grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_SERVING}, nil
+	}
+	stream := func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, _ grpc.StreamHandler) error {
+		return handler(ss.Context())
+	}
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(UnaryServer(lg), unary),
+		grpc.ChainStreamInterceptor(StreamServer(lg), stream),
+	)
+	grpc_health_v1.RegisterHealthServer(srv, health.NewServer())
+
+	lis := bufconn.Listen(1 << 16)
+	go srv.Serve(lis)
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		srv.Stop()
+	})
+	return grpc_health_v1.NewHealthClient(conn)
+}
+
+func outgoing(traceId, token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(),
+		logging.GetTraceIdHeader(), traceId, logging.GetDebugHeader(), token)
+}
+
+func TestUnaryServerDebugToken(t *testing.T) {
+	secret := []byte("joker")
+	logging.SetDebugSecret(secret)
+	defer logging.SetDebugSecret(nil)
+
+	var (
+		traceId interface{}
+		debug   bool
+	)
+	client := newHealthClient(t, nil, func(ctx context.Context) error {
+		traceId, debug = logging.GetTraceId(ctx), logging.IsDebug(ctx)
+		return nil
+	})
+
+	token := logging.SignDebugToken(secret, "t1", time.Now().Add(time.Minute))
+	if _, err := client.Check(outgoing("t1", token), &grpc_health_v1.HealthCheckRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if traceId != "t1" || !debug {
+		t.Fatalf("signed metadata should enable debug, trace=%v debug=%v", traceId, debug)
+	}
+
+	// 令牌与 trace id 不一致, 或未传 trace id 时由拦截器生成
+	for _, tid := range []string{"t2", ""} {
+		if _, err := client.Check(outgoing(tid, token), &grpc_health_v1.HealthCheckRequest{}); err != nil {
+			t.Fatal(err)
+		}
+		if debug {
+			t.Fatalf("token must not enable debug for trace %q", tid)
+		}
+		if id, _ := traceId.(string); len(id) == 0 || (tid != "" && id != tid) {
+			t.Fatalf("unexpected trace id %v for %q", traceId, tid)
+		}
+	}
+}
+
+func TestServerTailSampling(t *testing.T) {
+	lg, logs := newTailLogger(t)
+	failed := errors.New("failed")
+	client := newHealthClient(t, lg, func(ctx context.Context) error {
+		switch logging.GetTraceId(ctx) {
+		case "slow":
+			// 第一条日志之前的耗时也计入 trace
+			time.Sleep(60 * time.Millisecond)
+		case "fail", "stream":
+			lg.Infowc("handled", ctx)
+			return failed
+		}
+		lg.Infowc("handled", ctx)
+		return nil
+	})
+
+	check := func(tid string) {
+		client.Check(outgoing(tid, ""), &grpc_health_v1.HealthCheckRequest{})
+	}
+	check("ok")
+	if logs.Len() != 0 {
+		t.Fatalf("successful call should be discarded, got %d", logs.Len())
+	}
+	check("fail")
+	if logs.Len() != 1 {
+		t.Fatalf("failed call should be flushed, got %d", logs.Len())
+	}
+	check("slow")
+	if logs.Len() != 2 {
+		t.Fatalf("slow call should be kept, got %d", logs.Len())
+	}
+
+	ws, err := client.Watch(outgoing("stream", ""), &grpc_health_v1.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ws.Recv(); err == nil {
+		t.Fatal("stream should fail")
+	}
+	if logs.Len() != 3 {
+		t.Fatalf("failed stream should be flushed, got %d", logs.Len())
+	}
+}
@@ -1,7 +1,7 @@
 package logging
 
 import (
-	"github.com/braveghost/meteor/file"
+	"fmt"
 	"github.com/braveghost/meteor/mode"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
@@ -10,7 +10,6 @@ import (
 	"log"
 	"os"
 	"path"
-	"sync"
 	"time"
 )
 
@@ -20,18 +19,6 @@ const (
 )
 
 var (
-	// initflag
-
-	initFlag bool
-
-	// traceId key
-	traceIdKey = "trace_id"
-
-	// 默认日志存放路径件相对路径
-	defaultLoggerPath     = ""
-	defaultLoggerFileName = "joker"
-	defaultServiceName    string
-
 	defaultEncoderConfig = &zapcore.EncoderConfig{
 		TimeKey:        "time",
 		LevelKey:       "level",
@@ -46,135 +33,130 @@ var (
 		EncodeCaller:   zapcore.ShortCallerEncoder, // 全路径编码器
 		EncodeName:     zapcore.FullNameEncoder,
 	}
-
-	loggers = map[string]*Logging{}
-
-	skip          = 1
-	defaultLogger *Logging
-	traceOnce     sync.Once
-	pathOnce      sync.Once
 )
 
 var (
-	LogPathError    = errors.New("log path error")
-	LoggerInitError = errors.New("logger init error")
+	LogPathError        = errors.New("log path error")
+	LoggerInitError     = errors.New("logger init error")
+	LoggerNotFoundError = errors.New("logger not found")
 )
 
 func MilliSecondTimeEncoder(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
 	enc.AppendString(t.Format("2006-01-02T15:04:05.0000"))
 }
 
-func init() {
-	// 自动设置当前项目路径为日志路径
-	InitLogger(mode.ModeLocal)
-	initFlag = true
-}
-
 func SetServiceName(name string) {
-	defaultServiceName = name
+	defaultRegistry.SetServiceName(name)
 }
 
 func SetLogName(name string) {
-	defaultLoggerFileName = name
+	defaultRegistry.SetLogName(name)
 }
 
 func SetTraceIdKey(key string) {
-	traceOnce.Do(func() {
-		traceIdKey = key
-	})
-
+	defaultRegistry.SetTraceIdKey(key)
 }
 
 // 根据环境变量设置日志文件存放路径
 func SetLogPathByEnv() {
-	pt := os.Getenv(envKeyLogPath)
-	if pt != "" {
-		SetLogPath(path.Join(pt, defaultLoggerPath))
-	}
-
+	defaultRegistry.SetLogPathByEnv()
 }
 
 // 默认设置日志文件存放路径
 func SetLogPathAuto() {
-	pt, _ := os.Getwd()
-	SetLogPath(path.Join(pt, defaultLoggerPath))
-
+	defaultRegistry.SetLogPathAuto()
 }
 
 const setLogPathLogMsg = "Logging.SetLogPathAuto.DirNotExistCreate.Error || path=%s | err=%s"
 
 // 手动设置固定路径
 func SetLogPath(pt string) {
-	pathOnce.Do(func() {
-		if len(pt) == 0 {
-			return
-		}
-		defaultLoggerPath = pt
-		if !file.DirNotExistCreate(defaultLoggerPath) {
-			log.Panicf(setLogPathLogMsg, defaultLoggerPath, LogPathError.Error())
-		}
-
-	})
+	defaultRegistry.SetLogPath(pt)
 }
 
 // 获取默认日志对象
 func Logger(name string) *Logging {
-	if lg, ok := loggers[name]; ok {
-		return lg
-	}
-	return &Logging{}
+	return defaultRegistry.Logger(name)
+}
+
+// 获取命名日志对象, 不存在时按模板创建, 无模板或创建失败时返回错误
+func GetLogger(name string) (*Logging, error) {
+	return defaultRegistry.GetLogger(name)
+}
+
+// 设置命名日志模板, Logger 获取不存在的日志时按模板创建
+func SetLoggerTemplate(opts *Options) {
+	defaultRegistry.SetTemplate(opts)
+}
+
+// 开启严格模式, 命名日志不存在且无法创建时 Logger 直接 panic
+func SetStrictLogger(strict bool) {
+	defaultRegistry.SetStrict(strict)
+}
+
+// 按名称设置级别, 对该名称及其子日志生效
+func SetLevel(name string, lvl zapcore.Level) {
+	defaultRegistry.SetLevel(name, lvl)
+}
+
+// 取消名称级别
+func ResetLevel(name string) {
+	defaultRegistry.ResetLevel(name)
 }
 
 const newLoggerPathLogMsg = "GetLogger.VerifyLogPath.Error || path=%s | name=%s |err=%s\n"
 
 // 初始化日志对象对象
 func NewLogger(conf *Options) error {
-	// 确定路径
-	//if !file.IsDir(conf.Path) {
-	//	log.Printf(newLoggerPathLogMsg, conf.Path, conf.FileName, LogPathError.Error())
-	//	return LogPathError
-	//}
-	tmp := &Logging{
-		opts: conf,
-	}
-	tmp.initLogger()
-	if !tmp.status {
-		return LoggerInitError
-	}
-	loggers[conf.FileName] = tmp
-	return nil
+	return defaultRegistry.NewLogger(conf)
 }
 
 // 初始化 default logger
 func InitLogger(md mode.ModeType) {
-	skip = 2
-	defaultLogger = &Logging{
-		opts: &Options{
-			ServiceName: defaultServiceName,
-			FileName:    defaultLoggerFileName,
-			Path:        defaultLoggerPath,
-			Mode:        md,
-			OutRr:       GetDefaultRollRule(defaultLoggerFileName),
-			ErrRr:       GetDefaultErrRollRule(defaultLoggerFileName + "_error"),
-		},
-	}
-	defaultLogger.initLogger()
+	defaultRegistry.InitLogger(md)
 }
 
 // 从 context 获取request id
 func GetTraceId(ctx context.Context) interface{} {
-	return ctx.Value(traceIdKey)
+	return defaultRegistry.GetTraceId(ctx)
+}
+
+func SetSpanIdKey(key string) {
+	defaultRegistry.SetSpanIdKey(key)
+}
+
+// 从 context 获取 span id
+func GetSpanId(ctx context.Context) interface{} {
+	return defaultRegistry.GetSpanId(ctx)
+}
+
+// *wc 方法追加 trace id, 存在 span id 时一并追加;
+// 级别未开启时直接返回, 追加时复制到新切片, 不修改调用方的切片
+func (lg *Logging) appendTrace(ctx context.Context, lvl zapcore.Level, keysAndValues []interface{}) []interface{} {
+	if lg.traced {
+		return keysAndValues
+	}
+	if base := lg.zapLogger(ctx); base != nil && !base.Core().Enabled(lvl) {
+		return keysAndValues
+	}
+	reg := lg.registry()
+	out := make([]interface{}, len(keysAndValues), len(keysAndValues)+4)
+	copy(out, keysAndValues)
+	out = append(out, reg.traceIdKey, reg.GetTraceId(ctx))
+	if span := reg.GetSpanId(ctx); span != nil {
+		out = append(out, reg.SpanIdKey(), span)
+	}
+	return out
 }
 
 type encoderOption func(*zapcore.EncoderConfig)
 
 var (
-	_FlagOpenColor bool
 	_FlagLowercase bool
 )
 
 func OpenColor() {
-	_FlagOpenColor = true
+	defaultRegistry.OpenColor()
 }
 
 type timeLayout string
@@ -221,32 +203,66 @@ type Options struct {
 	ErrRr  *RollRule
 	Fields []zap.Field // 扩展输出字段
 
+	TailSampling *TailRule       // 尾部采样规则, nil 表示不开启
+	Sinks        []Sink          // 扩展输出, 与文件输出并列
+	Digest       *DigestRule     // 错误汇总规则, nil 表示不开启
+	ErrorFields  *ErrorFieldRule // 键值对中 error 的展开规则, nil 表示只输出错误消息
+	Recover      *RecoverRule    // panic 恢复规则, nil 时使用默认规则
+	CallerSkip   int             // 调用方自行包装日志方法时额外跳过的调用栈层数
+	StrictKV     bool            // 严格校验键值对, ModeLocal 下 panic, 其他模式输出自诊断日志
+
 	encoder   []encoderOption
 	OpenColor bool
 	Lowercase bool
+
+	reg *Registry // 所属注册表, 由注册表在初始化时设置
+}
+
+// 所属注册表, 未设置时为默认注册表
+func (lc Options) registry() *Registry {
+	if lc.reg != nil {
+		return lc.reg
+	}
+	return defaultRegistry
 }
 
 func (lc Options) GetPath() string {
 	if len(lc.Path) == 0 {
-		return defaultLoggerPath
+		return lc.registry().logPath()
 	}
 	return lc.Path
 }
 
 func (lc Options) GetName() string {
 	if len(lc.FileName) == 0 {
-		return defaultLoggerFileName
+		return lc.registry().logName()
 	}
 	return lc.FileName
 }
 
 func (lc Options) GetErrorName() string {
 	if len(lc.FileName) == 0 {
-		return defaultLoggerFileName + "_error"
+		return lc.registry().logName() + "_error"
 	}
 	return lc.FileName + "_error"
 }
 
+// 以模板复制出命名日志的配置, 切割规则和扩展字段单独复制, 避免日志之间相互修改
+func (lc Options) forName(name string) *Options {
+	lc.FileName = name
+	lc.reg = nil
+	if lc.OutRr != nil {
+		rr := *lc.OutRr
+		lc.OutRr = &rr
+	}
+	if lc.ErrRr != nil {
+		rr := *lc.ErrRr
+		lc.ErrRr = &rr
+	}
+	lc.Fields = append([]zap.Field(nil), lc.Fields...)
+	return &lc
+}
+
 func (lc Options) ExtendField() []zap.Field {
 	if len(lc.ServiceName) == 0 {
 		return lc.Fields
@@ -254,11 +270,51 @@ func (lc Options) ExtendField() []zap.Field {
 	return append(lc.Fields, zap.String("service_name", lc.ServiceName))
 }
 
+// 文件输出使用的编码配置, 未设置时为默认配置
+func (lc Options) GetEncoderConfig() zapcore.EncoderConfig {
+	if lc.EncoderConfig == nil {
+		return *defaultEncoderConfig
+	}
+	return *lc.EncoderConfig
+}
+
 type Logging struct {
 	logger *zap.SugaredLogger
 	status bool
 	opts   *Options
 	level  zapcore.Level
+	tail   *tailBuffer
+	digest *errorDigest
+	reg    *Registry
+	name   string // 子日志的完整名称, 如 order.payment
+	traced bool   // 已通过 WithContext 附加 trace id
+	strict bool   // 严格校验键值对
+
+	withKeys []string // With 附加的键, 严格模式下不能再次使用
+	skip     int      // 包级函数包装的层数, 自诊断日志的调用栈多跳过这些层
+
+	// 单次请求提升到 debug 级别时使用, 仅在默认级别高于 debug 时存在
+	debugLogger *zap.SugaredLogger
+
+	// 强类型字段方法使用, 与 logger 和 debugLogger 对应
+	base      *zap.Logger
+	debugBase *zap.Logger
+
+	// 包级函数使用, 调用栈比直接调用多跳过一层
+	outer *Logging
+}
+
+// 所属注册表, 未设置时为默认注册表
+func (lg *Logging) registry() *Registry {
+	if lg.reg != nil {
+		return lg.reg
+	}
+	return defaultRegistry
+}
+
+// 所属注册表
+func (lg *Logging) Registry() *Registry {
+	return lg.registry()
 }
 
 // 根据 mode 设置日志输出等级
@@ -278,8 +334,11 @@ func (lg *Logging) initLogger() {
 		encoderConfig = defaultEncoderConfig
 	}
 
-	if _FlagOpenColor {
-		encoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	if lg.registry().colored() {
+		// 复制后修改, 不影响共享的编码配置
+		ec := *encoderConfig
+		ec.EncodeLevel = zapcore.CapitalColorLevelEncoder
+		encoderConfig = &ec
 	}
 
 	var (
@@ -287,47 +346,85 @@ func (lg *Logging) initLogger() {
 		errCore zapcore.Core
 	)
 
-	cores = append(cores, lg.getOutputCore(encoderConfig))
+	outWriter := lg.getOutputWriter()
+	cores = append(cores, lg.getOutputCore(encoderConfig, outWriter, lg.level))
 
 	errCore = lg.getErrorCore(encoderConfig)
 	if errCore != nil {
 		cores = append(cores, errCore)
 	}
 
-	tee := zapcore.NewTee(cores...)
+	for _, sk := range lg.opts.Sinks {
+		cores = append(cores, sk.Core(lg.opts, zap.NewAtomicLevelAt(lg.level)))
+	}
+
+	if lg.opts.Digest != nil {
+		// 按指纹统计错误, 定期输出汇总
+		lg.digest = newErrorDigest(lg.opts.GetName(), lg.registry().traceIdKey, lg.opts.Digest, lg.emitDigest)
+		cores = append(cores, &digestCore{digest: lg.digest})
+	}
+
+	if lg.opts.TailSampling != nil {
+		// 按 trace 缓存日志, 结束时决定是否输出
+		lg.tail = newTailBuffer(lg.opts.GetName(), lg.registry().traceIdKey, lg.opts.TailSampling)
+	}
 
-	// 构造日志
-	lg.logger = zap.New(tee).WithOptions( // 开启堆栈跟踪
+	var debugTee zapcore.Core
+	if lg.level > zapcore.DebugLevel {
+		// 单次请求提升到 debug 时使用, 与普通日志共享输出
+		debugCores := append([]zapcore.Core{
+			lg.getOutputCore(encoderConfig, outWriter, zapcore.DebugLevel),
+		}, cores[1:]...)
+		debugTee = zapcore.NewTee(debugCores...)
+		lg.debugLogger = lg.newSugar(debugTee)
+	}
+
+	// 构造日志, 按名称设置的级别由注册表决定
+	lg.logger = lg.newSugar(newNameLevelCore(zapcore.NewTee(cores...), debugTee, lg.registry(), lg.opts.GetName()))
+	lg.strict = lg.opts.StrictKV
+	lg.derive()
+	lg.status = true
+}
+
+func (lg *Logging) newSugar(tee zapcore.Core) *zap.SugaredLogger {
+	if lg.opts.ErrorFields != nil {
+		rule := lg.opts.ErrorFields.withDefaults()
+		tee = rule.wrap(tee)
+	}
+	if lg.tail != nil {
+		tee = lg.tail.wrap(tee)
+	}
+	return zap.New(tee).WithOptions( // 开启堆栈跟踪
 		zap.AddCaller(),
-		// 因为 operate 包装了一层所以堆栈信息加1
-		zap.AddCallerSkip(skip),
+		// Logging 的方法包装了一层所以堆栈信息加1, 包级函数使用的日志对象在派生时再加1
+		zap.AddCallerSkip(1+lg.opts.CallerSkip),
 		// 开启文件及行号
 		//zap.Development(),
 		// 设置初始化字段
 		zap.Fields(lg.opts.ExtendField()...),
-		zap.ErrorOutput(zapcore.AddSync(os.Stderr)) ).Sugar()
-	lg.status = true
+		// Fatal 之后先关闭所有日志再退出
+		zap.WithFatalHook(fatalHook{}),
+		zap.ErrorOutput(zapcore.AddSync(os.Stderr))).Sugar()
 }
 
-func (lg *Logging) getOutputCore(encoderConfig *zapcore.EncoderConfig) zapcore.Core {
-
-	outRr := lg.opts.OutRr
-
-	if outRr == nil {
-		// 兜底配置
-		outRr = &defaultRollRule
+func (lg *Logging) getOutputWriter() zapcore.WriteSyncer {
 
+	// 在副本上设置路径和文件名, 不修改调用方和其他日志共用的规则
+	rule := defaultRollRule
+	if lg.opts.OutRr != nil {
+		rule = *lg.opts.OutRr
 	}
+	outRr := &rule
 
 	outRr.Filepath = lg.opts.GetPath()
 	outRr.Filename = lg.opts.GetName()
-	// 设置日志级别
+	outRr.traceKey = lg.registry().traceIdKey
 
 	var (
 		outHook   zapcore.WriteSyncer
 		outWriter []zapcore.WriteSyncer
 	)
-	if initFlag {
+	if lg.registry().initFlag {
 		outHook = getOutHook(outRr)
 		if outHook != nil {
 			outWriter = append(outWriter, outHook)
@@ -338,30 +435,36 @@ func (lg *Logging) getOutputCore(encoderConfig *zapcore.EncoderConfig) zapcore.C
 		// 打印到控制台和文件
 		outWriter = append(outWriter, zapcore.AddSync(os.Stdout))
 	}
-	return zapcore.NewCore(
+	return zapcore.NewMultiWriteSyncer(outWriter...)
+}
+
+func (lg *Logging) getOutputCore(encoderConfig *zapcore.EncoderConfig, writer zapcore.WriteSyncer, level zapcore.Level) zapcore.Core {
+	return newMeteredCore(
+		lg.opts.GetName(), true,
 		zapcore.NewConsoleEncoder(*encoderConfig), // 编码器配置
-		zapcore.NewMultiWriteSyncer(outWriter...),
-		zap.NewAtomicLevelAt(lg.level), // 日志级别
+		writer,
+		zap.NewAtomicLevelAt(level), // 日志级别
 	)
 }
 
 // 生成错误日志引擎
 func (lg *Logging) getErrorCore(encoderConfig *zapcore.EncoderConfig) zapcore.Core {
-	errRr := lg.opts.ErrRr
-
-	if errRr != nil {
+	if lg.opts.ErrRr != nil {
 		// 无默认, 错误日志规则传入 nil 表示不独立写错误日志文件
+		rule := *lg.opts.ErrRr
+		errRr := &rule
 		errRr.Filepath = lg.opts.GetPath()
 		if len(errRr.Filepath) == 0 {
 			return nil
 		}
 		errRr.Filename = lg.opts.GetErrorName()
+		errRr.traceKey = lg.registry().traceIdKey
 
 		var (
 			errWriter []zapcore.WriteSyncer
 			errHook   zapcore.WriteSyncer
 		)
-		if initFlag {
+		if lg.registry().initFlag {
 			errHook = getErrHook(errRr)
 
 			if errHook != nil {
@@ -373,7 +476,8 @@ func (lg *Logging) getErrorCore(encoderConfig *zapcore.EncoderConfig) zapcore.Co
 			// 打印到控制台和文件
 			errWriter = append(errWriter, zapcore.AddSync(os.Stdout))
 		}
-		return zapcore.NewCore(
+		return newMeteredCore(
+			lg.opts.GetName(), false,
 			zapcore.NewConsoleEncoder(*encoderConfig), // 编码器配置
 			zapcore.NewMultiWriteSyncer(errWriter...),
 			zap.NewAtomicLevelAt(zap.ErrorLevel), // 日志级别
@@ -382,132 +486,154 @@ func (lg *Logging) getErrorCore(encoderConfig *zapcore.EncoderConfig) zapcore.Co
 	return nil
 }
 
+// 日志配置的副本
+func (lg *Logging) Options() Options {
+	return *lg.opts
+}
+
 func (lg *Logging) FullPath() string {
 	return path.Join(lg.opts.Path, lg.opts.FileName)
 }
-func (lg *Logging) loggerStatus(args ...interface{}) bool {
-	status := lg.status
-	if !status {
-		args = append([]interface{}{"GetLoggerIsNull"}, args...)
-		log.Println(args...)
-	}
-	return status
+
+// 日志对象不可用时输出到标准日志, 只在失败时执行, 不影响正常调用
+func nullLog(args []interface{}) {
+	log.Print("GetLoggerIsNull " + fmt.Sprintln(args...))
 }
-func (lg *Logging) loggerStatusMsg(msg string, args ...interface{}) bool {
-	status := lg.status
-	if !status {
-		args = append([]interface{}{"GetLoggerIsNull", msg}, args...)
-		log.Println(args...)
-	}
-	return status
+
+func nullLogMsg(msg string, args []interface{}) {
+	log.Print("GetLoggerIsNull " + msg + " " + fmt.Sprintln(args...))
 }
-func (lg *Logging) loggerStatusFormat(format string, args ...interface{}) bool {
-	status := lg.status
-	if !status {
-		args = append([]interface{}{"GetLoggerIsNull"}, args...)
-		log.Printf(format, args...)
-	}
-	return status
+
+func nullLogFormat(format string, args []interface{}) {
+	log.Printf("GetLoggerIsNull "+format, args...)
 }
 
 // Debug uses fmt.Sprint to construct and log a message.
 func (lg *Logging) Debug(args ...interface{}) {
-	if lg.loggerStatus(args...) {
-		lg.logger.Debug(args...)
+	if !lg.status {
+		nullLog(args)
+		return
 	}
+	lg.logger.Debug(args...)
 }
 
 // Info uses fmt.Sprint to construct and log a message.
 func (lg *Logging) Info(args ...interface{}) {
-	if lg.loggerStatus(args...) {
-		lg.logger.Info(args...)
+	if !lg.status {
+		nullLog(args)
+		return
 	}
+	lg.logger.Info(args...)
 }
 
 // Warn uses fmt.Sprint to construct and log a message.
 func (lg *Logging) Warn(args ...interface{}) {
-	if lg.loggerStatus(args...) {
-		lg.logger.Warn(args...)
+	if !lg.status {
+		nullLog(args)
+		return
 	}
+	lg.logger.Warn(args...)
 }
 
 // Error uses fmt.Sprint to construct and log a message.
 func (lg *Logging) Error(args ...interface{}) {
-	if lg.loggerStatus(args...) {
-		lg.logger.Error(args...)
+	if !lg.status {
+		nullLog(args)
+		return
 	}
+	lg.logger.Error(args...)
 }
 
 // DPanic uses fmt.Sprint to construct and log a message. In development, the
 // logger then panics. (See DPanicLevel for details.)
 func (lg *Logging) DPanic(args ...interface{}) {
-	if lg.loggerStatus(args...) {
-		lg.logger.DPanic(args...)
+	if !lg.status {
+		nullLog(args)
+		return
 	}
+	lg.logger.DPanic(args...)
 }
 
 // Panic uses fmt.Sprint to construct and log a message, then panics.
 func (lg *Logging) Panic(args ...interface{}) {
-	if lg.loggerStatus(args...) {
-		lg.logger.Panic(args...)
+	if !lg.status {
+		nullLog(args)
+		return
 	}
+	lg.logger.Panic(args...)
 }
 
 // Fatal uses fmt.Sprint to construct and log a message, then calls os.Exit.
 func (lg *Logging) Fatal(args ...interface{}) {
-	if lg.loggerStatus(args...) {
-		lg.logger.Fatal(args...)
+	if !lg.status {
+		nullLog(args)
+		return
 	}
+	lg.logger.Fatal(args...)
 }
 
 // Debugf uses fmt.Sprintf to log a templated message.
 func (lg *Logging) Debugf(template string, args ...interface{}) {
-	if lg.loggerStatusFormat(template, args...) {
-		lg.logger.Debugf(template, args...)
+	if !lg.status {
+		nullLogFormat(template, args)
+		return
 	}
+	lg.logger.Debugf(template, args...)
 }
 
 // Infof uses fmt.Sprintf to log a templated message.
 func (lg *Logging) Infof(template string, args ...interface{}) {
-	if lg.loggerStatusFormat(template, args...) {
-		lg.logger.Infof(template, args...)
+	if !lg.status {
+		nullLogFormat(template, args)
+		return
 	}
+	lg.logger.Infof(template, args...)
 }
 
 // Warnf uses fmt.Sprintf to log a templated message.
 func (lg *Logging) Warnf(template string, args ...interface{}) {
-	if lg.loggerStatusFormat(template, args...) {
-		lg.logger.Warnf(template, args...)
+	if !lg.status {
+		nullLogFormat(template, args)
+		return
 	}
+	lg.logger.Warnf(template, args...)
 }
 
 // Errorf uses fmt.Sprintf to log a templated message.
 func (lg *Logging) Errorf(template string, args ...interface{}) {
-	if lg.loggerStatusFormat(template, args...) {
-		lg.logger.Errorf(template, args...)
+	if !lg.status {
+		nullLogFormat(template, args)
+		return
 	}
+	lg.logger.Errorf(template, args...)
 }
 
 // DPanicf uses fmt.Sprintf to log a templated message. In development, the
 // logger then panics. (See DPanicLevel for details.)
 func (lg *Logging) DPanicf(template string, args ...interface{}) {
-	if lg.loggerStatusFormat(template, args...) {
-		lg.logger.DPanicf(template, args...)
+	if !lg.status {
+		nullLogFormat(template, args)
+		return
 	}
+	lg.logger.DPanicf(template, args...)
 }
 
 // Panicf uses fmt.Sprintf to log a templated message, then panics.
 func (lg *Logging) Panicf(template string, args ...interface{}) {
-	if lg.loggerStatusFormat(template, args...) {
-		lg.logger.Panicf(template, args...)
+	if !lg.status {
+		nullLogFormat(template, args)
+		return
 	}
+	lg.logger.Panicf(template, args...)
 }
 
 // Fatalf uses fmt.Sprintf to log a templated message, then calls os.Exit.
 func (lg *Logging) Fatalf(template string, args ...interface{}) {
-	if lg.loggerStatusFormat(template, args...) {
-		lg.logger.Fatalf(template, args...)
+	if !lg.status {
+		nullLogFormat(template, args)
+		return
 	}
+	lg.logger.Fatalf(template, args...)
 }
 
 // Debugw logs a message with some additional context. The variadic key-value
@@ -516,58 +642,93 @@ func (lg *Logging) Fatalf(template string, args ...interface{}) {
 // When debug-level logging is disabled, this is much faster than
 //  s.With(keysAndValues).Debug(msg)
 func (lg *Logging) Debugw(msg string, keysAndValues ...interface{}) {
-	if lg.loggerStatusMsg(msg, keysAndValues...) {
-		lg.logger.Debugw(msg, keysAndValues...)
+	if !lg.status {
+		nullLogMsg(msg, keysAndValues)
+		return
+	}
+	if lg.strictEnabled(nil, zapcore.DebugLevel) {
+		lg.validateKV("Debugw", msg, keysAndValues, false)
 	}
+	lg.logger.Debugw(msg, keysAndValues...)
 }
 
 // Infow logs a message with some additional context. The variadic key-value
 // pairs are treated as they are in With.
 func (lg *Logging) Infow(msg string, keysAndValues ...interface{}) {
-	if lg.loggerStatusMsg(msg, keysAndValues...) {
-		lg.logger.Infow(msg, keysAndValues...)
+	if !lg.status {
+		nullLogMsg(msg, keysAndValues)
+		return
+	}
+	if lg.strictEnabled(nil, zapcore.InfoLevel) {
+		lg.validateKV("Infow", msg, keysAndValues, false)
 	}
+	lg.logger.Infow(msg, keysAndValues...)
 }
 
 // Warnw logs a message with some additional context. The variadic key-value
 // pairs are treated as they are in With.
 func (lg *Logging) Warnw(msg string, keysAndValues ...interface{}) {
-	if lg.loggerStatusMsg(msg, keysAndValues...) {
-		lg.logger.Warnw(msg, keysAndValues...)
+	if !lg.status {
+		nullLogMsg(msg, keysAndValues)
+		return
 	}
+	if lg.strictEnabled(nil, zapcore.WarnLevel) {
+		lg.validateKV("Warnw", msg, keysAndValues, false)
+	}
+	lg.logger.Warnw(msg, keysAndValues...)
 }
 
 // Errorw logs a message with some additional context. The variadic key-value
 // pairs are treated as they are in With.
 func (lg *Logging) Errorw(msg string, keysAndValues ...interface{}) {
-	if lg.loggerStatusMsg(msg, keysAndValues...) {
-		lg.logger.Errorw(msg, keysAndValues...)
+	if !lg.status {
+		nullLogMsg(msg, keysAndValues)
+		return
+	}
+	if lg.strictEnabled(nil, zapcore.ErrorLevel) {
+		lg.validateKV("Errorw", msg, keysAndValues, false)
 	}
+	lg.logger.Errorw(msg, keysAndValues...)
 }
 
 // DPanicw logs a message with some additional context. In development, the
 // logger then panics. (See DPanicLevel for details.) The variadic key-value
 // pairs are treated as they are in With.
 func (lg *Logging) DPanicw(msg string, keysAndValues ...interface{}) {
-	if lg.loggerStatusMsg(msg, keysAndValues...) {
-		lg.logger.DPanicw(msg, keysAndValues...)
+	if !lg.status {
+		nullLogMsg(msg, keysAndValues)
+		return
+	}
+	if lg.strictEnabled(nil, zapcore.DPanicLevel) {
+		lg.validateKV("DPanicw", msg, keysAndValues, false)
 	}
+	lg.logger.DPanicw(msg, keysAndValues...)
 }
 
 // Panicw logs a message with some additional context, then panics. The
 // variadic key-value pairs are treated as they are in With.
 func (lg *Logging) Panicw(msg string, keysAndValues ...interface{}) {
-	if lg.loggerStatusMsg(msg, keysAndValues...) {
-		lg.logger.Panicw(msg, keysAndValues...)
+	if !lg.status {
+		nullLogMsg(msg, keysAndValues)
+		return
 	}
+	if lg.strictEnabled(nil, zapcore.PanicLevel) {
+		lg.validateKV("Panicw", msg, keysAndValues, false)
+	}
+	lg.logger.Panicw(msg, keysAndValues...)
 }
 
 // Fatalw logs a message with some additional context, then calls os.Exit. The
 // variadic key-value pairs are treated as they are in With.
 func (lg *Logging) Fatalw(msg string, keysAndValues ...interface{}) {
-	if lg.loggerStatusMsg(msg, keysAndValues...) {
-		lg.logger.Fatalw(msg, keysAndValues...)
+	if !lg.status {
+		nullLogMsg(msg, keysAndValues)
+		return
+	}
+	if lg.strictEnabled(nil, zapcore.FatalLevel) {
+		lg.validateKV("Fatalw", msg, keysAndValues, false)
 	}
+	lg.logger.Fatalw(msg, keysAndValues...)
 }
 
 // Debugw logs a message with some additional context. The variadic key-value
@@ -576,65 +737,93 @@ func (lg *Logging) Fatalw(msg string, keysAndValues ...interface{}) {
 // When debug-level logging is disabled, this is much faster than
 //  s.With(keysAndValues).Debug(msg)
 func (lg *Logging) Debugwc(msg string, ctx context.Context, keysAndValues ...interface{}) {
-	if lg.loggerStatusMsg(msg, keysAndValues...) {
-		keysAndValues = append(keysAndValues, traceIdKey, GetTraceId(ctx))
-		lg.logger.Debugw(msg, keysAndValues..., )
+	if !lg.status {
+		nullLogMsg(msg, keysAndValues)
+		return
+	}
+	if lg.strictEnabled(ctx, zapcore.DebugLevel) {
+		lg.validateKV("Debugwc", msg, keysAndValues, true)
 	}
+	lg.sugar(ctx).Debugw(msg, lg.appendTrace(ctx, zapcore.DebugLevel, keysAndValues)...)
 }
 
 // Infow logs a message with some additional context. The variadic key-value
 // pairs are treated as they are in With.
 func (lg *Logging) Infowc(msg string, ctx context.Context, keysAndValues ...interface{}) {
-	if lg.loggerStatusMsg(msg, keysAndValues...) {
-		keysAndValues = append(keysAndValues, traceIdKey, GetTraceId(ctx))
-		lg.logger.Infow(msg, keysAndValues...)
+	if !lg.status {
+		nullLogMsg(msg, keysAndValues)
+		return
 	}
+	if lg.strictEnabled(ctx, zapcore.InfoLevel) {
+		lg.validateKV("Infowc", msg, keysAndValues, true)
+	}
+	lg.sugar(ctx).Infow(msg, lg.appendTrace(ctx, zapcore.InfoLevel, keysAndValues)...)
 }
 
 // Warnw logs a message with some additional context. The variadic key-value
 // pairs are treated as they are in With.
 func (lg *Logging) Warnwc(msg string, ctx context.Context, keysAndValues ...interface{}) {
-	if lg.loggerStatusMsg(msg, keysAndValues...) {
-		keysAndValues = append(keysAndValues, traceIdKey, GetTraceId(ctx))
-		lg.logger.Warnw(msg, keysAndValues...)
+	if !lg.status {
+		nullLogMsg(msg, keysAndValues)
+		return
+	}
+	if lg.strictEnabled(ctx, zapcore.WarnLevel) {
+		lg.validateKV("Warnwc", msg, keysAndValues, true)
 	}
+	lg.sugar(ctx).Warnw(msg, lg.appendTrace(ctx, zapcore.WarnLevel, keysAndValues)...)
 }
 
 // Errorw logs a message with some additional context. The variadic key-value
 // pairs are treated as they are in With.
 func (lg *Logging) Errorwc(msg string, ctx context.Context, keysAndValues ...interface{}) {
-	if lg.loggerStatusMsg(msg, keysAndValues...) {
-		keysAndValues = append(keysAndValues, traceIdKey, GetTraceId(ctx))
-		lg.logger.Errorw(msg, keysAndValues...)
+	if !lg.status {
+		nullLogMsg(msg, keysAndValues)
+		return
 	}
+	if lg.strictEnabled(ctx, zapcore.ErrorLevel) {
+		lg.validateKV("Errorwc", msg, keysAndValues, true)
+	}
+	lg.sugar(ctx).Errorw(msg, lg.appendTrace(ctx, zapcore.ErrorLevel, keysAndValues)...)
 }
 
 // DPanicw logs a message with some additional context. In development, the
 // logger then panics. (See DPanicLevel for details.) The variadic key-value
 // pairs are treated as they are in With.
 func (lg *Logging) DPanicwc(msg string, ctx context.Context, keysAndValues ...interface{}) {
-	if lg.loggerStatusMsg(msg, keysAndValues...) {
-		keysAndValues = append(keysAndValues, traceIdKey, GetTraceId(ctx))
-		lg.logger.DPanicw(msg, keysAndValues...)
+	if !lg.status {
+		nullLogMsg(msg, keysAndValues)
+		return
+	}
+	if lg.strictEnabled(ctx, zapcore.DPanicLevel) {
+		lg.validateKV("DPanicwc", msg, keysAndValues, true)
 	}
+	lg.sugar(ctx).DPanicw(msg, lg.appendTrace(ctx, zapcore.DPanicLevel, keysAndValues)...)
 }
 
 // Panicw logs a message with some additional context, then panics. The
 // variadic key-value pairs are treated as they are in With.
 func (lg *Logging) Panicwc(msg string, ctx context.Context, keysAndValues ...interface{}) {
-	if lg.loggerStatusMsg(msg, keysAndValues...) {
-		keysAndValues = append(keysAndValues, traceIdKey, GetTraceId(ctx))
-		lg.logger.Panicw(msg, keysAndValues...)
+	if !lg.status {
+		nullLogMsg(msg, keysAndValues)
+		return
 	}
+	if lg.strictEnabled(ctx, zapcore.PanicLevel) {
+		lg.validateKV("Panicwc", msg, keysAndValues, true)
+	}
+	lg.sugar(ctx).Panicw(msg, lg.appendTrace(ctx, zapcore.PanicLevel, keysAndValues)...)
 }
 
 // Fatalw logs a message with some additional context, then calls os.Exit. The
 // variadic key-value pairs are treated as they are in With.
 func (lg *Logging) Fatalwc(msg string, ctx context.Context, keysAndValues ...interface{}) {
-	if lg.loggerStatusMsg(msg, keysAndValues...) {
-		keysAndValues = append(keysAndValues, traceIdKey, GetTraceId(ctx))
-		lg.logger.Fatalw(msg, keysAndValues...)
+	if !lg.status {
+		nullLogMsg(msg, keysAndValues)
+		return
+	}
+	if lg.strictEnabled(ctx, zapcore.FatalLevel) {
+		lg.validateKV("Fatalwc", msg, keysAndValues, true)
 	}
+	lg.sugar(ctx).Fatalw(msg, lg.appendTrace(ctx, zapcore.FatalLevel, keysAndValues)...)
 }
 
 func (lg *Logging) Sync() {
@@ -642,3 +831,24 @@ func (lg *Logging) Sync() {
 		lg.logger.Sync()
 	}
 }
+
+// 输出所有缓存并关闭扩展输出
+func (lg *Logging) Close() error {
+	if !lg.status {
+		return nil
+	}
+	if lg.tail != nil {
+		lg.tail.close()
+	}
+	if lg.digest != nil {
+		lg.digest.close()
+	}
+	lg.logger.Sync()
+	var err error
+	for _, sk := range lg.opts.Sinks {
+		if e := sk.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
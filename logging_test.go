@@ -8,7 +8,7 @@ import (
 
 func TestGetRequestId(t *testing.T) {
 	ct := context.Background()
-	ct = context.WithValue(ct, traceIdKey, 123)
+	ct = WithTraceId(ct, 123)
 	fmt.Println(GetTraceId(ct))
 
 	ct1 := context.Background()
@@ -0,0 +1,285 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/snappy"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type lokiEncoding int
+
+const (
+	// snappy 压缩的 protobuf, Loki 默认格式
+	LokiProtobuf lokiEncoding = iota
+	LokiJSON
+)
+
+type LokiOptions struct {
+	NetSinkOptions
+	URL         string            // push 地址, 如 http://loki:3100/loki/api/v1/push
+	TenantId    string            // 多租户时写入 X-Scope-OrgID
+	Encoding    lokiEncoding      // 请求体格式
+	LabelFields []string          // 作为标签的 Options.Fields 键
+	Labels      map[string]string // 额外的固定标签
+	Timeout     time.Duration     // 单次请求超时
+	MaxRetries  int               // 429 和 5xx 的重试次数, 仍失败时进入磁盘缓存
+	Backoff     time.Duration     // 首次重试等待
+}
+
+// Loki 输出, 标签取自 ServiceName、日志名称、级别和指定的 Options.Fields
+type LokiSink struct {
+	*NetSink
+	opts LokiOptions
+}
+
+func NewLokiSink(opts LokiOptions) (*LokiSink, error) {
+	if len(opts.Name) == 0 {
+		opts.Name = "loki"
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.Backoff == 0 {
+		opts.Backoff = 500 * time.Millisecond
+	}
+	if opts.BatchBytes == 0 {
+		opts.BatchBytes = 1 << 20
+	}
+	tr := &lokiTransport{
+		opts:      opts,
+		client:    &http.Client{Timeout: opts.Timeout},
+		httpRetry: newHTTPRetry(opts.MaxRetries, opts.Backoff, opts.NetSinkOptions),
+	}
+	ns, err := NewNetSink(tr, opts.NetSinkOptions)
+	if err != nil {
+		return nil, err
+	}
+	return &LokiSink{NetSink: ns, opts: opts}, nil
+}
+
+// 缓存和传输中的单条记录
+type lokiRecord struct {
+	Labels string `json:"labels"`
+	Ts     int64  `json:"ts"`
+	Line   string `json:"line"`
+}
+
+func (ls *LokiSink) Core(opts *Options, enab zapcore.LevelEnabler) zapcore.Core {
+	base := map[string]string{}
+	for k, v := range ls.opts.Labels {
+		base[k] = v
+	}
+	if len(opts.ServiceName) > 0 {
+		base["service"] = opts.ServiceName
+	}
+	base["logger"] = opts.GetName()
+	values := fieldsToMap(opts.Fields)
+	for _, key := range ls.opts.LabelFields {
+		if v, ok := values[key]; ok {
+			base[key] = toLabelValue(v)
+		}
+	}
+
+	// 每个级别的标签串只拼一次
+	labels := map[zapcore.Level]string{}
+	for lvl := zapcore.DebugLevel; lvl <= zapcore.FatalLevel; lvl++ {
+		base["level"] = lvl.String()
+		labels[lvl] = formatLokiLabels(base)
+	}
+
+	enc := jsonEncoder(opts)
+	return ls.newRecordCore(enab, func(ent zapcore.Entry, fields []zapcore.Field) ([]byte, error) {
+		buf, err := enc.EncodeEntry(ent, fields)
+		if err != nil {
+			return nil, err
+		}
+		line := strings.TrimSuffix(buf.String(), "\n")
+		buf.Free()
+		return json.Marshal(lokiRecord{Labels: labels[ent.Level], Ts: ent.Time.UnixNano(), Line: line})
+	})
+}
+
+func toLabelValue(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	default:
+		b, _ := json.Marshal(val)
+		return string(b)
+	}
+}
+
+// 标签按名称排序, 名称中的非法字符替换为下划线
+func formatLokiLabels(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for k := range labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, k := range names {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(sanitizeLabelName(k))
+		sb.WriteByte('=')
+		sb.WriteString(strconv.Quote(labels[k]))
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+func sanitizeLabelName(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		ok := c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (i > 0 && c >= '0' && c <= '9')
+		if !ok {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+type lokiTransport struct {
+	opts   LokiOptions
+	client *http.Client
+	httpRetry
+}
+
+type lokiStream struct {
+	labels  string
+	entries []lokiRecord
+}
+
+func (lt *lokiTransport) Send(records [][]byte) error {
+	var (
+		streams []*lokiStream
+		index   = map[string]*lokiStream{}
+	)
+	for _, raw := range records {
+		var rec lokiRecord
+		if err := json.Unmarshal(raw, &rec); err != nil {
+			continue
+		}
+		st, ok := index[rec.Labels]
+		if !ok {
+			st = &lokiStream{labels: rec.Labels}
+			index[rec.Labels] = st
+			streams = append(streams, st)
+		}
+		st.entries = append(st.entries, rec)
+	}
+	if len(streams) == 0 {
+		return nil
+	}
+
+	header := http.Header{}
+	if len(lt.opts.TenantId) > 0 {
+		header.Set("X-Scope-OrgID", lt.opts.TenantId)
+	}
+	var body []byte
+	if lt.opts.Encoding == LokiJSON {
+		header.Set("Content-Type", "application/json")
+		body = encodeLokiJSON(streams)
+	} else {
+		header.Set("Content-Type", "application/x-protobuf")
+		header.Set("Content-Encoding", "snappy")
+		body = snappy.Encode(nil, encodeLokiProto(streams))
+	}
+	_, err := lt.postWithRetry(lt.client, lt.opts.URL, header, body)
+	return err
+}
+
+func (lt *lokiTransport) Close() error {
+	return nil
+}
+
+// {"streams":[{"stream":{...},"values":[["<ns>","<line>"]]}]}
+func encodeLokiJSON(streams []*lokiStream) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(`{"streams":[`)
+	for i, st := range streams {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(`{"stream":`)
+		stream, _ := json.Marshal(parseLokiLabels(st.labels))
+		buf.Write(stream)
+		buf.WriteString(`,"values":[`)
+		for j, e := range st.entries {
+			if j > 0 {
+				buf.WriteByte(',')
+			}
+			line, _ := json.Marshal(e.Line)
+			buf.WriteString(`["` + strconv.FormatInt(e.Ts, 10) + `",`)
+			buf.Write(line)
+			buf.WriteByte(']')
+		}
+		buf.WriteString(`]}`)
+	}
+	buf.WriteString(`]}`)
+	return buf.Bytes()
+}
+
+// 解析 formatLokiLabels 生成的标签串
+func parseLokiLabels(s string) map[string]string {
+	labels := map[string]string{}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "{"), "}")
+	for len(s) > 0 {
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			break
+		}
+		name := s[:eq]
+		rest := s[eq+1:]
+		quoted, err := strconv.QuotedPrefix(rest)
+		if err != nil {
+			break
+		}
+		labels[name], _ = strconv.Unquote(quoted)
+		s = strings.TrimPrefix(rest[len(quoted):], ",")
+	}
+	return labels
+}
+
+// logproto.PushRequest
+//
+//	message PushRequest   { repeated StreamAdapter streams = 1; }
+//	message StreamAdapter { string labels = 1; repeated EntryAdapter entries = 2; }
+//	message EntryAdapter  { google.protobuf.Timestamp timestamp = 1; string line = 2; }
+func encodeLokiProto(streams []*lokiStream) []byte {
+	var req []byte
+	for _, st := range streams {
+		var stream []byte
+		stream = protowire.AppendTag(stream, 1, protowire.BytesType)
+		stream = protowire.AppendString(stream, st.labels)
+		for _, e := range st.entries {
+			var ts []byte
+			ts = protowire.AppendTag(ts, 1, protowire.VarintType)
+			ts = protowire.AppendVarint(ts, uint64(e.Ts/int64(time.Second)))
+			ts = protowire.AppendTag(ts, 2, protowire.VarintType)
+			ts = protowire.AppendVarint(ts, uint64(e.Ts%int64(time.Second)))
+
+			var entry []byte
+			entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+			entry = protowire.AppendBytes(entry, ts)
+			entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+			entry = protowire.AppendString(entry, e.Line)
+
+			stream = protowire.AppendTag(stream, 2, protowire.BytesType)
+			stream = protowire.AppendBytes(stream, entry)
+		}
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, stream)
+	}
+	return req
+}
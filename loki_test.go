@@ -0,0 +1,159 @@
+package logging
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestLokiSinkJSON(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		calls  int
+		bodies []string
+		tenant string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls == 1 {
+			// 第一次限流, 验证重试
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+		tenant = r.Header.Get("X-Scope-OrgID")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	ls, err := NewLokiSink(LokiOptions{
+		URL:         srv.URL,
+		TenantId:    "team-a",
+		Encoding:    LokiJSON,
+		LabelFields: []string{"region"},
+		MaxRetries:  2,
+		Backoff:     time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ls.Close()
+
+	opts := &Options{ServiceName: "order", FileName: "api", Fields: []zap.Field{zap.String("region", "sh")}}
+	lg := zap.New(ls.Core(opts, zapcore.DebugLevel))
+	lg.Info("hello", zap.Int("n", 1))
+	lg.Error("boom")
+	ls.Sync()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 2 || len(bodies) != 1 || tenant != "team-a" {
+		t.Fatalf("calls=%d bodies=%d tenant=%q", calls, len(bodies), tenant)
+	}
+	var req struct {
+		Streams []struct {
+			Stream map[string]string `json:"stream"`
+			Values [][2]string       `json:"values"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal([]byte(bodies[0]), &req); err != nil {
+		t.Fatal(err)
+	}
+	if len(req.Streams) != 2 {
+		t.Fatalf("want one stream per level, got %d", len(req.Streams))
+	}
+	st := req.Streams[0]
+	if st.Stream["service"] != "order" || st.Stream["logger"] != "api" || st.Stream["level"] != "info" || st.Stream["region"] != "sh" {
+		t.Fatalf("unexpected labels %v", st.Stream)
+	}
+	if !strings.Contains(st.Values[0][1], `"msg":"hello"`) {
+		t.Fatalf("unexpected line %s", st.Values[0][1])
+	}
+}
+
+func TestLokiSinkProtobuf(t *testing.T) {
+	got := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get("Content-Type") != "application/x-protobuf" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		raw, err := snappy.Decode(nil, b)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		got <- raw
+	}))
+	defer srv.Close()
+
+	ls, err := NewLokiSink(LokiOptions{URL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ls.Close()
+	zap.New(ls.Core(&Options{FileName: "api"}, zapcore.DebugLevel)).Warn("proto")
+	ls.Sync()
+
+	select {
+	case raw := <-got:
+		if !strings.Contains(string(raw), `level="warn"`) || !strings.Contains(string(raw), "proto") {
+			t.Fatalf("unexpected payload %q", raw)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no push")
+	}
+}
+
+// Retry-After 过长时等待不超过 MaxBackoff, 关闭时放弃重试, 本批进入磁盘缓存
+func TestLokiSinkRetryAfterOnClose(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	ls, err := NewLokiSink(LokiOptions{
+		NetSinkOptions: NetSinkOptions{SpoolDir: t.TempDir(), FlushInterval: 10 * time.Millisecond, MaxBackoff: time.Hour},
+		URL:            srv.URL,
+		Encoding:       LokiJSON,
+		MaxRetries:     5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lg := zap.New(ls.Core(&Options{FileName: "api"}, zapcore.DebugLevel))
+	lg.Info("hello")
+	waitFor(t, func() bool { return atomic.LoadInt32(&calls) > 0 })
+
+	start := time.Now()
+	ls.Close()
+	if d := time.Since(start); d > 2*time.Second {
+		t.Fatalf("close took %v", d)
+	}
+	if _, n := ls.SpoolDepth(); n != 1 {
+		t.Fatalf("want the batch in the spool, got %d", n)
+	}
+
+	hr := newHTTPRetry(0, 0, NetSinkOptions{MaxBackoff: 10 * time.Millisecond})
+	start = time.Now()
+	if !hr.pause(time.Hour) || time.Since(start) > time.Second {
+		t.Fatalf("pause should be capped at MaxBackoff, took %v", time.Since(start))
+	}
+}
@@ -0,0 +1,315 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const metricsNamespace = "joker_log_"
+
+var (
+	// Sync 耗时分布的桶, 单位秒
+	syncLatencyBuckets = []float64{0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+	metrics = newMetricsRegistry()
+)
+
+type metricKey struct {
+	logger string
+	level  string
+}
+
+type levelCounter struct {
+	entries     uint64
+	bytes       uint64
+	writeErrors uint64
+	dropped     uint64
+	sampled     uint64
+}
+
+type syncHistogram struct {
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+type metricsRegistry struct {
+	mu        sync.RWMutex
+	levels    map[metricKey]*levelCounter
+	rotations map[string]*uint64
+	syncs     map[string]*syncHistogram
+	counters  map[string]map[string]*uint64
+	gauges    map[string]map[string]func() float64
+}
+
+func newMetricsRegistry() *metricsRegistry {
+	return &metricsRegistry{
+		levels:    map[metricKey]*levelCounter{},
+		rotations: map[string]*uint64{},
+		syncs:     map[string]*syncHistogram{},
+		counters:  map[string]map[string]*uint64{},
+		gauges:    map[string]map[string]func() float64{},
+	}
+}
+
+func (mr *metricsRegistry) level(logger string, lvl zapcore.Level) *levelCounter {
+	key := metricKey{logger: logger, level: lvl.String()}
+	mr.mu.RLock()
+	lc, ok := mr.levels[key]
+	mr.mu.RUnlock()
+	if ok {
+		return lc
+	}
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	if lc, ok = mr.levels[key]; !ok {
+		lc = &levelCounter{}
+		mr.levels[key] = lc
+	}
+	return lc
+}
+
+func (mr *metricsRegistry) rotated(file string) {
+	mr.mu.Lock()
+	cnt, ok := mr.rotations[file]
+	if !ok {
+		cnt = new(uint64)
+		mr.rotations[file] = cnt
+	}
+	mr.mu.Unlock()
+	atomic.AddUint64(cnt, 1)
+}
+
+func (mr *metricsRegistry) observeSync(logger string, d time.Duration) {
+	sec := d.Seconds()
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	h, ok := mr.syncs[logger]
+	if !ok {
+		h = &syncHistogram{buckets: make([]uint64, len(syncLatencyBuckets))}
+		mr.syncs[logger] = h
+	}
+	for i, le := range syncLatencyBuckets {
+		if sec <= le {
+			h.buckets[i]++
+		}
+	}
+	h.count++
+	h.sum += sec
+}
+
+// 自定义计数器, name 为标签值
+func (mr *metricsRegistry) counter(metric, name string) *uint64 {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	byName, ok := mr.counters[metric]
+	if !ok {
+		byName = map[string]*uint64{}
+		mr.counters[metric] = byName
+	}
+	cnt, ok := byName[name]
+	if !ok {
+		cnt = new(uint64)
+		byName[name] = cnt
+	}
+	return cnt
+}
+
+// 自定义 gauge, 输出时调用 fn 取值, name 为标签值
+func (mr *metricsRegistry) gauge(metric, name string, fn func() float64) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	byName, ok := mr.gauges[metric]
+	if !ok {
+		byName = map[string]func() float64{}
+		mr.gauges[metric] = byName
+	}
+	byName[name] = fn
+}
+
+// 按 Prometheus 文本格式输出
+func (mr *metricsRegistry) writeTo(w io.Writer) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	keys := make([]metricKey, 0, len(mr.levels))
+	for k := range mr.levels {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].logger != keys[j].logger {
+			return keys[i].logger < keys[j].logger
+		}
+		return keys[i].level < keys[j].level
+	})
+
+	counters := []struct {
+		name, help string
+		value      func(*levelCounter) *uint64
+	}{
+		{"entries_total", "Log entries written.", func(lc *levelCounter) *uint64 { return &lc.entries }},
+		{"bytes_total", "Encoded bytes written.", func(lc *levelCounter) *uint64 { return &lc.bytes }},
+		{"write_errors_total", "Failed writes to log outputs.", func(lc *levelCounter) *uint64 { return &lc.writeErrors }},
+		{"dropped_total", "Entries dropped because of buffer limits.", func(lc *levelCounter) *uint64 { return &lc.dropped }},
+		{"sampled_total", "Entries discarded by sampling.", func(lc *levelCounter) *uint64 { return &lc.sampled }},
+	}
+	for _, c := range counters {
+		writeMetricHeader(w, c.name, c.help, "counter")
+		for _, k := range keys {
+			fmt.Fprintf(w, "%s%s{logger=\"%s\",level=\"%s\"} %d\n", metricsNamespace, c.name,
+				escapeLabel(k.logger), escapeLabel(k.level), atomic.LoadUint64(c.value(mr.levels[k])))
+		}
+	}
+
+	var names []string
+	for file := range mr.rotations {
+		names = append(names, file)
+	}
+	sort.Strings(names)
+	writeMetricHeader(w, "rotations_total", "Log file rotations.", "counter")
+	for _, file := range names {
+		fmt.Fprintf(w, "%srotations_total{file=\"%s\"} %d\n", metricsNamespace,
+			escapeLabel(file), atomic.LoadUint64(mr.rotations[file]))
+	}
+
+	names = names[:0]
+	for logger := range mr.syncs {
+		names = append(names, logger)
+	}
+	sort.Strings(names)
+	writeMetricHeader(w, "sync_duration_seconds", "Latency of Sync calls.", "histogram")
+	for _, logger := range names {
+		h, lb := mr.syncs[logger], escapeLabel(logger)
+		for i, le := range syncLatencyBuckets {
+			fmt.Fprintf(w, "%ssync_duration_seconds_bucket{logger=\"%s\",le=\"%g\"} %d\n", metricsNamespace, lb, le, h.buckets[i])
+		}
+		fmt.Fprintf(w, "%ssync_duration_seconds_bucket{logger=\"%s\",le=\"+Inf\"} %d\n", metricsNamespace, lb, h.count)
+		fmt.Fprintf(w, "%ssync_duration_seconds_sum{logger=\"%s\"} %g\n", metricsNamespace, lb, h.sum)
+		fmt.Fprintf(w, "%ssync_duration_seconds_count{logger=\"%s\"} %d\n", metricsNamespace, lb, h.count)
+	}
+
+	names = names[:0]
+	for metric := range mr.counters {
+		names = append(names, metric)
+	}
+	sort.Strings(names)
+	for _, metric := range names {
+		byName := mr.counters[metric]
+		labels := make([]string, 0, len(byName))
+		for name := range byName {
+			labels = append(labels, name)
+		}
+		sort.Strings(labels)
+		writeMetricHeader(w, metric, "", "counter")
+		for _, name := range labels {
+			fmt.Fprintf(w, "%s%s{name=\"%s\"} %d\n", metricsNamespace, metric, escapeLabel(name), atomic.LoadUint64(byName[name]))
+		}
+	}
+
+	names = names[:0]
+	for metric := range mr.gauges {
+		names = append(names, metric)
+	}
+	sort.Strings(names)
+	for _, metric := range names {
+		byName := mr.gauges[metric]
+		labels := make([]string, 0, len(byName))
+		for name := range byName {
+			labels = append(labels, name)
+		}
+		sort.Strings(labels)
+		writeMetricHeader(w, metric, "", "gauge")
+		for _, name := range labels {
+			fmt.Fprintf(w, "%s%s{name=\"%s\"} %g\n", metricsNamespace, metric, escapeLabel(name), byName[name]())
+		}
+	}
+}
+
+func writeMetricHeader(w io.Writer, name, help, typ string) {
+	if len(help) > 0 {
+		fmt.Fprintf(w, "# HELP %s%s %s\n", metricsNamespace, name, help)
+	}
+	fmt.Fprintf(w, "# TYPE %s%s %s\n", metricsNamespace, name, typ)
+}
+
+// Prometheus 文本格式的标签值只转义反斜杠、双引号和换行, 其他字符原样输出
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+// 日志系统自身指标, Prometheus 文本格式
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		metrics.writeTo(w)
+	})
+}
+
+// 带统计的日志引擎, 与 zapcore.NewCore 行为一致
+type meteredCore struct {
+	zapcore.LevelEnabler
+	name    string
+	entries bool // 是否统计条数, 错误日志引擎只统计字节避免重复计数
+	enc     zapcore.Encoder
+	out     zapcore.WriteSyncer
+}
+
+func newMeteredCore(name string, entries bool, enc zapcore.Encoder, out zapcore.WriteSyncer, enab zapcore.LevelEnabler) zapcore.Core {
+	return &meteredCore{LevelEnabler: enab, name: name, entries: entries, enc: enc, out: out}
+}
+
+func (mc *meteredCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *mc
+	clone.enc = mc.enc.Clone()
+	for i := range fields {
+		fields[i].AddTo(clone.enc)
+	}
+	return &clone
+}
+
+func (mc *meteredCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if mc.Enabled(ent.Level) {
+		return ce.AddCore(ent, mc)
+	}
+	return ce
+}
+
+func (mc *meteredCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := mc.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	lc := metrics.level(mc.name, ent.Level)
+	n, err := mc.out.Write(buf.Bytes())
+	buf.Free()
+	atomic.AddUint64(&lc.bytes, uint64(n))
+	if mc.entries {
+		atomic.AddUint64(&lc.entries, 1)
+	}
+	if err != nil {
+		atomic.AddUint64(&lc.writeErrors, 1)
+		return err
+	}
+	if ent.Level > zapcore.ErrorLevel {
+		// panic 和 fatal 之前尽量落盘
+		_ = mc.Sync()
+	}
+	return nil
+}
+
+func (mc *meteredCore) Sync() error {
+	start := time.Now()
+	err := mc.out.Sync()
+	metrics.observeSync(mc.name, time.Since(start))
+	return err
+}
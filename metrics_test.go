@@ -0,0 +1,85 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+type failWriter struct{}
+
+func (failWriter) Write(p []byte) (int, error) { return 0, errors.New("disk full") }
+func (failWriter) Sync() error                 { return nil }
+
+func TestMetricsHandler(t *testing.T) {
+	// 计数器是全局的, 每次运行使用不同的日志名, 保证 -count=N 时数值不累加
+	okName := fmt.Sprintf("metrics_ok_%d", time.Now().UnixNano())
+	badName := fmt.Sprintf("metrics_bad_%d", time.Now().UnixNano())
+	enc := zapcore.NewJSONEncoder(*defaultEncoderConfig)
+	buf := &bytes.Buffer{}
+	ok := zap.New(newMeteredCore(okName, true, enc, zapcore.AddSync(buf), zapcore.DebugLevel))
+	ok.Info("hello")
+	ok.Warn("world")
+	_ = ok.Sync()
+
+	bad := zap.New(newMeteredCore(badName, true, enc, failWriter{}, zapcore.DebugLevel))
+	bad.Error("lost")
+
+	rec := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+
+	for _, want := range []string{
+		`joker_log_entries_total{logger="` + okName + `",level="info"} 1`,
+		`joker_log_entries_total{logger="` + okName + `",level="warn"} 1`,
+		`joker_log_write_errors_total{logger="` + badName + `",level="error"} 1`,
+		`joker_log_sync_duration_seconds_count{logger="` + okName + `"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %s in\n%s", want, body)
+		}
+	}
+}
+
+// 标签值按 Prometheus 文本格式转义, 非 ASCII 字符原样输出
+func TestMetricsLabelEscape(t *testing.T) {
+	if got := escapeLabel("a\\b\"c\nd日志"); got != `a\\b\"c\nd日志` {
+		t.Fatalf("unexpected escape %s", got)
+	}
+	name := fmt.Sprintf("quote\"%d\n日志", time.Now().UnixNano())
+	atomic.AddUint64(metrics.counter("escape_test_total", name), 1)
+
+	rec := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if want := `joker_log_escape_test_total{name="` + escapeLabel(name) + `"} 1`; !strings.Contains(rec.Body.String(), want) {
+		t.Fatalf("missing %s in\n%s", want, rec.Body.String())
+	}
+}
+
+// 按大小切割未设置索引规则时同样计入切割次数
+func TestMetricsSizeRotation(t *testing.T) {
+	rr := &RollRule{Filepath: t.TempDir(), Filename: fmt.Sprintf("rotate_%d", time.Now().UnixNano())}
+	w := newIndexedWriter(&lumberjack.Logger{Filename: rr.fullName(), MaxSize: 1}, rr)
+	defer w.Close()
+	chunk := bytes.Repeat([]byte("x"), 600*1024)
+	for i := 0; i < 2; i++ {
+		if _, err := w.Write(chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if want := `joker_log_rotations_total{file="` + rr.Filename + `"} 1`; !strings.Contains(rec.Body.String(), want) {
+		t.Fatalf("missing %s in\n%s", want, rec.Body.String())
+	}
+}
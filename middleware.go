@@ -0,0 +1,122 @@
+package logging
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+var (
+	// 传递 trace id 的请求头
+	traceIdHeader = "X-Trace-Id"
+)
+
+func SetTraceIdHeader(header string) {
+	traceIdHeader = header
+}
+
+func GetTraceIdHeader() string {
+	return traceIdHeader
+}
+
+// 生成随机 trace id
+func NewTraceId() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// 将 trace id 写入 context
+func WithTraceId(ctx context.Context, id interface{}) context.Context {
+	return defaultRegistry.WithTraceId(ctx, id)
+}
+
+// 将 span id 写入 context
+func WithSpanId(ctx context.Context, id interface{}) context.Context {
+	return defaultRegistry.WithSpanId(ctx, id)
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(code int) {
+	sr.status = code
+	sr.ResponseWriter.WriteHeader(code)
+}
+
+// 流式响应和 websocket 需要底层的 Flusher 和 Hijacker
+func (sr *statusRecorder) Flush() {
+	if f, ok := sr.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (sr *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := sr.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, fmt.Errorf("http middleware: %T is not a http.Hijacker", sr.ResponseWriter)
+}
+
+// 供 http.ResponseController 找到底层的 ResponseWriter
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+// HTTPMiddleware 从请求头读取 trace id (没有则生成) 写入 context,
+// 带有合法 debug 签名头时开启本次请求的 debug 日志,
+// 请求结束时结束 trace, 5xx 响应视为失败全量输出
+func (lg *Logging) HTTPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serveHTTP(lg, next, w, r)
+	})
+}
+
+// HTTPMiddleware 使用默认日志对象
+func HTTPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serveHTTP(defaultRegistry.Default(), next, w, r)
+	})
+}
+
+func serveHTTP(lg *Logging, next http.Handler, w http.ResponseWriter, r *http.Request) {
+	reg := lg.registry()
+	ctx := r.Context()
+	id := reg.GetTraceId(ctx)
+	if id == nil {
+		tid := r.Header.Get(traceIdHeader)
+		if len(tid) == 0 {
+			tid = NewTraceId()
+		}
+		id = tid
+		ctx = reg.WithTraceId(ctx, tid)
+		r = r.WithContext(ctx)
+	}
+	w.Header().Set(traceIdHeader, fmt.Sprint(id))
+
+	if VerifyDebugToken(r.Header.Get(debugHeader), fmt.Sprint(id)) {
+		// 签名校验通过, 本次请求输出 debug 日志
+		ctx = WithDebug(ctx)
+		r = r.WithContext(ctx)
+	}
+
+	lg.Begin(ctx)
+	sr := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	completed := false
+	defer func() {
+		// 未正常返回说明处理函数 panic, 不捕获, 只全量输出后继续向上传递
+		if !completed || sr.status >= http.StatusInternalServerError {
+			lg.FinishWithError(ctx)
+		} else {
+			lg.Finish(ctx)
+		}
+	}()
+	next.ServeHTTP(sr, r)
+	completed = true
+}
@@ -6,74 +6,74 @@ import (
 
 // Debug uses fmt.Sprint to construct and log a message.
 func Debug(args ...interface{}) {
-	defaultLogger.Debug(args...)
+	packageLogger().Debug(args...)
 }
 
 // Info uses fmt.Sprint to construct and log a message.
 func Info(args ...interface{}) {
-	defaultLogger.Info(args...)
+	packageLogger().Info(args...)
 }
 
 // Warn uses fmt.Sprint to construct and log a message.
 func Warn(args ...interface{}) {
-	defaultLogger.Warn(args...)
+	packageLogger().Warn(args...)
 }
 
 // Error uses fmt.Sprint to construct and log a message.
 func Error(args ...interface{}) {
-	defaultLogger.Error(args...)
+	packageLogger().Error(args...)
 }
 
 // DPanic uses fmt.Sprint to construct and log a message. In development, the
 // logger then panics. (See DPanicLevel for details.)
 func DPanic(args ...interface{}) {
-	defaultLogger.DPanic(args...)
+	packageLogger().DPanic(args...)
 }
 
 // Panic uses fmt.Sprint to construct and log a message, then panics.
 func Panic(args ...interface{}) {
-	defaultLogger.Panic(args...)
+	packageLogger().Panic(args...)
 }
 
 // Fatal uses fmt.Sprint to construct and log a message, then calls os.Exit.
 func Fatal(args ...interface{}) {
-	defaultLogger.Fatal(args...)
+	packageLogger().Fatal(args...)
 }
 
 // Debugf uses fmt.Sprintf to log a templated message.
 func Debugf(template string, args ...interface{}) {
-	defaultLogger.Debugf(template, args...)
+	packageLogger().Debugf(template, args...)
 }
 
 // Infof uses fmt.Sprintf to log a templated message.
 func Infof(template string, args ...interface{}) {
-	defaultLogger.Infof(template, args...)
+	packageLogger().Infof(template, args...)
 }
 
 // Warnf uses fmt.Sprintf to log a templated message.
 func Warnf(template string, args ...interface{}) {
-	defaultLogger.Warnf(template, args...)
+	packageLogger().Warnf(template, args...)
 }
 
 // Errorf uses fmt.Sprintf to log a templated message.
 func Errorf(template string, args ...interface{}) {
-	defaultLogger.Errorf(template, args...)
+	packageLogger().Errorf(template, args...)
 }
 
 // DPanicf uses fmt.Sprintf to log a templated message. In development, the
 // logger then panics. (See DPanicLevel for details.)
 func DPanicf(template string, args ...interface{}) {
-	defaultLogger.DPanicf(template, args...)
+	packageLogger().DPanicf(template, args...)
 }
 
 // Panicf uses fmt.Sprintf to log a templated message, then panics.
 func Panicf(template string, args ...interface{}) {
-	defaultLogger.Panicf(template, args...)
+	packageLogger().Panicf(template, args...)
 }
 
 // Fatalf uses fmt.Sprintf to log a templated message, then calls os.Exit.
 func Fatalf(template string, args ...interface{}) {
-	defaultLogger.Fatalf(template, args...)
+	packageLogger().Fatalf(template, args...)
 }
 
 // Debugw logs a message with some additional context. The variadic key-value
@@ -82,44 +82,44 @@ func Fatalf(template string, args ...interface{}) {
 // When debug-level logging is disabled, this is much faster than
 //  s.With(keysAndValues).Debug(msg)
 func Debugw(msg string, keysAndValues ...interface{}) {
-	defaultLogger.Debugw(msg, keysAndValues...)
+	packageLogger().Debugw(msg, keysAndValues...)
 }
 
 // Infow logs a message with some additional context. The variadic key-value
 // pairs are treated as they are in With.
 func Infow(msg string, keysAndValues ...interface{}) {
-	defaultLogger.Infow(msg, keysAndValues...)
+	packageLogger().Infow(msg, keysAndValues...)
 }
 
 // Warnw logs a message with some additional context. The variadic key-value
 // pairs are treated as they are in With.
 func Warnw(msg string, keysAndValues ...interface{}) {
-	defaultLogger.Warnw(msg, keysAndValues...)
+	packageLogger().Warnw(msg, keysAndValues...)
 }
 
 // Errorw logs a message with some additional context. The variadic key-value
 // pairs are treated as they are in With.
 func Errorw(msg string, keysAndValues ...interface{}) {
-	defaultLogger.Errorw(msg, keysAndValues...)
+	packageLogger().Errorw(msg, keysAndValues...)
 }
 
 // DPanicw logs a message with some additional context. In development, the
 // logger then panics. (See DPanicLevel for details.) The variadic key-value
 // pairs are treated as they are in With.
 func DPanicw(msg string, keysAndValues ...interface{}) {
-	defaultLogger.DPanicw(msg, keysAndValues...)
+	packageLogger().DPanicw(msg, keysAndValues...)
 }
 
 // Panicw logs a message with some additional context, then panics. The
 // variadic key-value pairs are treated as they are in With.
 func Panicw(msg string, keysAndValues ...interface{}) {
-	defaultLogger.Panicw(msg, keysAndValues...)
+	packageLogger().Panicw(msg, keysAndValues...)
 }
 
 // Fatalw logs a message with some additional context, then calls os.Exit. The
 // variadic key-value pairs are treated as they are in With.
 func Fatalw(msg string, keysAndValues ...interface{}) {
-	defaultLogger.Fatalw(msg, keysAndValues...)
+	packageLogger().Fatalw(msg, keysAndValues...)
 }
 
 // Debugw logs a message with some additional context. The variadic key-value
@@ -127,54 +127,86 @@ func Fatalw(msg string, keysAndValues ...interface{}) {
 //
 // When debug-level logging is disabled, this is much faster than
 //  s.With(keysAndValues).Debug(msg)
+//
+// *wc 方法优先使用 ToContext 存入 ctx 的日志对象
 func Debugwc(msg string, ctx context.Context, keysAndValues ...interface{}) {
-	keysAndValues = append(keysAndValues, traceIdKey, GetTraceId(ctx))
-	defaultLogger.Debugw(msg, keysAndValues..., )
+	contextLogger(ctx).Debugwc(msg, ctx, keysAndValues...)
 }
 
 // Infow logs a message with some additional context. The variadic key-value
 // pairs are treated as they are in With.
 func Infowc(msg string, ctx context.Context, keysAndValues ...interface{}) {
-	keysAndValues = append(keysAndValues, traceIdKey, GetTraceId(ctx))
-	defaultLogger.Infow(msg, keysAndValues...)
+	contextLogger(ctx).Infowc(msg, ctx, keysAndValues...)
 }
 
 // Warnw logs a message with some additional context. The variadic key-value
 // pairs are treated as they are in With.
 func Warnwc(msg string, ctx context.Context, keysAndValues ...interface{}) {
-	keysAndValues = append(keysAndValues, traceIdKey, GetTraceId(ctx))
-	defaultLogger.Warnw(msg, keysAndValues...)
+	contextLogger(ctx).Warnwc(msg, ctx, keysAndValues...)
 }
 
 // Errorw logs a message with some additional context. The variadic key-value
 // pairs are treated as they are in With.
 func Errorwc(msg string, ctx context.Context, keysAndValues ...interface{}) {
-	keysAndValues = append(keysAndValues, traceIdKey, GetTraceId(ctx))
-	defaultLogger.Errorw(msg, keysAndValues...)
+	contextLogger(ctx).Errorwc(msg, ctx, keysAndValues...)
 }
 
 // DPanicw logs a message with some additional context. In development, the
 // logger then panics. (See DPanicLevel for details.) The variadic key-value
 // pairs are treated as they are in With.
 func DPanicwc(msg string, ctx context.Context, keysAndValues ...interface{}) {
-	keysAndValues = append(keysAndValues, traceIdKey, GetTraceId(ctx))
-	defaultLogger.DPanicw(msg, keysAndValues...)
+	contextLogger(ctx).DPanicwc(msg, ctx, keysAndValues...)
 }
 
 // Panicw logs a message with some additional context, then panics. The
 // variadic key-value pairs are treated as they are in With.
 func Panicwc(msg string, ctx context.Context, keysAndValues ...interface{}) {
-	keysAndValues = append(keysAndValues, traceIdKey, GetTraceId(ctx))
-	defaultLogger.Panicw(msg, keysAndValues...)
+	contextLogger(ctx).Panicwc(msg, ctx, keysAndValues...)
 }
 
 // Fatalw logs a message with some additional context, then calls os.Exit. The
 // variadic key-value pairs are treated as they are in With.
 func Fatalwc(msg string, ctx context.Context, keysAndValues ...interface{}) {
-	keysAndValues = append(keysAndValues, traceIdKey, GetTraceId(ctx))
-	defaultLogger.Fatalw(msg, keysAndValues...)
+	contextLogger(ctx).Fatalwc(msg, ctx, keysAndValues...)
+}
+
+// Begin 开始 ctx 对应的 trace, 尾部采样的耗时从此刻起算
+func Begin(ctx context.Context) {
+	packageLogger().Begin(ctx)
+}
+
+// Finish 结束 ctx 对应的 trace, 根据尾部采样规则输出或丢弃缓存的日志
+func Finish(ctx context.Context) {
+	packageLogger().Finish(ctx)
+}
+
+// FinishWithError 结束 ctx 对应的 trace 并全量输出缓存的日志
+func FinishWithError(ctx context.Context) {
+	packageLogger().FinishWithError(ctx)
 }
 
 func Sync() {
-	defaultLogger.Sync()
+	packageLogger().Sync()
+}
+
+// ErrorGroups 默认日志当前的错误分组, 按累计次数从多到少
+func ErrorGroups() []ErrorGroup {
+	return packageLogger().ErrorGroups()
+}
+
+// RecoverAndLog 需直接 defer 调用: defer logging.RecoverAndLog(ctx)
+func RecoverAndLog(ctx context.Context) {
+	if r := recover(); r != nil {
+		packageLogger().handlePanic(ctx, r)
+	}
+}
+
+// Go 在新的 goroutine 中执行 fn, panic 时由默认日志记录
+func Go(ctx context.Context, fn func()) {
+	packageLogger().Go(ctx, fn)
+}
+
+// 包级函数使用的默认日志对象
+func packageLogger() *Logging {
+	return defaultRegistry.Default().fromPackage()
 }
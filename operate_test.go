@@ -12,7 +12,7 @@ func TestInitLogger(t *testing.T) {
 	InitLogger(mode.ModeLocal)
 	defer Sync() // flushes buffer, if any
 
-	fmt.Println(defaultLogger)
+	fmt.Println(defaultRegistry.Default())
 	for {
 		Debug("ddddd")
 		Errorw("test err")
@@ -30,7 +30,7 @@ func TestNewLogger(t *testing.T) {
 	}
 	defer Logger("xxxx").Sync() // flushes buffer, if any
 
-	fmt.Println(defaultLogger)
+	fmt.Println(defaultRegistry.Default())
 	Logger("xxxx").Debug("ddddd")
 	Logger("xxxx").Errorw("test err")
 }
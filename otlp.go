@@ -0,0 +1,470 @@
+package logging
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type otlpEncoding int
+
+const (
+	OTLPProtobuf otlpEncoding = iota
+	OTLPJSON
+)
+
+const otlpScopeName = "github.com/braveghost/joker"
+
+type OTLPOptions struct {
+	NetSinkOptions
+	URL        string            // OTLP/HTTP 日志地址, 默认 http://localhost:4318/v1/logs
+	Encoding   otlpEncoding      // 请求体格式
+	Headers    map[string]string // 额外请求头, 如鉴权
+	Resource   map[string]string // 额外的资源属性
+	Timeout    time.Duration     // 单次请求超时
+	MaxRetries int               // 429 和 5xx 的重试次数
+	Backoff    time.Duration     // 首次重试等待
+}
+
+// OTLP/HTTP 日志导出, 按 OpenTelemetry 日志数据模型转换
+type OTLPSink struct {
+	*NetSink
+	opts OTLPOptions
+}
+
+func NewOTLPSink(opts OTLPOptions) (*OTLPSink, error) {
+	if len(opts.Name) == 0 {
+		opts.Name = "otlp"
+	}
+	if len(opts.URL) == 0 {
+		opts.URL = "http://localhost:4318/v1/logs"
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.Backoff == 0 {
+		opts.Backoff = 500 * time.Millisecond
+	}
+	tr := &otlpTransport{
+		opts:      opts,
+		client:    &http.Client{Timeout: opts.Timeout},
+		httpRetry: newHTTPRetry(opts.MaxRetries, opts.Backoff, opts.NetSinkOptions),
+	}
+	ns, err := NewNetSink(tr, opts.NetSinkOptions)
+	if err != nil {
+		return nil, err
+	}
+	return &OTLPSink{NetSink: ns, opts: opts}, nil
+}
+
+// AnyValue, 同一时间只有一个字段有值
+type otlpValue struct {
+	Str    *string     `json:"s,omitempty"`
+	Bool   *bool       `json:"b,omitempty"`
+	Int    *int64      `json:"i,omitempty"`
+	Double *float64    `json:"d,omitempty"`
+	Array  []otlpValue `json:"a,omitempty"`
+	KvList []otlpKV    `json:"kv,omitempty"`
+	// 区分空数组和空对象
+	IsArray bool `json:"ia,omitempty"`
+	IsKv    bool `json:"ikv,omitempty"`
+}
+
+type otlpKV struct {
+	Key   string    `json:"k"`
+	Value otlpValue `json:"v"`
+}
+
+// 缓存和传输中的单条记录
+type otlpRecord struct {
+	Resource []otlpKV `json:"resource"`
+	Time     int64    `json:"time"`
+	Severity int      `json:"severity"`
+	Level    string   `json:"level"`
+	Body     string   `json:"body"`
+	Attrs    []otlpKV `json:"attrs,omitempty"`
+	TraceId  []byte   `json:"trace_id,omitempty"`
+	SpanId   []byte   `json:"span_id,omitempty"`
+}
+
+// zap 级别对应的 SeverityNumber
+func otlpSeverity(lvl zapcore.Level) int {
+	switch lvl {
+	case zapcore.DebugLevel:
+		return 5
+	case zapcore.InfoLevel:
+		return 9
+	case zapcore.WarnLevel:
+		return 13
+	case zapcore.ErrorLevel:
+		return 17
+	case zapcore.DPanicLevel:
+		return 19
+	case zapcore.PanicLevel:
+		return 21
+	case zapcore.FatalLevel:
+		return 24
+	}
+	return 0
+}
+
+func (sk *OTLPSink) Core(opts *Options, enab zapcore.LevelEnabler) zapcore.Core {
+	resource := []otlpKV{
+		{Key: "service.name", Value: otlpString(opts.ServiceName)},
+		{Key: "deployment.environment", Value: otlpString(fmt.Sprint(opts.Mode))},
+		{Key: "logger.name", Value: otlpString(opts.GetName())},
+	}
+	for k, v := range sk.opts.Resource {
+		resource = append(resource, otlpKV{Key: k, Value: otlpString(v)})
+	}
+	reg := opts.registry()
+	return sk.newRecordCore(enab, func(ent zapcore.Entry, fields []zapcore.Field) ([]byte, error) {
+		rec := otlpRecord{
+			Resource: resource,
+			Time:     ent.Time.UnixNano(),
+			Severity: otlpSeverity(ent.Level),
+			Level:    ent.Level.CapitalString(),
+			Body:     ent.Message,
+		}
+		values := fieldsToMap(fields)
+		delete(values, "service_name")
+		spanKey := reg.SpanIdKey()
+		if id, ok := otlpId(values[reg.traceIdKey], 16); ok {
+			rec.TraceId = id
+			delete(values, reg.traceIdKey)
+		}
+		if id, ok := otlpId(values[spanKey], 8); ok {
+			rec.SpanId = id
+			delete(values, spanKey)
+		}
+		for _, k := range sortedMapKeys(values) {
+			rec.Attrs = append(rec.Attrs, otlpKV{Key: k, Value: toOtlpValue(values[k])})
+		}
+		if ent.Caller.Defined {
+			rec.Attrs = append(rec.Attrs,
+				otlpKV{Key: "code.filepath", Value: otlpString(ent.Caller.File)},
+				otlpKV{Key: "code.lineno", Value: otlpInt(int64(ent.Caller.Line))})
+		}
+		if len(ent.Stack) > 0 {
+			rec.Attrs = append(rec.Attrs, otlpKV{Key: "exception.stacktrace", Value: otlpString(ent.Stack)})
+		}
+		return json.Marshal(rec)
+	})
+}
+
+// trace id 和 span id 需为对应长度的十六进制串, 否则保留为普通属性
+func otlpId(v interface{}, size int) ([]byte, bool) {
+	s, ok := v.(string)
+	if !ok || len(s) != size*2 {
+		return nil, false
+	}
+	b, err := hex.DecodeString(s)
+	return b, err == nil
+}
+
+func sortedMapKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func otlpString(s string) otlpValue {
+	return otlpValue{Str: &s}
+}
+
+func otlpInt(i int64) otlpValue {
+	return otlpValue{Int: &i}
+}
+
+func toOtlpValue(v interface{}) otlpValue {
+	switch val := v.(type) {
+	case nil:
+		return otlpValue{}
+	case string:
+		return otlpString(val)
+	case bool:
+		return otlpValue{Bool: &val}
+	case int:
+		return otlpInt(int64(val))
+	case int8:
+		return otlpInt(int64(val))
+	case int16:
+		return otlpInt(int64(val))
+	case int32:
+		return otlpInt(int64(val))
+	case int64:
+		return otlpInt(val)
+	case uint:
+		return otlpInt(int64(val))
+	case uint8:
+		return otlpInt(int64(val))
+	case uint16:
+		return otlpInt(int64(val))
+	case uint32:
+		return otlpInt(int64(val))
+	case uint64:
+		return otlpInt(int64(val))
+	case float32:
+		f := float64(val)
+		return otlpValue{Double: &f}
+	case float64:
+		return otlpValue{Double: &val}
+	case time.Time:
+		return otlpString(val.Format(time.RFC3339Nano))
+	case time.Duration:
+		return otlpString(val.String())
+	case []byte:
+		return otlpString(string(val))
+	case []interface{}:
+		arr := otlpValue{IsArray: true}
+		for _, item := range val {
+			arr.Array = append(arr.Array, toOtlpValue(item))
+		}
+		return arr
+	case map[string]interface{}:
+		kv := otlpValue{IsKv: true}
+		for _, k := range sortedMapKeys(val) {
+			kv.KvList = append(kv.KvList, otlpKV{Key: k, Value: toOtlpValue(val[k])})
+		}
+		return kv
+	case error:
+		return otlpString(val.Error())
+	case fmt.Stringer:
+		return otlpString(val.String())
+	}
+	if b, err := json.Marshal(v); err == nil {
+		return otlpString(string(b))
+	}
+	return otlpString(fmt.Sprint(v))
+}
+
+type otlpTransport struct {
+	opts   OTLPOptions
+	client *http.Client
+	httpRetry
+}
+
+type otlpResourceLogs struct {
+	resource []otlpKV
+	records  []otlpRecord
+}
+
+func (ot *otlpTransport) Send(records [][]byte) error {
+	var (
+		groups []*otlpResourceLogs
+		index  = map[string]*otlpResourceLogs{}
+	)
+	for _, raw := range records {
+		var rec otlpRecord
+		if err := json.Unmarshal(raw, &rec); err != nil {
+			continue
+		}
+		key, _ := json.Marshal(rec.Resource)
+		g, ok := index[string(key)]
+		if !ok {
+			g = &otlpResourceLogs{resource: rec.Resource}
+			index[string(key)] = g
+			groups = append(groups, g)
+		}
+		g.records = append(g.records, rec)
+	}
+	if len(groups) == 0 {
+		return nil
+	}
+
+	header := http.Header{}
+	for k, v := range ot.opts.Headers {
+		header.Set(k, v)
+	}
+	var body []byte
+	if ot.opts.Encoding == OTLPJSON {
+		header.Set("Content-Type", "application/json")
+		body, _ = json.Marshal(otlpJSONRequest(groups))
+	} else {
+		header.Set("Content-Type", "application/x-protobuf")
+		body = otlpProtoRequest(groups)
+	}
+	_, err := ot.postWithRetry(ot.client, ot.opts.URL, header, body)
+	return err
+}
+
+func (ot *otlpTransport) Close() error {
+	return nil
+}
+
+// OTLP/JSON, 字段名为 lowerCamelCase, 64 位整数和 id 按规范编码为字符串
+func otlpJSONRequest(groups []*otlpResourceLogs) map[string]interface{} {
+	var resourceLogs []interface{}
+	for _, g := range groups {
+		var logRecords []interface{}
+		for _, rec := range g.records {
+			lr := map[string]interface{}{
+				"timeUnixNano":         strconv.FormatInt(rec.Time, 10),
+				"observedTimeUnixNano": strconv.FormatInt(rec.Time, 10),
+				"severityNumber":       rec.Severity,
+				"severityText":         rec.Level,
+				"body":                 map[string]interface{}{"stringValue": rec.Body},
+				"attributes":           otlpJSONAttrs(rec.Attrs),
+			}
+			if len(rec.TraceId) > 0 {
+				lr["traceId"] = hex.EncodeToString(rec.TraceId)
+			}
+			if len(rec.SpanId) > 0 {
+				lr["spanId"] = hex.EncodeToString(rec.SpanId)
+			}
+			logRecords = append(logRecords, lr)
+		}
+		resourceLogs = append(resourceLogs, map[string]interface{}{
+			"resource": map[string]interface{}{"attributes": otlpJSONAttrs(g.resource)},
+			"scopeLogs": []interface{}{map[string]interface{}{
+				"scope":      map[string]interface{}{"name": otlpScopeName},
+				"logRecords": logRecords,
+			}},
+		})
+	}
+	return map[string]interface{}{"resourceLogs": resourceLogs}
+}
+
+func otlpJSONAttrs(kvs []otlpKV) []interface{} {
+	attrs := make([]interface{}, 0, len(kvs))
+	for _, kv := range kvs {
+		attrs = append(attrs, map[string]interface{}{"key": kv.Key, "value": otlpJSONValue(kv.Value)})
+	}
+	return attrs
+}
+
+func otlpJSONValue(v otlpValue) map[string]interface{} {
+	switch {
+	case v.Str != nil:
+		return map[string]interface{}{"stringValue": *v.Str}
+	case v.Bool != nil:
+		return map[string]interface{}{"boolValue": *v.Bool}
+	case v.Int != nil:
+		return map[string]interface{}{"intValue": strconv.FormatInt(*v.Int, 10)}
+	case v.Double != nil:
+		return map[string]interface{}{"doubleValue": *v.Double}
+	case v.IsArray:
+		values := make([]interface{}, 0, len(v.Array))
+		for _, item := range v.Array {
+			values = append(values, otlpJSONValue(item))
+		}
+		return map[string]interface{}{"arrayValue": map[string]interface{}{"values": values}}
+	case v.IsKv:
+		return map[string]interface{}{"kvlistValue": map[string]interface{}{"values": otlpJSONAttrs(v.KvList)}}
+	}
+	return map[string]interface{}{}
+}
+
+// ExportLogsServiceRequest
+//
+//	ExportLogsServiceRequest { repeated ResourceLogs resource_logs = 1; }
+//	ResourceLogs { Resource resource = 1; repeated ScopeLogs scope_logs = 2; }
+//	Resource     { repeated KeyValue attributes = 1; }
+//	ScopeLogs    { InstrumentationScope scope = 1; repeated LogRecord log_records = 2; }
+//	LogRecord    { fixed64 time_unix_nano = 1; SeverityNumber severity_number = 2; string severity_text = 3;
+//	               AnyValue body = 5; repeated KeyValue attributes = 6; bytes trace_id = 9; bytes span_id = 10;
+//	               fixed64 observed_time_unix_nano = 11; }
+func otlpProtoRequest(groups []*otlpResourceLogs) []byte {
+	var req []byte
+	for _, g := range groups {
+		var resource []byte
+		for _, kv := range g.resource {
+			resource = appendMessage(resource, 1, otlpProtoKV(kv))
+		}
+
+		var scope []byte
+		scope = protowire.AppendTag(scope, 1, protowire.BytesType)
+		scope = protowire.AppendString(scope, otlpScopeName)
+
+		var scopeLogs []byte
+		scopeLogs = appendMessage(scopeLogs, 1, scope)
+		for _, rec := range g.records {
+			scopeLogs = appendMessage(scopeLogs, 2, otlpProtoRecord(rec))
+		}
+
+		var rl []byte
+		rl = appendMessage(rl, 1, resource)
+		rl = appendMessage(rl, 2, scopeLogs)
+		req = appendMessage(req, 1, rl)
+	}
+	return req
+}
+
+func otlpProtoRecord(rec otlpRecord) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, uint64(rec.Time))
+	b = protowire.AppendTag(b, 2, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(rec.Severity))
+	b = protowire.AppendTag(b, 3, protowire.BytesType)
+	b = protowire.AppendString(b, rec.Level)
+	b = appendMessage(b, 5, otlpProtoValue(otlpString(rec.Body)))
+	for _, kv := range rec.Attrs {
+		b = appendMessage(b, 6, otlpProtoKV(kv))
+	}
+	if len(rec.TraceId) > 0 {
+		b = protowire.AppendTag(b, 9, protowire.BytesType)
+		b = protowire.AppendBytes(b, rec.TraceId)
+	}
+	if len(rec.SpanId) > 0 {
+		b = protowire.AppendTag(b, 10, protowire.BytesType)
+		b = protowire.AppendBytes(b, rec.SpanId)
+	}
+	b = protowire.AppendTag(b, 11, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, uint64(rec.Time))
+	return b
+}
+
+func otlpProtoKV(kv otlpKV) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, kv.Key)
+	return appendMessage(b, 2, otlpProtoValue(kv.Value))
+}
+
+func otlpProtoValue(v otlpValue) []byte {
+	var b []byte
+	switch {
+	case v.Str != nil:
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendString(b, *v.Str)
+	case v.Bool != nil:
+		b = protowire.AppendTag(b, 2, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(*v.Bool))
+	case v.Int != nil:
+		b = protowire.AppendTag(b, 3, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(*v.Int))
+	case v.Double != nil:
+		b = protowire.AppendTag(b, 4, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(*v.Double))
+	case v.IsArray:
+		var arr []byte
+		for _, item := range v.Array {
+			arr = appendMessage(arr, 1, otlpProtoValue(item))
+		}
+		b = appendMessage(b, 5, arr)
+	case v.IsKv:
+		var kvs []byte
+		for _, kv := range v.KvList {
+			kvs = appendMessage(kvs, 1, otlpProtoKV(kv))
+		}
+		b = appendMessage(b, 6, kvs)
+	}
+	return b
+}
+
+func appendMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
@@ -0,0 +1,151 @@
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	collogs "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	testOtlpTraceId = "0af7651916cd43dd8448eb211c80319c"
+	testOtlpSpanId  = "b7ad6b7169203331"
+)
+
+func TestOTLPSinkJSON(t *testing.T) {
+	got := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get("Content-Type") != "application/json" || r.Header.Get("Authorization") != "token" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		got <- b
+	}))
+	defer srv.Close()
+
+	sk, err := NewOTLPSink(OTLPOptions{URL: srv.URL, Encoding: OTLPJSON, Headers: map[string]string{"Authorization": "token"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sk.Close()
+
+	opts := &Options{ServiceName: "order", FileName: "api"}
+	zap.New(sk.Core(opts, zapcore.DebugLevel)).Warn("hello",
+		zap.String("trace_id", testOtlpTraceId), zap.String("span_id", testOtlpSpanId), zap.Int("n", 3))
+	sk.Sync()
+
+	var raw []byte
+	select {
+	case raw = <-got:
+	case <-time.After(time.Second):
+		t.Fatal("no export")
+	}
+	var req struct {
+		ResourceLogs []struct {
+			Resource struct {
+				Attributes []struct {
+					Key   string            `json:"key"`
+					Value map[string]string `json:"value"`
+				} `json:"attributes"`
+			} `json:"resource"`
+			ScopeLogs []struct {
+				LogRecords []struct {
+					SeverityNumber int    `json:"severityNumber"`
+					SeverityText   string `json:"severityText"`
+					TraceId        string `json:"traceId"`
+					SpanId         string `json:"spanId"`
+					Body           struct {
+						StringValue string `json:"stringValue"`
+					} `json:"body"`
+					Attributes []struct {
+						Key   string                 `json:"key"`
+						Value map[string]interface{} `json:"value"`
+					} `json:"attributes"`
+				} `json:"logRecords"`
+			} `json:"scopeLogs"`
+		} `json:"resourceLogs"`
+	}
+	if err := json.Unmarshal(raw, &req); err != nil {
+		t.Fatal(err)
+	}
+	rl := req.ResourceLogs[0]
+	if a := rl.Resource.Attributes[0]; a.Key != "service.name" || a.Value["stringValue"] != "order" {
+		t.Fatalf("unexpected resource %v", rl.Resource.Attributes)
+	}
+	rec := rl.ScopeLogs[0].LogRecords[0]
+	if rec.SeverityNumber != 13 || rec.SeverityText != "WARN" || rec.Body.StringValue != "hello" {
+		t.Fatalf("unexpected record %+v", rec)
+	}
+	if rec.TraceId != testOtlpTraceId || rec.SpanId != testOtlpSpanId {
+		t.Fatalf("unexpected ids %s %s", rec.TraceId, rec.SpanId)
+	}
+	if a := rec.Attributes[0]; a.Key != "n" || a.Value["intValue"] != "3" {
+		t.Fatalf("unexpected attributes %v", rec.Attributes)
+	}
+}
+
+func TestOTLPSinkProtobuf(t *testing.T) {
+	got := make(chan *collogs.ExportLogsServiceRequest, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		req := &collogs.ExportLogsServiceRequest{}
+		if err := proto.Unmarshal(b, req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		got <- req
+	}))
+	defer srv.Close()
+
+	sk, err := NewOTLPSink(OTLPOptions{URL: srv.URL, Resource: map[string]string{"host.name": "node-1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sk.Close()
+
+	opts := &Options{ServiceName: "order", FileName: "otlp"}
+	lg := &Logging{status: true, opts: opts, logger: zap.New(sk.Core(opts, zapcore.DebugLevel), zap.AddCaller()).Sugar()}
+	ctx := WithSpanId(WithTraceId(context.Background(), testOtlpTraceId), testOtlpSpanId)
+	lg.Errorwc("boom", ctx, "user", "u1", "ok", false)
+	sk.Sync()
+
+	var req *collogs.ExportLogsServiceRequest
+	select {
+	case req = <-got:
+	case <-time.After(time.Second):
+		t.Fatal("no export")
+	}
+	rl := req.ResourceLogs[0]
+	resource := map[string]string{}
+	for _, kv := range rl.Resource.Attributes {
+		resource[kv.Key] = kv.Value.GetStringValue()
+	}
+	if resource["service.name"] != "order" || resource["host.name"] != "node-1" {
+		t.Fatalf("unexpected resource %v", resource)
+	}
+	rec := rl.ScopeLogs[0].LogRecords[0]
+	if rec.SeverityNumber != 17 || rec.Body.GetStringValue() != "boom" {
+		t.Fatalf("unexpected record %v", rec)
+	}
+	if len(rec.TraceId) != 16 || len(rec.SpanId) != 8 {
+		t.Fatalf("unexpected ids %x %x", rec.TraceId, rec.SpanId)
+	}
+	attrs := map[string]bool{}
+	for _, kv := range rec.Attributes {
+		attrs[kv.Key] = true
+	}
+	for _, k := range []string{"user", "ok", "code.filepath", "code.lineno"} {
+		if !attrs[k] {
+			t.Fatalf("missing attribute %s in %v", k, rec.Attributes)
+		}
+	}
+}
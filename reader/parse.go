@@ -0,0 +1,196 @@
+package reader
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/braveghost/joker/index"
+	"go.uber.org/zap/zapcore"
+)
+
+// 文件中的一条日志
+type Entry struct {
+	Time    time.Time
+	Level   zapcore.Level
+	Logger  string
+	Caller  string
+	Message string
+	Stack   string
+	Fields  map[string]interface{}
+
+	File   string // 所在文件
+	Offset int64  // 首行在文件中的偏移, 压缩文件为解压后的偏移
+}
+
+// 字段值的字符串形式, 不存在时返回 false
+func (e *Entry) Field(key string) (string, bool) {
+	v, ok := e.Fields[key]
+	if !ok {
+		return "", false
+	}
+	if s, ok := v.(string); ok {
+		return s, true
+	}
+	return fmt.Sprint(v), true
+}
+
+var (
+	ansiColor     = regexp.MustCompile("\x1b\\[[0-9;]*m")
+	callerPattern = regexp.MustCompile(`^\S+:\d+$`)
+)
+
+type parser struct {
+	ec      zapcore.EncoderConfig
+	layouts []string
+	loc     *time.Location
+}
+
+func newParser(src Source) *parser {
+	p := &parser{ec: src.encoderConfig(), layouts: index.DefaultTimeLayouts, loc: src.Location}
+	if len(src.TimeLayout) > 0 {
+		p.layouts = []string{src.TimeLayout}
+	}
+	if p.loc == nil {
+		p.loc = time.Local
+	}
+	return p
+}
+
+// 解析一行, 不是日志起始行(如堆栈)时返回 nil
+func (p *parser) parse(line []byte) *Entry {
+	line = bytes.TrimRight(line, "\r\n")
+	if len(line) == 0 {
+		return nil
+	}
+	if line[0] == '{' {
+		if e := p.parseJSON(line); e != nil {
+			return e
+		}
+	}
+	return p.parseConsole(string(line))
+}
+
+// 控制台格式: 时间 级别 [名称] [调用位置] 消息 [字段 JSON], 以 tab 分隔
+func (p *parser) parseConsole(line string) *Entry {
+	parts := strings.Split(line, "\t")
+	if len(parts) < 2 {
+		return nil
+	}
+	t, ok := p.parseTime(parts[0])
+	if !ok {
+		return nil
+	}
+	e := &Entry{Time: t}
+	if e.Level, ok = parseLevel(parts[1]); !ok {
+		return nil
+	}
+	rest := parts[2:]
+	if n := len(rest); n > 0 && strings.HasPrefix(rest[n-1], "{") {
+		if fields, ok := decodeObject([]byte(rest[n-1])); ok {
+			e.Fields = fields
+			rest = rest[:n-1]
+		}
+	}
+	if len(rest) > 1 && !callerPattern.MatchString(rest[0]) && callerPattern.MatchString(rest[1]) {
+		e.Logger, rest = rest[0], rest[1:]
+	}
+	if len(rest) > 1 && callerPattern.MatchString(rest[0]) {
+		e.Caller, rest = rest[0], rest[1:]
+	}
+	e.Message = strings.Join(rest, "\t")
+	return e
+}
+
+func (p *parser) parseJSON(line []byte) *Entry {
+	m, ok := decodeObject(line)
+	if !ok {
+		return nil
+	}
+	e := &Entry{}
+	if v, ok := m[p.ec.TimeKey]; ok {
+		if e.Time, ok = p.jsonTime(v); !ok {
+			return nil
+		}
+		delete(m, p.ec.TimeKey)
+	}
+	if v, ok := m[p.ec.LevelKey].(string); ok {
+		e.Level, _ = parseLevel(v)
+		delete(m, p.ec.LevelKey)
+	}
+	e.Logger = p.take(m, p.ec.NameKey)
+	e.Caller = p.take(m, p.ec.CallerKey)
+	e.Message = p.take(m, p.ec.MessageKey)
+	e.Stack = p.take(m, p.ec.StacktraceKey)
+	if len(m) > 0 {
+		e.Fields = m
+	}
+	return e
+}
+
+func (p *parser) take(m map[string]interface{}, key string) string {
+	if len(key) == 0 {
+		return ""
+	}
+	s, ok := m[key].(string)
+	if ok {
+		delete(m, key)
+	}
+	return s
+}
+
+func (p *parser) parseTime(s string) (time.Time, bool) {
+	for _, layout := range p.layouts {
+		if t, err := time.ParseInLocation(layout, s, p.loc); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// JSON 中的时间可能是格式化字符串或纪元时间
+func (p *parser) jsonTime(v interface{}) (time.Time, bool) {
+	switch t := v.(type) {
+	case string:
+		return p.parseTime(t)
+	case json.Number:
+		f, err := t.Float64()
+		if err != nil {
+			return time.Time{}, false
+		}
+		switch {
+		case f < 1e11: // 秒
+			sec, frac := math.Modf(f)
+			return time.Unix(int64(sec), int64(frac*1e9)), true
+		case f < 1e14: // 毫秒
+			return time.Unix(0, int64(f)*int64(time.Millisecond)), true
+		default: // 纳秒
+			return time.Unix(0, int64(f)), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// 兼容大小写和彩色编码的级别
+func parseLevel(s string) (zapcore.Level, bool) {
+	var lvl zapcore.Level
+	s = ansiColor.ReplaceAllString(s, "")
+	if err := lvl.UnmarshalText([]byte(s)); err != nil {
+		return lvl, false
+	}
+	return lvl, true
+}
+
+func decodeObject(b []byte) (map[string]interface{}, bool) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	m := map[string]interface{}{}
+	if err := dec.Decode(&m); err != nil || dec.More() {
+		return nil, false
+	}
+	return m, true
+}
@@ -0,0 +1,443 @@
+// 读取 joker 写出的日志文件: 查找当前文件及所有切割后的文件(含 .gz),
+// 将控制台或 JSON 编码解析为结构化日志, 按时间合并后迭代输出;
+// 切割后的文件有旁路索引时, 按 trace id 和时间范围跳过无关文件并直接定位到匹配的行
+package reader
+
+import (
+	"bufio"
+	"compress/gzip"
+	"container/heap"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	logging "github.com/braveghost/joker"
+	"github.com/braveghost/joker/index"
+	"go.uber.org/zap/zapcore"
+)
+
+// 日志文件来源
+type Source struct {
+	Dir           string                 // 日志目录
+	Name          string                 // 文件名, 不含 .log
+	EncoderConfig *zapcore.EncoderConfig // 解析 JSON 时使用的键, nil 时为默认配置
+	TimeLayout    string                 // 时间格式, 为空时尝试常见格式
+	Location      *time.Location         // 不带时区的时间所在时区, nil 时为本地时区
+	TraceKey      string                 // trace id 字段名, 为空时为 trace_id
+	NoIndex       bool                   // 不使用旁路索引
+}
+
+// 日志对象的全量日志文件
+func FromLogging(lg *logging.Logging) Source {
+	opts := lg.Options()
+	src := FromOptions(opts, opts.OutRr)
+	src.TraceKey = lg.Registry().TraceIdKey()
+	return src
+}
+
+// 按配置和切割规则定位日志文件, 切割规则未设置路径和文件名时使用配置中的值
+func FromOptions(opts logging.Options, rr *logging.RollRule) Source {
+	ec := opts.GetEncoderConfig()
+	src := Source{Dir: opts.GetPath(), Name: opts.GetName(), EncoderConfig: &ec}
+	if rr != nil {
+		if len(rr.Filepath) > 0 {
+			src.Dir = rr.Filepath
+		}
+		if len(rr.Filename) > 0 {
+			src.Name = rr.Filename
+		}
+	}
+	return src
+}
+
+func (s Source) encoderConfig() zapcore.EncoderConfig {
+	if s.EncoderConfig == nil {
+		return logging.Options{}.GetEncoderConfig()
+	}
+	return *s.EncoderConfig
+}
+
+func (s Source) traceKey() string {
+	if len(s.TraceKey) == 0 {
+		return "trace_id"
+	}
+	return s.TraceKey
+}
+
+// 当前文件的路径
+func (s Source) Current() string {
+	return filepath.Join(s.Dir, s.Name+".log")
+}
+
+// 当前文件及切割后的文件, 按切割时间排序, 当前文件在最后;
+// 时间切割为 name.log.%Y%m%d, 大小切割为 name-<时间>.log, 均可带 .gz;
+// 时间切割时 name.log 是指向最新文件的软链接, 不重复返回
+func (s Source) Files() ([]string, error) {
+	infos, err := ioutil.ReadDir(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+	name := regexp.QuoteMeta(s.Name)
+	rotated := regexp.MustCompile(`^(?:` + name + `\.log\.(\d+)|` +
+		name + `-(\d{4}-\d{2}-\d{2}T\d{2}-\d{2}-\d{2}\.\d{3})\.log)(?:\.gz)?$`)
+
+	type file struct {
+		path  string
+		stamp string
+	}
+	var files []file
+	var current string
+	for _, fi := range infos {
+		switch {
+		case fi.Name() == s.Name+".log":
+			if fi.Mode()&os.ModeSymlink == 0 {
+				current = filepath.Join(s.Dir, fi.Name())
+			}
+		case !fi.IsDir():
+			if m := rotated.FindStringSubmatch(fi.Name()); m != nil {
+				files = append(files, file{path: filepath.Join(s.Dir, fi.Name()), stamp: m[1] + m[2]})
+			}
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		if files[i].stamp != files[j].stamp {
+			return files[i].stamp < files[j].stamp
+		}
+		return files[i].path < files[j].path
+	})
+	paths := make([]string, 0, len(files)+1)
+	for _, f := range files {
+		paths = append(paths, f.path)
+	}
+	if len(current) > 0 {
+		paths = append(paths, current)
+	}
+	return paths, nil
+}
+
+// 过滤条件, 零值表示不过滤
+type Filter struct {
+	Since  time.Time         // 不早于
+	Until  time.Time         // 早于
+	Level  string            // 最低级别, 如 warn
+	Fields map[string]string // 字段值需全部相等, 非字符串值按 fmt.Sprint 比较
+	Match  func(*Entry) bool // 自定义条件
+}
+
+type filter struct {
+	Filter
+	level    zapcore.Level
+	hasLevel bool
+}
+
+func newFilter(f Filter) (*filter, error) {
+	ft := &filter{Filter: f}
+	if len(f.Level) > 0 {
+		lvl, err := zapcore.ParseLevel(f.Level)
+		if err != nil {
+			return nil, err
+		}
+		ft.level, ft.hasLevel = lvl, true
+	}
+	return ft, nil
+}
+
+func (f *filter) match(e *Entry) bool {
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !e.Time.Before(f.Until) {
+		return false
+	}
+	if f.hasLevel && e.Level < f.level {
+		return false
+	}
+	for k, want := range f.Fields {
+		if v, ok := e.Field(k); !ok || v != want {
+			return false
+		}
+	}
+	return f.Match == nil || f.Match(e)
+}
+
+// 打开来源下的所有文件
+func (s Source) Open(f Filter) (*Iterator, error) {
+	files, err := s.Files()
+	if err != nil {
+		return nil, err
+	}
+	return s.OpenFiles(files, f)
+}
+
+// 按 trace id 查找, 其余条件与 Open 相同
+func (s Source) Lookup(traceId string, f Filter) (*Iterator, error) {
+	fields := map[string]string{s.traceKey(): traceId}
+	for k, v := range f.Fields {
+		fields[k] = v
+	}
+	f.Fields = fields
+	return s.Open(f)
+}
+
+// 按来源的解析配置打开指定文件
+func (s Source) OpenFiles(files []string, f Filter) (*Iterator, error) {
+	ft, err := newFilter(f)
+	if err != nil {
+		return nil, err
+	}
+	it := &Iterator{filter: ft}
+	p := newParser(s)
+	for i, name := range files {
+		pl := s.plan(name, ft)
+		if pl.skip {
+			continue
+		}
+		c, err := openCursor(name, i, p)
+		if err == nil && pl.start > 0 {
+			err = c.seek(pl.start)
+		}
+		if err != nil {
+			if c != nil {
+				c.close()
+			}
+			it.Close()
+			return nil, err
+		}
+		c.seeks = pl.seeks
+		if c.advance() {
+			it.cursors = append(it.cursors, c)
+			continue
+		}
+		c.close()
+		if c.err != nil {
+			it.Close()
+			return nil, c.err
+		}
+	}
+	heap.Init(&it.cursors)
+	return it, nil
+}
+
+// 文件的读取方式
+type plan struct {
+	skip  bool    // 不包含符合条件的日志
+	seeks []int64 // 只读取这些偏移处的日志
+	start int64   // 从该偏移开始读取
+}
+
+// 根据旁路索引决定读取方式; 没有索引、索引过期或损坏时全量读取;
+// 压缩文件不能定位, 只用于跳过
+func (s Source) plan(name string, f *filter) plan {
+	var pl plan
+	if s.NoIndex {
+		return pl
+	}
+	ix, err := index.Open(name)
+	if err != nil {
+		return pl
+	}
+	plain := !strings.HasSuffix(name, ".gz")
+	if plain {
+		if fi, err := os.Stat(name); err != nil || fi.Size() != ix.Size() {
+			return pl
+		}
+	}
+	if first, last := ix.Range(); !first.IsZero() {
+		if !f.Until.IsZero() && !first.Before(f.Until) || !f.Since.IsZero() && last.Before(f.Since) {
+			pl.skip = true
+			return pl
+		}
+	}
+	if id, ok := f.Fields[ix.TraceKey()]; ok {
+		offsets, err := ix.Offsets(id)
+		if err != nil {
+			return pl
+		}
+		pl.skip = len(offsets) == 0
+		if plain {
+			pl.seeks = offsets
+		}
+		return pl
+	}
+	if !f.Since.IsZero() && plain {
+		pl.start = ix.Offset(f.Since)
+	}
+	return pl
+}
+
+// 按时间合并多个文件的日志, 时间相同时按文件顺序
+type Iterator struct {
+	filter  *filter
+	cursors cursorHeap
+	entry   *Entry
+	err     error
+}
+
+// 移动到下一条符合条件的日志
+func (it *Iterator) Next() bool {
+	for it.err == nil && len(it.cursors) > 0 {
+		c := it.cursors[0]
+		e := c.entry
+		if c.advance() {
+			heap.Fix(&it.cursors, 0)
+		} else {
+			heap.Pop(&it.cursors)
+			c.close()
+			it.err = c.err
+		}
+		if it.filter.match(e) {
+			it.entry = e
+			return true
+		}
+	}
+	it.entry = nil
+	return false
+}
+
+// 当前日志
+func (it *Iterator) Entry() *Entry {
+	return it.entry
+}
+
+// 读取过程中的错误
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+func (it *Iterator) Close() error {
+	for _, c := range it.cursors {
+		c.close()
+	}
+	it.cursors = nil
+	return nil
+}
+
+// 单个文件的读取位置
+type cursor struct {
+	name    string
+	index   int
+	parser  *parser
+	file    *os.File
+	gz      *gzip.Reader
+	r       *bufio.Reader
+	offset  int64
+	seeks   []int64 // 不为 nil 时只读取这些偏移处的日志
+	entry   *Entry  // 当前日志, 用于排序
+	pending *Entry  // 已读到起始行, 后续可能还有堆栈行
+	err     error
+}
+
+func openCursor(name string, index int, p *parser) (*cursor, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	c := &cursor{name: name, index: index, parser: p, file: f}
+	var r io.Reader = f
+	if strings.HasSuffix(name, ".gz") {
+		if c.gz, err = gzip.NewReader(f); err != nil {
+			f.Close()
+			return nil, err
+		}
+		r = c.gz
+	}
+	c.r = bufio.NewReaderSize(r, 64*1024)
+	return c, nil
+}
+
+func (c *cursor) advance() bool {
+	if c.seeks == nil {
+		return c.scan()
+	}
+	if len(c.seeks) == 0 {
+		return c.set(nil)
+	}
+	off := c.seeks[0]
+	c.seeks = c.seeks[1:]
+	if err := c.seek(off); err != nil {
+		c.err = err
+		return c.set(nil)
+	}
+	return c.scan()
+}
+
+// 定位到未压缩文件的偏移处
+func (c *cursor) seek(off int64) error {
+	if _, err := c.file.Seek(off, io.SeekStart); err != nil {
+		return err
+	}
+	c.r.Reset(c.file)
+	c.offset, c.pending = off, nil
+	return nil
+}
+
+// 读取下一条完整的日志, 起始行之后不能解析为日志的行视为堆栈
+func (c *cursor) scan() bool {
+	for {
+		line, err := c.r.ReadBytes('\n')
+		if len(line) > 0 {
+			off := c.offset
+			c.offset += int64(len(line))
+			if e := c.parser.parse(line); e != nil {
+				e.File, e.Offset = c.name, off
+				done := c.pending
+				c.pending = e
+				if done != nil {
+					return c.set(done)
+				}
+			} else if c.pending != nil {
+				c.pending.Stack += strings.TrimRight(string(line), "\r\n") + "\n"
+			}
+		}
+		if err != nil {
+			if err != io.EOF {
+				c.err = err
+			}
+			done := c.pending
+			c.pending = nil
+			return c.set(done)
+		}
+	}
+}
+
+func (c *cursor) set(e *Entry) bool {
+	if e != nil {
+		e.Stack = strings.TrimSuffix(e.Stack, "\n")
+	}
+	c.entry = e
+	return e != nil
+}
+
+func (c *cursor) close() {
+	if c.gz != nil {
+		c.gz.Close()
+	}
+	c.file.Close()
+}
+
+type cursorHeap []*cursor
+
+func (h cursorHeap) Len() int { return len(h) }
+
+func (h cursorHeap) Less(i, j int) bool {
+	if !h[i].entry.Time.Equal(h[j].entry.Time) {
+		return h[i].entry.Time.Before(h[j].entry.Time)
+	}
+	return h[i].index < h[j].index
+}
+
+func (h cursorHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *cursorHeap) Push(x interface{}) { *h = append(*h, x.(*cursor)) }
+
+func (h *cursorHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
@@ -0,0 +1,232 @@
+package reader
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	logging "github.com/braveghost/joker"
+	"github.com/braveghost/joker/index"
+	"github.com/braveghost/meteor/mode"
+	"go.uber.org/zap/zapcore"
+)
+
+var base = time.Date(2026, 10, 17, 10, 0, 0, 0, time.Local)
+
+// 按 joker 的控制台编码生成日志行
+func consoleLine(t *testing.T, at time.Duration, lvl zapcore.Level, msg string, kv ...string) string {
+	cfg := logging.Options{}.GetEncoderConfig()
+	enc := zapcore.NewConsoleEncoder(cfg)
+	var fields []zapcore.Field
+	for i := 0; i < len(kv); i += 2 {
+		fields = append(fields, zapcore.Field{Key: kv[i], Type: zapcore.StringType, String: kv[i+1]})
+	}
+	ent := zapcore.Entry{Time: base.Add(at), Level: lvl, Message: msg, Caller: zapcore.NewEntryCaller(0, "svc/order.go", 12, true)}
+	buf, err := enc.EncodeEntry(ent, fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func writeFile(t *testing.T, name string, lines ...string) {
+	content := strings.Join(lines, "")
+	if !strings.HasSuffix(name, ".gz") {
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := gzip.NewWriter(f)
+	zw.Write([]byte(content))
+	zw.Close()
+}
+
+func messages(t *testing.T, src Source, f Filter) []string {
+	it, err := src.Open(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	var msgs []string
+	for it.Next() {
+		msgs = append(msgs, it.Entry().Message)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return msgs
+}
+
+func TestFilesAndMerge(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "app.log.20261016.gz"),
+		consoleLine(t, 0, zapcore.InfoLevel, "a", "trace_id", "t1"),
+		consoleLine(t, 2*time.Second, zapcore.ErrorLevel, "c", "trace_id", "t2"))
+	writeFile(t, filepath.Join(dir, "app-2026-10-17T10-00-05.000.log"),
+		consoleLine(t, time.Second, zapcore.WarnLevel, "b", "trace_id", "t1"),
+		"goroutine 1 [running]:\n\tsvc/order.go:12\n")
+	writeFile(t, filepath.Join(dir, "app.log.20261017"),
+		consoleLine(t, 3*time.Second, zapcore.DebugLevel, "d"))
+	// 不属于 app 的文件
+	writeFile(t, filepath.Join(dir, "app_error.log"), consoleLine(t, 0, zapcore.ErrorLevel, "x"))
+	writeFile(t, filepath.Join(dir, "app-v2.log"), consoleLine(t, 0, zapcore.ErrorLevel, "x"))
+	if err := os.Symlink(filepath.Join(dir, "app.log.20261017"), filepath.Join(dir, "app.log")); err != nil {
+		t.Fatal(err)
+	}
+
+	src := FromOptions(logging.Options{Path: dir, FileName: "other"}, &logging.RollRule{Filename: "app"})
+	files, err := src.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"app-2026-10-17T10-00-05.000.log", "app.log.20261016.gz", "app.log.20261017"}
+	var got []string
+	for _, f := range files {
+		got = append(got, filepath.Base(f))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("files %v, want %v", got, want)
+	}
+
+	if msgs := messages(t, src, Filter{}); !reflect.DeepEqual(msgs, []string{"a", "b", "c", "d"}) {
+		t.Fatalf("merged %v", msgs)
+	}
+	if msgs := messages(t, src, Filter{Level: "warn"}); !reflect.DeepEqual(msgs, []string{"b", "c"}) {
+		t.Fatalf("level filter %v", msgs)
+	}
+	if msgs := messages(t, src, Filter{Fields: map[string]string{"trace_id": "t1"}}); !reflect.DeepEqual(msgs, []string{"a", "b"}) {
+		t.Fatalf("field filter %v", msgs)
+	}
+	if msgs := messages(t, src, Filter{Since: base.Add(time.Second), Until: base.Add(3 * time.Second)}); !reflect.DeepEqual(msgs, []string{"b", "c"}) {
+		t.Fatalf("time filter %v", msgs)
+	}
+
+	it, _ := src.Open(Filter{Level: "warn"})
+	defer it.Close()
+	it.Next()
+	e := it.Entry()
+	if e.Caller != "svc/order.go:12" || e.Stack != "goroutine 1 [running]:\n\tsvc/order.go:12" || e.Offset != 0 {
+		t.Fatalf("entry %+v", e)
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "api.log"),
+		`{"level":"error","time":1792116000.5,"msg":"epoch"}`+"\n",
+		`{"level":"info","time":"2026-10-17T10:00:01.0000","logger":"order","msg":"m","n":1}`+"\n")
+	it, err := Source{Dir: dir, Name: "api"}.Open(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	var entries []Entry
+	for it.Next() {
+		entries = append(entries, *it.Entry())
+	}
+	if len(entries) != 2 {
+		t.Fatalf("want 2 entries, got %d", len(entries))
+	}
+	e := entries[1]
+	if e.Message != "m" || e.Logger != "order" || !e.Time.Equal(base.Add(time.Second)) {
+		t.Fatalf("entry %+v", e)
+	}
+	if n, _ := e.Field("n"); n != "1" || e.Offset == 0 {
+		t.Fatalf("fields %v offset %d", e.Fields, e.Offset)
+	}
+	if entries[0].Level != zapcore.ErrorLevel || entries[0].Time.UnixNano() != 1792116000500000000 {
+		t.Fatalf("epoch entry %+v", entries[0])
+	}
+}
+
+// 读取日志对象实际写出的文件
+func TestFromLogging(t *testing.T) {
+	dir := t.TempDir()
+	reg := logging.NewRegistry()
+	defer reg.Close()
+	err := reg.NewLogger(&logging.Options{
+		Path: dir, FileName: "e2e", Mode: mode.ModePro,
+		OutRr: &logging.RollRule{RotationType: logging.RotationTime, MaxAge: 1, RotationTime: time.Hour * 24},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lg := reg.Logger("e2e")
+	lg.Named("pay").Infow("hello", "trace_id", "t1", "n", 2)
+	lg.Warn("world")
+	lg.Sync()
+
+	it, err := FromLogging(lg).Open(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	var entries []Entry
+	for it.Next() {
+		entries = append(entries, *it.Entry())
+	}
+	if len(entries) != 2 {
+		t.Fatalf("want 2 entries, got %d", len(entries))
+	}
+	e := entries[0]
+	if e.Message != "hello" || e.Logger != "e2e.pay" || !strings.HasPrefix(e.Caller, "reader/") {
+		t.Fatalf("entry %+v", e)
+	}
+	if id, _ := e.Field("trace_id"); id != "t1" || entries[1].Level != zapcore.WarnLevel {
+		t.Fatalf("entries %+v", entries)
+	}
+}
+
+// 有索引的文件按索引定位或跳过, 不读取其他内容
+func TestLookupUsesIndex(t *testing.T) {
+	dir := t.TempDir()
+	day := filepath.Join(dir, "app.log.20261017")
+	a := consoleLine(t, 0, zapcore.InfoLevel, "a", "trace_id", "t1")
+	b := consoleLine(t, time.Second, zapcore.InfoLevel, "b", "trace_id", "t2")
+	c := consoleLine(t, 2*time.Second, zapcore.InfoLevel, "c", "trace_id", "t1")
+	writeFile(t, day, a, b, c)
+	gz := filepath.Join(dir, "app.log.20261016.gz")
+	writeFile(t, gz, consoleLine(t, time.Hour, zapcore.InfoLevel, "g", "trace_id", "t3"))
+	for _, f := range []string{day, gz} {
+		if err := index.Build(f, index.Options{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 改写内容但保持大小, 按索引读取时看不到改写的行; 压缩文件改为无法读取, 被跳过时不报错
+	writeFile(t, day, a, strings.Replace(b, "t2", "t1", 1), c)
+	writeFile(t, gz+".tmp", "broken")
+	os.Rename(gz+".tmp", gz)
+	writeFile(t, filepath.Join(dir, "app.log"), consoleLine(t, 3*time.Second, zapcore.InfoLevel, "d", "trace_id", "t1"))
+
+	src := Source{Dir: dir, Name: "app"}
+	it, err := src.Lookup("t1", Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msgs []string
+	for it.Next() {
+		msgs = append(msgs, it.Entry().Message)
+	}
+	it.Close()
+	if it.Err() != nil || !reflect.DeepEqual(msgs, []string{"a", "c", "d"}) {
+		t.Fatalf("lookup %v %v", msgs, it.Err())
+	}
+	if msgs := messages(t, src, Filter{Until: base.Add(30 * time.Minute)}); !reflect.DeepEqual(msgs, []string{"a", "b", "c", "d"}) {
+		t.Fatalf("time range %v", msgs)
+	}
+	src.NoIndex = true
+	if _, err := src.Lookup("t1", Filter{}); err == nil {
+		t.Fatal("reading the broken file without index should fail")
+	}
+}
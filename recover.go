@@ -0,0 +1,111 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type panicPolicy int
+
+const (
+	// 记录后继续 panic
+	PanicRepanic panicPolicy = iota
+	// 记录后恢复执行
+	PanicSwallow
+	// 记录并关闭所有日志后以 ExitCode 退出进程
+	PanicExit
+)
+
+const recoverMsg = "panic recovered"
+
+var (
+	defaultRecoverRule = RecoverRule{
+		Level:    zapcore.ErrorLevel,
+		Policy:   PanicRepanic,
+		ExitCode: 2,
+	}
+)
+
+func GetDefaultRecoverRule() *RecoverRule {
+	rule := defaultRecoverRule
+	return &rule
+}
+
+// panic 恢复规则, 未设置时使用 GetDefaultRecoverRule
+type RecoverRule struct {
+	Level    zapcore.Level // 记录级别
+	Policy   panicPolicy   // 记录后的处理方式
+	ExitCode int           // PanicExit 时的退出码
+}
+
+func (lg *Logging) recoverRule() *RecoverRule {
+	if lg.opts != nil && lg.opts.Recover != nil {
+		return lg.opts.Recover
+	}
+	return &defaultRecoverRule
+}
+
+// RecoverAndLog 需直接 defer 调用: defer lg.RecoverAndLog(ctx)
+// 恢复 panic 并带 trace id 和完整的 goroutine 堆栈记录, 随后按 RecoverRule.Policy 处理
+func (lg *Logging) RecoverAndLog(ctx context.Context) {
+	if r := recover(); r != nil {
+		lg.handlePanic(ctx, r)
+	}
+}
+
+// Go 在新的 goroutine 中执行 fn, panic 时由 RecoverAndLog 处理
+func (lg *Logging) Go(ctx context.Context, fn func()) {
+	go func() {
+		defer lg.RecoverAndLog(ctx)
+		fn()
+	}()
+}
+
+func (lg *Logging) handlePanic(ctx context.Context, r interface{}) {
+	rule := lg.recoverRule()
+	reg := lg.registry()
+	stack := string(debug.Stack())
+	var traceId, spanId interface{}
+	if ctx != nil {
+		// lg.Go(nil, fn) 时 ctx 为空, 不能在恢复过程中再次 panic
+		traceId, spanId = reg.GetTraceId(ctx), reg.GetSpanId(ctx)
+	}
+	if lg.status {
+		// 直接写入日志引擎, Panic 和 Fatal 级别也不会触发 zap 的 panic 或退出, 由 Policy 决定
+		ent := zapcore.Entry{Level: rule.Level, Time: time.Now(), Message: recoverMsg, Stack: stack}
+		fields := []zapcore.Field{zap.String("panic", fmt.Sprint(r))}
+		if traceId != nil {
+			fields = append(fields, zap.String(reg.traceIdKey, fmt.Sprint(traceId)))
+		}
+		if spanId != nil {
+			fields = append(fields, zap.String(reg.SpanIdKey(), fmt.Sprint(spanId)))
+		}
+		writeThrough(lg.logger.Desugar().Core(), ent, fields)
+	} else {
+		log.Printf("Logging.RecoverAndLog.Panic || trace_id=%v | panic=%v\n%s", traceId, r, stack)
+	}
+
+	switch rule.Policy {
+	case PanicSwallow:
+	case PanicExit:
+		// 与 Fatal 相同: 先输出出错 trace 的缓存, 有关闭管理器时执行 Shutdown, 否则关闭注册表中的所有日志
+		lg.FinishWithError(ctx)
+		shutdownMu.Lock()
+		sm := shutdownManager
+		shutdownMu.Unlock()
+		if sm != nil {
+			sm.Shutdown()
+		} else {
+			reg.Close()
+		}
+		exitFunc(rule.ExitCode)
+	default:
+		panic(r)
+	}
+}
@@ -0,0 +1,136 @@
+package logging
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func newRecoverTestLogger(rule *RecoverRule) (*Logging, *observer.ObservedLogs) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	lg := &Logging{status: true, opts: &Options{Recover: rule}}
+	lg.logger = zap.New(core).Sugar()
+	return lg, logs
+}
+
+func panicky() {
+	panic("boom")
+}
+
+func TestRecoverAndLogSwallow(t *testing.T) {
+	lg, logs := newRecoverTestLogger(&RecoverRule{Level: zapcore.WarnLevel, Policy: PanicSwallow})
+	ctx := WithTraceId(context.Background(), "t1")
+
+	func() {
+		defer lg.RecoverAndLog(ctx)
+		panicky()
+	}()
+
+	entries := logs.FilterMessage(recoverMsg).All()
+	if len(entries) != 1 {
+		t.Fatalf("want one entry, got %d", len(entries))
+	}
+	e := entries[0]
+	if e.Level != zapcore.WarnLevel || e.ContextMap()["panic"] != "boom" || e.ContextMap()["trace_id"] != "t1" {
+		t.Fatalf("unexpected entry %+v", e)
+	}
+	if !strings.Contains(e.Stack, "panicky") {
+		t.Fatalf("stack should include the panic site: %s", e.Stack)
+	}
+}
+
+func TestRecoverAndLogRepanic(t *testing.T) {
+	lg, logs := newRecoverTestLogger(nil)
+	defer func() {
+		if r := recover(); r != "boom" {
+			t.Fatalf("want re-panic with original value, got %v", r)
+		}
+		if logs.Len() != 1 || logs.All()[0].Level != zapcore.ErrorLevel {
+			t.Fatalf("panic not logged at default level")
+		}
+	}()
+	defer lg.RecoverAndLog(context.Background())
+	panicky()
+}
+
+func TestGoDefaultLogger(t *testing.T) {
+	lg, logs := newRecoverTestLogger(&RecoverRule{Level: zapcore.ErrorLevel, Policy: PanicSwallow})
+	useDefaultLogger(t, lg)
+
+	Go(WithTraceId(context.Background(), "t2"), panicky)
+	waitFor(t, func() bool { return logs.Len() == 1 })
+	if logs.All()[0].ContextMap()["trace_id"] != "t2" {
+		t.Fatalf("unexpected entry %+v", logs.All()[0])
+	}
+
+	done := make(chan struct{})
+	func() {
+		defer RecoverAndLog(context.Background())
+		defer close(done)
+		panicky()
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("not recovered")
+	}
+	if logs.Len() != 2 {
+		t.Fatalf("package RecoverAndLog did not log")
+	}
+}
+
+// ctx 为空时正常记录, 不在恢复过程中再次 panic
+func TestRecoverNilContext(t *testing.T) {
+	lg, logs := newRecoverTestLogger(&RecoverRule{Level: zapcore.ErrorLevel, Policy: PanicSwallow})
+	lg.Go(nil, panicky)
+	waitFor(t, func() bool { return logs.Len() == 1 })
+	func() {
+		defer lg.RecoverAndLog(nil)
+		panicky()
+	}()
+	if logs.Len() != 2 || logs.All()[1].ContextMap()["panic"] != "boom" {
+		t.Fatalf("entries %+v", logs.All())
+	}
+}
+
+// PanicExit 与 Fatal 相同, 退出前输出出错 trace 的缓存并关闭注册表中的所有日志
+func TestRecoverExitClosesLoggers(t *testing.T) {
+	oldExit := exitFunc
+	codes := make(chan int, 1)
+	exitFunc = func(code int) { codes <- code }
+	defer func() { exitFunc = oldExit }()
+
+	reg := NewRegistry()
+	apiSink, otherSink := &closeSink{}, &closeSink{}
+	core, logs := observer.New(zapcore.DebugLevel)
+	lg := &Logging{status: true, reg: reg, tail: newTailBuffer("api", "trace_id", &TailRule{MaxTraces: 10}), opts: &Options{
+		Recover: &RecoverRule{Level: zapcore.ErrorLevel, Policy: PanicExit, ExitCode: 3},
+		Sinks:   []Sink{apiSink},
+	}}
+	lg.logger = zap.New(lg.tail.wrap(core)).Sugar()
+	other := &Logging{status: true, reg: reg, opts: &Options{Sinks: []Sink{otherSink}}}
+	other.logger = zap.NewNop().Sugar()
+	reg.loggers["api"], reg.loggers["other"] = lg, other
+
+	ctx := WithTraceId(context.Background(), "t1")
+	lg.Infowc("before", ctx)
+	func() {
+		defer lg.RecoverAndLog(ctx)
+		panicky()
+	}()
+	if code := <-codes; code != 3 {
+		t.Fatalf("exit code %d", code)
+	}
+	if logs.FilterMessage("before").Len() != 1 || logs.FilterMessage(recoverMsg).Len() != 1 {
+		t.Fatalf("buffered trace lost: %+v", logs.All())
+	}
+	if atomic.LoadInt32(&apiSink.closed) != 1 || atomic.LoadInt32(&otherSink.closed) != 1 {
+		t.Fatalf("sinks closed %d %d", apiSink.closed, otherSink.closed)
+	}
+}
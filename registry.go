@@ -0,0 +1,386 @@
+package logging
+
+import (
+	"context"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/braveghost/meteor/file"
+	"github.com/braveghost/meteor/mode"
+	"go.uber.org/zap/zapcore"
+)
+
+// 默认注册表, 包级函数都委托给它
+var defaultRegistry *Registry
+
+func init() {
+	// 自动设置当前项目路径为日志路径
+	defaultRegistry = NewRegistry()
+}
+
+// 包级函数使用的默认注册表
+func DefaultRegistry() *Registry {
+	return defaultRegistry
+}
+
+// 日志注册表, 持有默认配置、日志路径、trace key 以及默认日志和命名日志,
+// 不同注册表之间互不影响, 可用于同一进程内的多套配置或并行测试
+type Registry struct {
+	mu      sync.RWMutex
+	loggers map[string]*Logging
+
+	defaultLogger *Logging
+
+	confMu      sync.RWMutex // 保护以下可随时修改的默认配置, 与 mu 分开, 创建日志时会读取这些配置
+	serviceName string       // 默认服务名称
+	fileName    string       // 默认日志名称
+	path        string       // 默认日志存放路径
+	traceIdKey  string
+	spanIdKey   string // context 中存在时 *wc 方法一并输出
+	initFlag    bool   // 初始化完成后才写日志文件
+	openColor   bool
+
+	levels    map[string]zapcore.Level // 按名称设置的级别, 子日志向上查找
+	levelsSet int32                    // 是否设置过名称级别, 未设置时跳过查找
+	levelsGen uint32                   // 名称级别每次变化加 1, 日志对象缓存的级别据此失效
+
+	template *Options // 命名日志不存在时按此模板创建, nil 表示不自动创建
+	strict   bool     // 命名日志不存在且无法创建时 Logger 直接 panic
+
+	pathOnce  sync.Once
+	traceOnce sync.Once
+}
+
+// 新建注册表并以 ModeLocal 初始化默认日志
+func NewRegistry() *Registry {
+	r := &Registry{
+		loggers:    map[string]*Logging{},
+		levels:     map[string]zapcore.Level{},
+		fileName:   "joker",
+		traceIdKey: "trace_id",
+		spanIdKey:  "span_id",
+	}
+	r.InitLogger(mode.ModeLocal)
+	r.initFlag = true
+	return r
+}
+
+func (r *Registry) SetServiceName(name string) {
+	r.confMu.Lock()
+	r.serviceName = name
+	r.confMu.Unlock()
+}
+
+func (r *Registry) SetLogName(name string) {
+	r.confMu.Lock()
+	r.fileName = name
+	r.confMu.Unlock()
+}
+
+// 默认日志名称
+func (r *Registry) logName() string {
+	r.confMu.RLock()
+	defer r.confMu.RUnlock()
+	return r.fileName
+}
+
+// 默认日志存放路径
+func (r *Registry) logPath() string {
+	r.confMu.RLock()
+	defer r.confMu.RUnlock()
+	return r.path
+}
+
+func (r *Registry) SetTraceIdKey(key string) {
+	r.traceOnce.Do(func() {
+		r.traceIdKey = key
+	})
+}
+
+// trace id 在 context 和日志字段中使用的键
+func (r *Registry) TraceIdKey() string {
+	return r.traceIdKey
+}
+
+func (r *Registry) SetSpanIdKey(key string) {
+	r.confMu.Lock()
+	r.spanIdKey = key
+	r.confMu.Unlock()
+}
+
+// span id 在 context 和日志字段中使用的键
+func (r *Registry) SpanIdKey() string {
+	r.confMu.RLock()
+	defer r.confMu.RUnlock()
+	return r.spanIdKey
+}
+
+func (r *Registry) OpenColor() {
+	r.confMu.Lock()
+	r.openColor = true
+	r.confMu.Unlock()
+}
+
+func (r *Registry) colored() bool {
+	r.confMu.RLock()
+	defer r.confMu.RUnlock()
+	return r.openColor
+}
+
+// 根据环境变量设置日志文件存放路径
+func (r *Registry) SetLogPathByEnv() {
+	pt := os.Getenv(envKeyLogPath)
+	if pt != "" {
+		r.SetLogPath(path.Join(pt, r.logPath()))
+	}
+}
+
+// 默认设置日志文件存放路径
+func (r *Registry) SetLogPathAuto() {
+	pt, _ := os.Getwd()
+	r.SetLogPath(path.Join(pt, r.logPath()))
+}
+
+// 手动设置固定路径
+func (r *Registry) SetLogPath(pt string) {
+	r.pathOnce.Do(func() {
+		if len(pt) == 0 {
+			return
+		}
+		if !file.DirNotExistCreate(pt) {
+			log.Panicf(setLogPathLogMsg, pt, LogPathError.Error())
+		}
+		r.confMu.Lock()
+		r.path = pt
+		r.confMu.Unlock()
+	})
+}
+
+// 按名称设置级别, 对该名称及其子日志生效, 如 order 对 order.payment 生效;
+// 低于日志对象本身的级别时使用 debug 引擎输出
+func (r *Registry) SetLevel(name string, lvl zapcore.Level) {
+	r.mu.Lock()
+	r.levels[name] = lvl
+	atomic.StoreInt32(&r.levelsSet, 1)
+	atomic.AddUint32(&r.levelsGen, 1)
+	r.mu.Unlock()
+}
+
+// 取消名称级别, 恢复为日志对象本身的级别
+func (r *Registry) ResetLevel(name string) {
+	r.mu.Lock()
+	delete(r.levels, name)
+	if len(r.levels) == 0 {
+		atomic.StoreInt32(&r.levelsSet, 0)
+	}
+	atomic.AddUint32(&r.levelsGen, 1)
+	r.mu.Unlock()
+}
+
+func (r *Registry) hasLevels() bool {
+	return atomic.LoadInt32(&r.levelsSet) == 1
+}
+
+func (r *Registry) levelsGeneration() uint32 {
+	return atomic.LoadUint32(&r.levelsGen)
+}
+
+// 查找名称级别, 依次尝试 a.b.c, a.b, a
+func (r *Registry) levelOf(name string) (zapcore.Level, bool) {
+	if !r.hasLevels() {
+		return 0, false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for {
+		if lvl, ok := r.levels[name]; ok {
+			return lvl, true
+		}
+		i := strings.LastIndexByte(name, '.')
+		if i < 0 {
+			return 0, false
+		}
+		name = name[:i]
+	}
+}
+
+// 设置命名日志模板, Logger 获取不存在的日志时复制模板并以名称作为 FileName 创建
+func (r *Registry) SetTemplate(opts *Options) {
+	r.mu.Lock()
+	r.template = opts
+	r.mu.Unlock()
+}
+
+// 开启严格模式, 命名日志不存在且无法创建时 Logger 直接 panic
+func (r *Registry) SetStrict(strict bool) {
+	r.mu.Lock()
+	r.strict = strict
+	r.mu.Unlock()
+}
+
+const loggerMissLogMsg = "Logging.Logger.Miss.Error || name=%s | err=%s\n"
+
+// 获取命名日志对象, 不存在时按模板创建;
+// 无模板或创建失败时严格模式下 panic, 否则返回不可用的日志对象
+func (r *Registry) Logger(name string) *Logging {
+	lg, err := r.GetLogger(name)
+	if err != nil {
+		r.mu.RLock()
+		strict := r.strict
+		r.mu.RUnlock()
+		if strict {
+			log.Panicf(loggerMissLogMsg, name, err.Error())
+		}
+		log.Printf(loggerMissLogMsg, name, err.Error())
+		return &Logging{reg: r}
+	}
+	return lg
+}
+
+// 获取命名日志对象, 不存在时按模板创建, 无模板或创建失败时返回错误
+func (r *Registry) GetLogger(name string) (*Logging, error) {
+	r.mu.RLock()
+	lg, ok := r.loggers[name]
+	r.mu.RUnlock()
+	if ok {
+		return lg, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if lg, ok := r.loggers[name]; ok {
+		return lg, nil
+	}
+	if r.template == nil {
+		return nil, LoggerNotFoundError
+	}
+	lg, err := r.build(r.template.forName(name))
+	if err != nil {
+		return nil, err
+	}
+	r.loggers[name] = lg
+	return lg, nil
+}
+
+// 初始化命名日志对象并注册, 同名的日志对象被替换后关闭
+func (r *Registry) NewLogger(conf *Options) error {
+	tmp, err := r.build(conf)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	old := r.loggers[conf.FileName]
+	r.loggers[conf.FileName] = tmp
+	r.mu.Unlock()
+	r.closeReplaced(old, conf.FileName)
+	return nil
+}
+
+func (r *Registry) build(conf *Options) (*Logging, error) {
+	conf.reg = r
+	tmp := &Logging{
+		opts: conf,
+		reg:  r,
+	}
+	tmp.initLogger()
+	if !tmp.status {
+		return nil, LoggerInitError
+	}
+	return tmp, nil
+}
+
+// 初始化默认日志对象, 原默认日志被替换后关闭
+func (r *Registry) InitLogger(md mode.ModeType) {
+	r.confMu.RLock()
+	opts := &Options{
+		ServiceName: r.serviceName,
+		FileName:    r.fileName,
+		Path:        r.path,
+		Mode:        md,
+		OutRr:       GetDefaultRollRule(r.fileName),
+		ErrRr:       GetDefaultErrRollRule(r.fileName + "_error"),
+		reg:         r,
+	}
+	r.confMu.RUnlock()
+	lg := &Logging{opts: opts, reg: r}
+	lg.initLogger()
+
+	r.mu.Lock()
+	old := r.defaultLogger
+	r.defaultLogger = lg
+	r.mu.Unlock()
+	r.closeReplaced(old, opts.FileName)
+}
+
+// 关闭被替换的日志对象, 已注册为其他名称的不关闭
+func (r *Registry) closeReplaced(old *Logging, name string) {
+	if old == nil {
+		return
+	}
+	for _, lg := range r.all() {
+		if lg == old {
+			return
+		}
+	}
+	if err := old.Close(); err != nil {
+		log.Printf("Logging.Registry.Replace.Error || name=%s | err=%s\n", name, err.Error())
+	}
+}
+
+// 默认日志对象
+func (r *Registry) Default() *Logging {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.defaultLogger
+}
+
+// 默认日志和全部命名日志
+func (r *Registry) all() []*Logging {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	all := []*Logging{r.defaultLogger}
+	for _, lg := range r.loggers {
+		all = append(all, lg)
+	}
+	return all
+}
+
+// Sync 并关闭默认日志和全部命名日志, 返回第一个错误
+func (r *Registry) Close() error {
+	var err error
+	closed := map[*Logging]bool{}
+	for _, lg := range r.all() {
+		if lg == nil || closed[lg] {
+			continue
+		}
+		closed[lg] = true
+		if e := lg.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// 从 context 获取 trace id
+func (r *Registry) GetTraceId(ctx context.Context) interface{} {
+	return ctx.Value(r.traceIdKey)
+}
+
+// 从 context 获取 span id
+func (r *Registry) GetSpanId(ctx context.Context) interface{} {
+	return ctx.Value(r.SpanIdKey())
+}
+
+// 将 trace id 写入 context
+func (r *Registry) WithTraceId(ctx context.Context, id interface{}) context.Context {
+	return context.WithValue(ctx, r.traceIdKey, id)
+}
+
+// 将 span id 写入 context
+func (r *Registry) WithSpanId(ctx context.Context, id interface{}) context.Context {
+	return context.WithValue(ctx, r.SpanIdKey(), id)
+}
@@ -0,0 +1,180 @@
+package logging
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/braveghost/meteor/mode"
+)
+
+func newRegistryTestLogger(t *testing.T, traceKey string) (*Registry, string) {
+	dir := t.TempDir()
+	reg := NewRegistry()
+	reg.SetTraceIdKey(traceKey)
+	reg.SetLogPath(dir)
+	err := reg.NewLogger(&Options{
+		FileName: "api",
+		Mode:     mode.ModePro,
+		OutRr:    &RollRule{RotationType: RotationSize, MaxSize: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reg, filepath.Join(dir, "api.log")
+}
+
+// 以 lg 为默认日志的新注册表替换全局注册表, 供包级函数的测试使用, 测试结束后恢复
+func useDefaultLogger(t *testing.T, lg *Logging) *Registry {
+	reg := NewRegistry()
+	lg.reg = reg
+	lg.derive()
+	reg.defaultLogger = lg
+	old := defaultRegistry
+	defaultRegistry = reg
+	t.Cleanup(func() { defaultRegistry = old })
+	return reg
+}
+
+func TestRegistryIsolation(t *testing.T) {
+	a, aFile := newRegistryTestLogger(t, "trace_a")
+	b, bFile := newRegistryTestLogger(t, "trace_b")
+
+	a.Logger("api").Infowc("from a", a.WithTraceId(context.Background(), "t1"))
+	b.Logger("api").Infowc("from b", b.WithTraceId(context.Background(), "t2"))
+	a.Close()
+	b.Close()
+
+	aLog, err := ioutil.ReadFile(aFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bLog, err := ioutil.ReadFile(bFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(aLog), `"trace_a": "t1"`) || strings.Contains(string(aLog), "from b") {
+		t.Fatalf("unexpected log a: %s", aLog)
+	}
+	if !strings.Contains(string(bLog), `"trace_b": "t2"`) || strings.Contains(string(bLog), "from a") {
+		t.Fatalf("unexpected log b: %s", bLog)
+	}
+
+	// 其他注册表和默认注册表不受影响
+	if a.Logger("missing").status || defaultRegistry.traceIdKey != "trace_id" {
+		t.Fatal("registries must not share state")
+	}
+	if GetTraceId(b.WithTraceId(context.Background(), "t2")) != nil {
+		t.Fatal("default registry must not see other trace keys")
+	}
+}
+
+func TestRegistryTemplate(t *testing.T) {
+	dir := t.TempDir()
+	reg := NewRegistry()
+	if _, err := reg.GetLogger("orders"); err != LoggerNotFoundError {
+		t.Fatalf("want LoggerNotFoundError, got %v", err)
+	}
+
+	tpl := &Options{
+		Path:  dir,
+		Mode:  mode.ModePro,
+		OutRr: &RollRule{RotationType: RotationSize, MaxSize: 1},
+	}
+	reg.SetTemplate(tpl)
+	lg := reg.Logger("orders")
+	if !lg.status || lg.opts.FileName != "orders" || reg.Logger("orders") != lg {
+		t.Fatal("logger should be created once from template")
+	}
+	if tpl.FileName != "" || tpl.OutRr.Filename != "" {
+		t.Fatal("template must not be modified")
+	}
+	lg.Info("created")
+	reg.Close()
+	if b, err := ioutil.ReadFile(filepath.Join(dir, "orders.log")); err != nil || !strings.Contains(string(b), "created") {
+		t.Fatalf("unexpected log file: %s %v", b, err)
+	}
+
+	strict := NewRegistry()
+	strict.SetStrict(true)
+	defer func() {
+		if recover() == nil {
+			t.Fatal("strict registry should panic on missing logger")
+		}
+	}()
+	strict.Logger("missing")
+}
+
+// 各注册表的默认日志使用各自的切割规则副本, 并行创建时文件名互不覆盖
+func TestRegistryDefaultRollRuleIsolation(t *testing.T) {
+	names := []string{"iso_a", "iso_b"}
+	dirs := []string{t.TempDir(), t.TempDir()}
+	regs := make([]*Registry, len(names))
+	t.Run("group", func(t *testing.T) {
+		for i := range names {
+			i := i
+			t.Run(names[i], func(t *testing.T) {
+				t.Parallel()
+				reg := NewRegistry()
+				reg.SetLogName(names[i])
+				reg.SetLogPath(dirs[i])
+				reg.InitLogger(mode.ModePro)
+				reg.Default().Info("from " + names[i])
+				regs[i] = reg
+			})
+		}
+	})
+	for i, reg := range regs {
+		if rr := reg.Default().opts.OutRr; rr.Filename != names[i] {
+			t.Errorf("registry %d: roll rule file name %q, want %q", i, rr.Filename, names[i])
+		}
+		reg.Close()
+		b, err := ioutil.ReadFile(filepath.Join(dirs[i], names[i]+".log"))
+		if err != nil || !strings.Contains(string(b), "from "+names[i]) {
+			t.Errorf("registry %d: unexpected log file: %s %v", i, b, err)
+		}
+	}
+	if defaultRollRule.Filename != "" || defaultErrRollRule.Filename != "" {
+		t.Fatal("package default roll rules must not be modified")
+	}
+}
+
+// 同名日志被替换后关闭, 重新初始化默认日志与读取、修改配置可并发进行
+func TestRegistryReplace(t *testing.T) {
+	reg := NewRegistry()
+	defer reg.Close()
+	first, second := &closeSink{}, &closeSink{}
+	for _, sk := range []*closeSink{first, second} {
+		if err := reg.NewLogger(&Options{FileName: "api", Mode: mode.ModePro, Sinks: []Sink{sk}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if atomic.LoadInt32(&first.closed) != 1 || atomic.LoadInt32(&second.closed) != 0 {
+		t.Fatalf("replaced logger should be closed once, closed=%d/%d", first.closed, second.closed)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			reg.SetLogName("api")
+			reg.SetSpanIdKey("span")
+			reg.InitLogger(mode.ModeLocal)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			reg.Default().Debugwc("concurrent", reg.WithSpanId(context.Background(), i))
+		}
+	}()
+	wg.Wait()
+	if reg.Default().opts.FileName != "api" || reg.SpanIdKey() != "span" {
+		t.Fatal("default logger should use the latest settings")
+	}
+}
@@ -0,0 +1,163 @@
+package logging
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+var (
+	defaultShutdownOptions = ShutdownOptions{
+		Timeout:       5 * time.Second,
+		ExitCode:      0,
+		FatalExitCode: 1,
+		Signals:       []os.Signal{syscall.SIGTERM, syscall.SIGINT},
+	}
+
+	// 当前生效的关闭管理器, Fatal 时使用
+	shutdownManager *ShutdownManager
+	shutdownMu      sync.Mutex
+
+	// 测试时替换
+	exitFunc = os.Exit
+)
+
+type ShutdownOptions struct {
+	Timeout       time.Duration // 执行钩子以及 Sync 和关闭全部日志的最长时间
+	ExitCode      int           // 收到信号后的退出码
+	FatalExitCode int           // Fatal 之后的退出码, 为 0 时取 1
+	Signals       []os.Signal   // 监听的信号, 默认 SIGTERM 和 SIGINT
+	Registry      *Registry     // 需要关闭的日志所在注册表, nil 时为默认注册表
+}
+
+// 进程退出前依次执行退出钩子, 再 Sync 并关闭所有日志
+type ShutdownManager struct {
+	opts  ShutdownOptions
+	mu    sync.Mutex
+	hooks []func(ctx context.Context)
+	once  sync.Once
+	sigCh chan os.Signal
+	stop  chan struct{}
+}
+
+// EnableGracefulShutdown 监听信号并接管 Fatal 后的退出, 返回的管理器可注册退出钩子
+func EnableGracefulShutdown(opts *ShutdownOptions) *ShutdownManager {
+	sm := NewShutdownManager(opts)
+	sm.Start()
+	shutdownMu.Lock()
+	old := shutdownManager
+	shutdownManager = sm
+	shutdownMu.Unlock()
+	if old != nil {
+		old.Stop()
+	}
+	return sm
+}
+
+func NewShutdownManager(opts *ShutdownOptions) *ShutdownManager {
+	o := defaultShutdownOptions
+	if opts != nil {
+		o = *opts
+		if o.Timeout <= 0 {
+			o.Timeout = defaultShutdownOptions.Timeout
+		}
+		if o.FatalExitCode == 0 {
+			o.FatalExitCode = defaultShutdownOptions.FatalExitCode
+		}
+		if len(o.Signals) == 0 {
+			o.Signals = defaultShutdownOptions.Signals
+		}
+	}
+	return &ShutdownManager{opts: o, stop: make(chan struct{})}
+}
+
+func (sm *ShutdownManager) registry() *Registry {
+	if sm.opts.Registry != nil {
+		return sm.opts.Registry
+	}
+	return defaultRegistry
+}
+
+// OnShutdown 注册退出钩子, 按注册顺序在关闭日志之前执行, ctx 在超时后取消
+func (sm *ShutdownManager) OnShutdown(hook func(ctx context.Context)) {
+	sm.mu.Lock()
+	sm.hooks = append(sm.hooks, hook)
+	sm.mu.Unlock()
+}
+
+// 开始监听信号, 收到后执行 Shutdown 并以 ExitCode 退出
+func (sm *ShutdownManager) Start() {
+	sm.sigCh = make(chan os.Signal, 1)
+	signal.Notify(sm.sigCh, sm.opts.Signals...)
+	go func() {
+		select {
+		case sig := <-sm.sigCh:
+			log.Printf("Logging.Shutdown.Signal || signal=%s\n", sig)
+			sm.Shutdown()
+			exitFunc(sm.opts.ExitCode)
+		case <-sm.stop:
+		}
+	}()
+}
+
+// 停止监听信号
+func (sm *ShutdownManager) Stop() {
+	if sm.sigCh != nil {
+		signal.Stop(sm.sigCh)
+	}
+	select {
+	case <-sm.stop:
+	default:
+		close(sm.stop)
+	}
+}
+
+// Shutdown 执行退出钩子, 再 Sync 并关闭所有日志, 超过 Timeout 时不再等待; 只执行一次
+func (sm *ShutdownManager) Shutdown() error {
+	var err error
+	sm.once.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), sm.opts.Timeout)
+		defer cancel()
+
+		// 超时返回后后台仍会继续关闭, 提前取出注册表, 不再读取全局变量
+		reg := sm.registry()
+		done := make(chan error, 1)
+		go func() {
+			sm.mu.Lock()
+			hooks := append([]func(ctx context.Context){}, sm.hooks...)
+			sm.mu.Unlock()
+			for _, hook := range hooks {
+				hook(ctx)
+			}
+			done <- reg.Close()
+		}()
+		select {
+		case err = <-done:
+		case <-ctx.Done():
+			err = ctx.Err()
+			log.Printf("Logging.Shutdown.Timeout || timeout=%s\n", sm.opts.Timeout)
+		}
+	})
+	return err
+}
+
+// Fatal 写入后执行, 有关闭管理器时先完成 Shutdown 再退出
+type fatalHook struct{}
+
+func (fatalHook) OnWrite(ce *zapcore.CheckedEntry, fields []zapcore.Field) {
+	shutdownMu.Lock()
+	sm := shutdownManager
+	shutdownMu.Unlock()
+	if sm == nil {
+		exitFunc(defaultShutdownOptions.FatalExitCode)
+		return
+	}
+	sm.Shutdown()
+	exitFunc(sm.opts.FatalExitCode)
+}
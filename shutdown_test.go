@@ -0,0 +1,125 @@
+package logging
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// 记录关闭次数的扩展输出
+type closeSink struct {
+	closed int32
+}
+
+func (cs *closeSink) Core(opts *Options, enab zapcore.LevelEnabler) zapcore.Core {
+	return zapcore.NewNopCore()
+}
+
+func (cs *closeSink) Sync() error {
+	return nil
+}
+
+func (cs *closeSink) Close() error {
+	atomic.AddInt32(&cs.closed, 1)
+	return nil
+}
+
+// 替换全局的日志和退出函数, 测试结束后恢复
+func setupShutdownTest(t *testing.T) (*Logging, *closeSink, *observer.ObservedLogs, chan int) {
+	oldRegistry, oldExit := defaultRegistry, exitFunc
+	codes := make(chan int, 1)
+	exitFunc = func(code int) { codes <- code }
+
+	sink := &closeSink{}
+	core, logs := observer.New(zapcore.DebugLevel)
+	lg := &Logging{status: true, opts: &Options{Sinks: []Sink{sink}}}
+	lg.logger = lg.newSugar(core)
+	defaultRegistry = &Registry{loggers: map[string]*Logging{"api": lg}}
+
+	t.Cleanup(func() {
+		defaultRegistry, exitFunc = oldRegistry, oldExit
+		shutdownMu.Lock()
+		shutdownManager = nil
+		shutdownMu.Unlock()
+	})
+	return lg, sink, logs, codes
+}
+
+func TestShutdownHooksAndClose(t *testing.T) {
+	_, sink, _, _ := setupShutdownTest(t)
+
+	sm := NewShutdownManager(nil)
+	var order []string
+	sm.OnShutdown(func(ctx context.Context) { order = append(order, "first") })
+	sm.OnShutdown(func(ctx context.Context) {
+		if atomic.LoadInt32(&sink.closed) != 0 {
+			t.Error("hooks must run before loggers are closed")
+		}
+		order = append(order, "second")
+	})
+	if err := sm.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	sm.Shutdown()
+	if len(order) != 2 || order[0] != "first" || atomic.LoadInt32(&sink.closed) != 1 {
+		t.Fatalf("order=%v closed=%d", order, sink.closed)
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	_, sink, _, _ := setupShutdownTest(t)
+
+	sm := NewShutdownManager(&ShutdownOptions{Timeout: 20 * time.Millisecond})
+	release := make(chan struct{})
+	sm.OnShutdown(func(ctx context.Context) { <-release })
+	start := time.Now()
+	if err := sm.Shutdown(); err != context.DeadlineExceeded {
+		t.Fatalf("want deadline exceeded, got %v", err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatal("shutdown did not respect the deadline")
+	}
+
+	// 放行钩子, 等后台关闭完成后再恢复全局变量
+	close(release)
+	for deadline := time.Now().Add(2 * time.Second); atomic.LoadInt32(&sink.closed) == 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("loggers not closed after the hook returned")
+		}
+	}
+}
+
+func TestShutdownOnFatal(t *testing.T) {
+	lg, sink, logs, codes := setupShutdownTest(t)
+	shutdownManager = NewShutdownManager(&ShutdownOptions{FatalExitCode: 3})
+
+	lg.Fatalw("fatal", "k", "v")
+	if code := <-codes; code != 3 {
+		t.Fatalf("want exit code 3, got %d", code)
+	}
+	if logs.Len() != 1 || atomic.LoadInt32(&sink.closed) != 1 {
+		t.Fatalf("fatal entry must be written and loggers closed before exit")
+	}
+}
+
+func TestShutdownOnSignal(t *testing.T) {
+	_, sink, _, codes := setupShutdownTest(t)
+	sm := EnableGracefulShutdown(&ShutdownOptions{ExitCode: 143, Signals: []os.Signal{syscall.SIGUSR1}})
+	defer sm.Stop()
+
+	syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+	select {
+	case code := <-codes:
+		if code != 143 || atomic.LoadInt32(&sink.closed) != 1 {
+			t.Fatalf("code=%d closed=%d", code, sink.closed)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("signal not handled")
+	}
+}
@@ -0,0 +1,551 @@
+package logging
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap/zapcore"
+)
+
+var (
+	defaultNetSinkOptions = NetSinkOptions{
+		MaxSpoolBytes: 1 << 30,
+		SegmentBytes:  16 << 20,
+		Overflow:      OverflowDropOldest,
+		QueueSize:     8192,
+		BatchSize:     512,
+		FlushInterval: time.Second,
+		MinBackoff:    time.Second,
+		MaxBackoff:    time.Minute,
+	}
+)
+
+var SinkClosedError = errors.New("sink closed")
+
+// 扩展输出, 与文件输出并列挂到 Logging 上
+type Sink interface {
+	// 构造写入该输出的日志引擎, Logging 初始化时调用
+	Core(opts *Options, enab zapcore.LevelEnabler) zapcore.Core
+	Sync() error
+	Close() error
+}
+
+// 远端传输, 一次发送一批记录, 返回错误时整批进入磁盘缓存稍后重放
+type Transport interface {
+	Send(records [][]byte) error
+	Close() error
+}
+
+type NetSinkOptions struct {
+	Name          string         // 输出名称, 用于指标
+	SpoolDir      string         // 磁盘缓存目录, 为空时远端不可用的日志直接丢弃
+	MaxSpoolBytes int64          // 磁盘缓存上限, 单位字节
+	SegmentBytes  int64          // 单个缓存分段大小, 单位字节
+	Overflow      overflowPolicy // 磁盘缓存写满时的处理方式
+	QueueSize     int            // 内存队列长度
+	BlockTimeout  time.Duration  // 队列写满时写入方最多等待的时间, 0 表示直接丢弃
+	BatchSize     int            // 单次发送最多条数
+	BatchBytes    int            // 单次发送最多字节数, 0 表示不限制
+	FlushInterval time.Duration  // 不足一批时的发送间隔
+	MinBackoff    time.Duration  // 重放失败后的首次等待
+	MaxBackoff    time.Duration  // 重放失败后的最长等待
+}
+
+// 补全未设置的配置
+func (o NetSinkOptions) withDefaults() NetSinkOptions {
+	def := defaultNetSinkOptions
+	if o.MaxSpoolBytes == 0 {
+		o.MaxSpoolBytes = def.MaxSpoolBytes
+	}
+	if o.SegmentBytes == 0 {
+		o.SegmentBytes = def.SegmentBytes
+	}
+	if o.QueueSize == 0 {
+		o.QueueSize = def.QueueSize
+	}
+	if o.BatchSize == 0 {
+		o.BatchSize = def.BatchSize
+	}
+	if o.FlushInterval == 0 {
+		o.FlushInterval = def.FlushInterval
+	}
+	if o.MinBackoff == 0 {
+		o.MinBackoff = def.MinBackoff
+	}
+	if o.MaxBackoff == 0 {
+		o.MaxBackoff = def.MaxBackoff
+	}
+	return o
+}
+
+// 网络输出, 异步批量发送, 远端不可用时写入磁盘缓存, 恢复后按顺序重放
+type NetSink struct {
+	opts  NetSinkOptions
+	tr    Transport
+	spool *spool
+
+	// 记录编码器, 默认 JSON 行
+	newEncoder func(opts *Options) zapcore.Encoder
+
+	queue  chan []byte
+	syncCh chan chan struct{}
+	stop   chan struct{}
+	done   chan struct{}
+	once   sync.Once
+	closed int32
+
+	backoff   time.Duration
+	nextRetry time.Time
+
+	dropped    *uint64
+	sendErrors *uint64
+}
+
+func NewNetSink(tr Transport, opts NetSinkOptions) (*NetSink, error) {
+	opts = opts.withDefaults()
+	ns := &NetSink{
+		opts:       opts,
+		tr:         tr,
+		newEncoder: jsonEncoder,
+		queue:      make(chan []byte, opts.QueueSize),
+		syncCh:     make(chan chan struct{}),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+		backoff:    opts.MinBackoff,
+		dropped:    metrics.counter("sink_dropped_total", opts.Name),
+		sendErrors: metrics.counter("sink_send_errors_total", opts.Name),
+	}
+	if sb, ok := tr.(stopBinder); ok {
+		sb.bindStop(ns.stop)
+	}
+	if len(opts.SpoolDir) > 0 {
+		sp, err := openSpool(opts.SpoolDir, opts.MaxSpoolBytes, opts.SegmentBytes, opts.Overflow, ns.dropped)
+		if err != nil {
+			return nil, err
+		}
+		ns.spool = sp
+		metrics.gauge("spool_bytes", opts.Name, func() float64 {
+			b, _ := sp.depth()
+			return float64(b)
+		})
+		metrics.gauge("spool_entries", opts.Name, func() float64 {
+			_, n := sp.depth()
+			return float64(n)
+		})
+	}
+	go ns.run()
+	return ns, nil
+}
+
+// JSON 行编码, 不使用彩色级别
+func jsonEncoder(opts *Options) zapcore.Encoder {
+	cfg := *defaultEncoderConfig
+	if opts != nil && opts.EncoderConfig != nil {
+		cfg = *opts.EncoderConfig
+	}
+	cfg.EncodeLevel = zapcore.CapitalLevelEncoder
+	return zapcore.NewJSONEncoder(cfg)
+}
+
+func (ns *NetSink) Core(opts *Options, enab zapcore.LevelEnabler) zapcore.Core {
+	return newMeteredCore(ns.opts.Name, true, ns.newEncoder(opts), ns, enab)
+}
+
+// 当前磁盘缓存的字节数和条数
+func (ns *NetSink) SpoolDepth() (int64, int64) {
+	if ns.spool == nil {
+		return 0, 0
+	}
+	return ns.spool.depth()
+}
+
+// 写入内存队列, 队列满且等待超时或已关闭时丢弃
+func (ns *NetSink) Write(p []byte) (int, error) {
+	if atomic.LoadInt32(&ns.closed) == 1 {
+		atomic.AddUint64(ns.dropped, 1)
+		return 0, SinkClosedError
+	}
+	rec := make([]byte, len(p))
+	copy(rec, p)
+	select {
+	case ns.queue <- rec:
+		return len(p), nil
+	default:
+	}
+	if ns.opts.BlockTimeout > 0 {
+		// 远端处理不过来时让写入方等待, 把压力传导给调用方
+		timer := time.NewTimer(ns.opts.BlockTimeout)
+		defer timer.Stop()
+		select {
+		case ns.queue <- rec:
+			return len(p), nil
+		case <-timer.C:
+		}
+	}
+	atomic.AddUint64(ns.dropped, 1)
+	return len(p), nil
+}
+
+// 发送内存队列中的日志, 远端不可用时落盘后返回
+func (ns *NetSink) Sync() error {
+	if atomic.LoadInt32(&ns.closed) == 1 {
+		return nil
+	}
+	ack := make(chan struct{})
+	select {
+	case ns.syncCh <- ack:
+		<-ack
+	case <-ns.done:
+	}
+	return nil
+}
+
+func (ns *NetSink) Close() error {
+	var err error
+	ns.once.Do(func() {
+		atomic.StoreInt32(&ns.closed, 1)
+		close(ns.stop)
+		<-ns.done
+		err = ns.tr.Close()
+	})
+	return err
+}
+
+func (ns *NetSink) run() {
+	defer close(ns.done)
+	ticker := time.NewTicker(ns.opts.FlushInterval)
+	defer ticker.Stop()
+
+	var (
+		pending [][]byte
+		size    int
+	)
+	for {
+		select {
+		case rec := <-ns.queue:
+			pending = append(pending, rec)
+			size += len(rec)
+			if len(pending) >= ns.opts.BatchSize || (ns.opts.BatchBytes > 0 && size >= ns.opts.BatchBytes) {
+				pending, size = ns.flush(pending), 0
+			}
+		case <-ticker.C:
+			pending, size = ns.flush(pending), 0
+			ns.replay()
+		case ack := <-ns.syncCh:
+			pending, size = ns.flush(ns.drain(pending)), 0
+			close(ack)
+		case <-ns.stop:
+			ns.flush(ns.drain(pending))
+			ns.replay()
+			if ns.spool != nil {
+				ns.spool.close()
+			}
+			return
+		}
+	}
+}
+
+func (ns *NetSink) drain(pending [][]byte) [][]byte {
+	for {
+		select {
+		case rec := <-ns.queue:
+			pending = append(pending, rec)
+		default:
+			return pending
+		}
+	}
+}
+
+// 发送一批日志, 磁盘缓存非空时直接追加到缓存以保证顺序
+func (ns *NetSink) flush(pending [][]byte) [][]byte {
+	for len(pending) > 0 {
+		n := ns.batchLen(pending)
+		batch := pending[:n]
+		pending = pending[n:]
+
+		if ns.spool != nil && !ns.spool.empty() {
+			ns.toSpool(batch)
+			continue
+		}
+		if err := ns.tr.Send(batch); err != nil {
+			atomic.AddUint64(ns.sendErrors, 1)
+			if isPermanent(err) {
+				atomic.AddUint64(ns.dropped, uint64(len(batch)))
+				continue
+			}
+			ns.fail()
+			ns.toSpool(batch)
+		}
+	}
+	return nil
+}
+
+// 按条数和字节数上限切分一批, 至少一条
+func (ns *NetSink) batchLen(pending [][]byte) int {
+	size := 0
+	for i, rec := range pending {
+		size += len(rec)
+		if i+1 >= ns.opts.BatchSize || (ns.opts.BatchBytes > 0 && size >= ns.opts.BatchBytes) {
+			return i + 1
+		}
+	}
+	return len(pending)
+}
+
+func (ns *NetSink) toSpool(batch [][]byte) {
+	if ns.spool == nil {
+		atomic.AddUint64(ns.dropped, uint64(len(batch)))
+		return
+	}
+	if err := ns.spool.append(batch); err != nil {
+		atomic.AddUint64(ns.dropped, uint64(len(batch)))
+	}
+}
+
+// 按顺序重放磁盘缓存, 失败后退避
+func (ns *NetSink) replay() {
+	for ns.spool != nil && !ns.spool.empty() && !time.Now().Before(ns.nextRetry) {
+		records, off, err := ns.spool.peek(ns.opts.BatchSize)
+		if err != nil || len(records) == 0 {
+			return
+		}
+		if err := ns.tr.Send(records); err != nil {
+			atomic.AddUint64(ns.sendErrors, 1)
+			if !isPermanent(err) {
+				ns.fail()
+				return
+			}
+			// 远端明确拒绝, 重放也不会成功
+			atomic.AddUint64(ns.dropped, uint64(len(records)))
+		}
+		ns.spool.commit(off, len(records))
+		ns.backoff = ns.opts.MinBackoff
+	}
+}
+
+func (ns *NetSink) fail() {
+	ns.nextRetry = time.Now().Add(ns.backoff)
+	ns.backoff *= 2
+	if ns.backoff > ns.opts.MaxBackoff {
+		ns.backoff = ns.opts.MaxBackoff
+	}
+}
+
+// 将日志条目编码为一条记录写入网络输出, 供结构化的远端输出使用
+type recordCore struct {
+	zapcore.LevelEnabler
+	name   string
+	fields []zapcore.Field // With 追加的字段
+	sink   *NetSink
+	encode func(ent zapcore.Entry, fields []zapcore.Field) ([]byte, error)
+}
+
+func (ns *NetSink) newRecordCore(enab zapcore.LevelEnabler, encode func(zapcore.Entry, []zapcore.Field) ([]byte, error)) zapcore.Core {
+	return &recordCore{LevelEnabler: enab, name: ns.opts.Name, sink: ns, encode: encode}
+}
+
+func (rc *recordCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *rc
+	clone.fields = append(append([]zapcore.Field(nil), rc.fields...), fields...)
+	return &clone
+}
+
+func (rc *recordCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if rc.Enabled(ent.Level) {
+		return ce.AddCore(ent, rc)
+	}
+	return ce
+}
+
+func (rc *recordCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	all := fields
+	if len(rc.fields) > 0 {
+		all = append(append([]zapcore.Field(nil), rc.fields...), fields...)
+	}
+	rec, err := rc.encode(ent, all)
+	if err != nil {
+		return err
+	}
+	lc := metrics.level(rc.name, ent.Level)
+	atomic.AddUint64(&lc.entries, 1)
+	atomic.AddUint64(&lc.bytes, uint64(len(rec)))
+	_, err = rc.sink.Write(rec)
+	return err
+}
+
+func (rc *recordCore) Sync() error {
+	return rc.sink.Sync()
+}
+
+// 字段转换为 map, 值为编码后的基础类型
+func fieldsToMap(fields []zapcore.Field) map[string]interface{} {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	return enc.Fields
+}
+
+// 远端明确拒绝的错误, 不进入磁盘缓存重试
+type permanentError struct {
+	error
+}
+
+func isPermanent(err error) bool {
+	_, ok := err.(permanentError)
+	return ok
+}
+
+// HTTP 输出的重试规则, 嵌入各传输中, NewNetSink 绑定输出的关闭信号
+type httpRetry struct {
+	retries    int
+	backoff    time.Duration
+	maxBackoff time.Duration   // 单次等待上限, Retry-After 同样受限
+	stop       <-chan struct{} // 输出关闭后不再等待, 本批进入磁盘缓存
+}
+
+func newHTTPRetry(retries int, backoff time.Duration, opts NetSinkOptions) httpRetry {
+	return httpRetry{retries: retries, backoff: backoff, maxBackoff: opts.withDefaults().MaxBackoff}
+}
+
+func (hr *httpRetry) bindStop(stop <-chan struct{}) {
+	hr.stop = stop
+}
+
+// 等待 d, 不超过 maxBackoff; 输出关闭时立即返回 false
+func (hr *httpRetry) pause(d time.Duration) bool {
+	if hr.maxBackoff > 0 && d > hr.maxBackoff {
+		d = hr.maxBackoff
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-hr.stop:
+		return false
+	}
+}
+
+// 需要在关闭时中断重试等待的传输
+type stopBinder interface {
+	bindStop(stop <-chan struct{})
+}
+
+// 发送 HTTP 请求, 网络错误、429 和 5xx 按退避重试, 其余非 2xx 返回 permanentError;
+// 响应带 Retry-After 时按其等待, 等待时间不超过 maxBackoff, 输出关闭时放弃重试
+func (hr *httpRetry) postWithRetry(client *http.Client, url string, header http.Header, body []byte) ([]byte, error) {
+	var (
+		lastErr error
+		wait    time.Duration
+		backoff = hr.backoff
+	)
+	for i := 0; i <= hr.retries; i++ {
+		if i > 0 {
+			if wait <= 0 {
+				wait = backoff
+				backoff *= 2
+			}
+			if !hr.pause(wait) {
+				return nil, lastErr
+			}
+			wait = 0
+		}
+		req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return nil, permanentError{err}
+		}
+		for k, vs := range header {
+			req.Header[k] = vs
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		switch {
+		case resp.StatusCode/100 == 2:
+			return respBody, nil
+		case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+			lastErr = fmt.Errorf("%s: %s", resp.Status, respBody)
+			if sec, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+				wait = time.Duration(sec) * time.Second
+			}
+		default:
+			return respBody, permanentError{fmt.Errorf("%s: %s", resp.Status, respBody)}
+		}
+	}
+	return nil, lastErr
+}
+
+// TCP 传输, 每条记录原样写出 (JSON 编码器已带换行), 断线后下次发送时重连
+type TCPTransport struct {
+	addr    string
+	timeout time.Duration
+	conn    net.Conn
+	r       *bufio.Reader // 探测连接时只 Peek, 对端发来的数据保留在缓冲中不丢弃
+}
+
+func NewTCPTransport(addr string, timeout time.Duration) *TCPTransport {
+	return &TCPTransport{addr: addr, timeout: timeout}
+}
+
+func (tt *TCPTransport) Send(records [][]byte) error {
+	if tt.conn != nil && !connAlive(tt.conn, tt.r) {
+		tt.conn.Close()
+		tt.conn = nil
+	}
+	if tt.conn == nil {
+		conn, err := net.DialTimeout("tcp", tt.addr, tt.timeout)
+		if err != nil {
+			return err
+		}
+		tt.conn, tt.r = conn, bufio.NewReader(conn)
+	}
+	if tt.timeout > 0 {
+		tt.conn.SetWriteDeadline(time.Now().Add(tt.timeout))
+	}
+	bufs := make(net.Buffers, len(records))
+	copy(bufs, records)
+	if _, err := bufs.WriteTo(tt.conn); err != nil {
+		tt.conn.Close()
+		tt.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (tt *TCPTransport) Close() error {
+	if tt.conn != nil {
+		err := tt.conn.Close()
+		tt.conn = nil
+		return err
+	}
+	return nil
+}
+
+// 对端关闭后第一次写入仍会成功, 发送前先探测连接是否已断开;
+// 通过缓冲 Peek 探测, 不消费对端发来的数据
+func connAlive(conn net.Conn, r *bufio.Reader) bool {
+	if r.Buffered() > 0 {
+		return true
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Millisecond))
+	defer conn.SetReadDeadline(time.Time{})
+	_, err := r.Peek(1)
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return true
+	}
+	return err == nil
+}
@@ -0,0 +1,354 @@
+package logging
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+type overflowPolicy int
+
+const (
+	// 磁盘缓存写满时丢弃新日志
+	OverflowDropNewest overflowPolicy = iota
+	// 磁盘缓存写满时删除最早的分段
+	OverflowDropOldest
+)
+
+const (
+	spoolExt    = ".spool"
+	spoolOffExt = ".off" // 最早分段已确认发送的偏移和条数, 重启后从该处继续重放
+)
+
+var SpoolCorruptError = errors.New("spool segment corrupt")
+
+// 磁盘缓存, 远端不可用时按顺序落盘, 恢复后从最早的记录开始重放
+// 由分段文件组成, 每条记录为 4 字节长度 + 内容, 非并发安全, 只由发送协程使用
+type spool struct {
+	dir      string
+	maxBytes int64
+	segBytes int64
+	policy   overflowPolicy
+
+	segs   []uint64 // 分段序号, 升序
+	sizes  map[uint64]int64
+	counts map[uint64]int64
+
+	w     *os.File // 写入分段, 总是 segs 的最后一个
+	wSize int64
+
+	rOff   int64 // 最早分段已确认发送的偏移
+	rCount int64 // 最早分段已确认发送的条数
+
+	bytes   int64 // 原子读写, 供指标使用
+	entries int64
+	dropped *uint64
+}
+
+func openSpool(dir string, maxBytes, segBytes int64, policy overflowPolicy, dropped *uint64) (*spool, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	sp := &spool{
+		dir:      dir,
+		maxBytes: maxBytes,
+		segBytes: segBytes,
+		policy:   policy,
+		sizes:    map[uint64]int64{},
+		counts:   map[uint64]int64{},
+		dropped:  dropped,
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, fi := range files {
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), spoolExt) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(fi.Name(), spoolExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		n, err := countRecords(sp.segPath(seq))
+		if err != nil {
+			return nil, err
+		}
+		sp.segs = append(sp.segs, seq)
+		sp.sizes[seq] = fi.Size()
+		sp.counts[seq] = n
+		sp.bytes += fi.Size()
+		sp.entries += n
+	}
+	sort.Slice(sp.segs, func(i, j int) bool { return sp.segs[i] < sp.segs[j] })
+	sp.loadOffset()
+	return sp, nil
+}
+
+// 读取最早分段的确认偏移, 其他分段残留的偏移文件直接删除
+func (sp *spool) loadOffset() {
+	offs, _ := filepath.Glob(path.Join(sp.dir, "*"+spoolOffExt))
+	for _, name := range offs {
+		if len(sp.segs) == 0 || name != sp.offPath(sp.segs[0]) {
+			os.Remove(name)
+		}
+	}
+	if len(sp.segs) == 0 {
+		return
+	}
+	seq := sp.segs[0]
+	b, err := ioutil.ReadFile(sp.offPath(seq))
+	if err != nil || len(b) != 16 {
+		return
+	}
+	off, count := int64(binary.BigEndian.Uint64(b)), int64(binary.BigEndian.Uint64(b[8:]))
+	if off < 0 || off > sp.sizes[seq] || count < 0 || count > sp.counts[seq] {
+		return
+	}
+	sp.rOff, sp.rCount = off, count
+	atomic.AddInt64(&sp.bytes, -off)
+	atomic.AddInt64(&sp.entries, -count)
+}
+
+// 先写临时文件再改名, 重启时读到的总是完整的偏移
+func (sp *spool) saveOffset() error {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:], uint64(sp.rOff))
+	binary.BigEndian.PutUint64(b[8:], uint64(sp.rCount))
+	name := sp.offPath(sp.segs[0])
+	if err := ioutil.WriteFile(name+".tmp", b[:], 0644); err != nil {
+		return err
+	}
+	return os.Rename(name+".tmp", name)
+}
+
+func (sp *spool) offPath(seq uint64) string {
+	return path.Join(sp.dir, fmt.Sprintf("%020d%s", seq, spoolOffExt))
+}
+
+func (sp *spool) segPath(seq uint64) string {
+	return path.Join(sp.dir, fmt.Sprintf("%020d%s", seq, spoolExt))
+}
+
+func countRecords(name string) (int64, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	var (
+		n   int64
+		hdr [4]byte
+		r   = bufio.NewReader(f)
+	)
+	for {
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			// 末尾不完整的记录在重放时丢弃
+			return n, nil
+		}
+		if _, err := r.Discard(int(binary.BigEndian.Uint32(hdr[:]))); err != nil {
+			return n, nil
+		}
+		n++
+	}
+}
+
+func (sp *spool) empty() bool {
+	return len(sp.segs) == 0
+}
+
+// 当前缓存的字节数和条数
+func (sp *spool) depth() (int64, int64) {
+	return atomic.LoadInt64(&sp.bytes), atomic.LoadInt64(&sp.entries)
+}
+
+// 追加记录并落盘
+func (sp *spool) append(records [][]byte) error {
+	for _, rec := range records {
+		size := int64(len(rec)) + 4
+		over := func() bool {
+			return sp.maxBytes > 0 && atomic.LoadInt64(&sp.bytes)+size > sp.maxBytes
+		}
+		for over() && sp.policy == OverflowDropOldest {
+			if !sp.dropOldest() {
+				break
+			}
+		}
+		if over() {
+			atomic.AddUint64(sp.dropped, 1)
+			continue
+		}
+		if err := sp.write(rec); err != nil {
+			return err
+		}
+	}
+	if sp.w != nil {
+		return sp.w.Sync()
+	}
+	return nil
+}
+
+func (sp *spool) write(rec []byte) error {
+	if sp.w == nil || sp.wSize >= sp.segBytes {
+		if err := sp.rotate(); err != nil {
+			return err
+		}
+	}
+	var hdr [4]byte
+	binary.BigEndian.PutUint32(hdr[:], uint32(len(rec)))
+	if _, err := sp.w.Write(hdr[:]); err != nil {
+		return err
+	}
+	if _, err := sp.w.Write(rec); err != nil {
+		return err
+	}
+	seq := sp.segs[len(sp.segs)-1]
+	size := int64(len(rec)) + 4
+	sp.wSize += size
+	sp.sizes[seq] = sp.wSize
+	sp.counts[seq]++
+	atomic.AddInt64(&sp.bytes, size)
+	atomic.AddInt64(&sp.entries, 1)
+	return nil
+}
+
+// 新建写入分段
+func (sp *spool) rotate() error {
+	if sp.w != nil {
+		if err := sp.w.Close(); err != nil {
+			return err
+		}
+		sp.w = nil
+	}
+	var seq uint64 = 1
+	if len(sp.segs) > 0 {
+		seq = sp.segs[len(sp.segs)-1] + 1
+	}
+	f, err := os.OpenFile(sp.segPath(seq), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	sp.w, sp.wSize = f, 0
+	sp.segs = append(sp.segs, seq)
+	return nil
+}
+
+// 丢弃最早的分段, 只剩写入分段时无法丢弃
+func (sp *spool) dropOldest() bool {
+	if len(sp.segs) < 2 {
+		return false
+	}
+	atomic.AddUint64(sp.dropped, uint64(sp.counts[sp.segs[0]]-sp.rCount))
+	sp.removeHead()
+	return true
+}
+
+// 删除最早的分段, 未发送的部分从深度中扣除
+func (sp *spool) removeHead() {
+	seq := sp.segs[0]
+	if len(sp.segs) == 1 && sp.w != nil {
+		sp.w.Close()
+		sp.w, sp.wSize = nil, 0
+	}
+	os.Remove(sp.segPath(seq))
+	os.Remove(sp.offPath(seq))
+	atomic.AddInt64(&sp.bytes, -(sp.sizes[seq] - sp.rOff))
+	atomic.AddInt64(&sp.entries, -(sp.counts[seq] - sp.rCount))
+	delete(sp.sizes, seq)
+	delete(sp.counts, seq)
+	sp.segs = sp.segs[1:]
+	sp.rOff, sp.rCount = 0, 0
+}
+
+// 从最早的记录开始读取最多 n 条, 返回记录和确认发送后的偏移
+func (sp *spool) peek(n int) ([][]byte, int64, error) {
+	for len(sp.segs) > 0 {
+		seq := sp.segs[0]
+		if sp.rOff >= sp.sizes[seq] {
+			if len(sp.segs) == 1 && sp.w != nil {
+				// 写入分段已读完
+				return nil, sp.rOff, nil
+			}
+			sp.removeHead()
+			continue
+		}
+		records, off, err := readRecords(sp.segPath(seq), sp.rOff, n)
+		if err == SpoolCorruptError {
+			// 无法解析的分段整体丢弃, 避免阻塞后续重放
+			atomic.AddUint64(sp.dropped, uint64(sp.counts[seq]-sp.rCount))
+			sp.removeHead()
+			continue
+		}
+		return records, off, err
+	}
+	return nil, 0, nil
+}
+
+func readRecords(name string, off int64, n int) ([][]byte, int64, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(off, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+	var (
+		records [][]byte
+		hdr     [4]byte
+		r       = bufio.NewReader(f)
+	)
+	for len(records) < n {
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				return nil, 0, SpoolCorruptError
+			}
+			break
+		}
+		rec := make([]byte, binary.BigEndian.Uint32(hdr[:]))
+		if _, err := io.ReadFull(r, rec); err != nil {
+			return nil, 0, SpoolCorruptError
+		}
+		records = append(records, rec)
+		off += int64(len(rec)) + 4
+	}
+	return records, off, nil
+}
+
+// 确认 peek 读出的记录已发送
+func (sp *spool) commit(off int64, count int) {
+	seq := sp.segs[0]
+	atomic.AddInt64(&sp.bytes, -(off - sp.rOff))
+	atomic.AddInt64(&sp.entries, -int64(count))
+	sp.rOff = off
+	sp.rCount += int64(count)
+	if sp.rOff >= sp.sizes[seq] {
+		// 分段已全部发送, 写入分段也一并删除, 下次写入时新建
+		sp.removeHead()
+		return
+	}
+	if err := sp.saveOffset(); err != nil {
+		log.Printf("Logging.Spool.Commit.Error || dir=%s | err=%s\n", sp.dir, err.Error())
+	}
+}
+
+func (sp *spool) close() error {
+	if sp.w != nil {
+		err := sp.w.Close()
+		sp.w = nil
+		return err
+	}
+	return nil
+}
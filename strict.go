@@ -0,0 +1,137 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/braveghost/meteor/mode"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const strictKVMsg = "invalid key-value pairs"
+
+// 严格模式且级别开启时才校验, 未输出的日志不产生自诊断, 也不构造任何对象
+func (lg *Logging) strictEnabled(ctx context.Context, lvl zapcore.Level) bool {
+	if !lg.strict {
+		return false
+	}
+	base := lg.zapLogger(ctx)
+	return base == nil || base.Core().Enabled(lvl)
+}
+
+// 严格模式下校验 *w、*wc 和 With 的键值对: 空消息、奇数个、键不是字符串、
+// 键重复或与 Fields、保留字段重名; ModeLocal 直接 panic, 其他模式输出一条自诊断日志
+func (lg *Logging) validateKV(method, msg string, keysAndValues []interface{}, trace bool) {
+	var problems []string
+	if method != "With" && len(msg) == 0 {
+		problems = append(problems, "empty message")
+	}
+
+	seen := lg.reservedKeys(trace)
+	for i := 0; i < len(keysAndValues); {
+		if f, ok := keysAndValues[i].(zapcore.Field); ok {
+			// 强类型字段单独出现
+			problems = lg.checkKey(problems, seen, f.Key)
+			i++
+			continue
+		}
+		key, ok := keysAndValues[i].(string)
+		if !ok {
+			problems = append(problems, fmt.Sprintf("key %v at %d is %T, not a string", keysAndValues[i], i, keysAndValues[i]))
+			i += 2
+			continue
+		}
+		if i+1 == len(keysAndValues) {
+			problems = append(problems, fmt.Sprintf("key %q has no value", key))
+		}
+		problems = lg.checkKey(problems, seen, key)
+		i += 2
+	}
+	if len(problems) > 0 {
+		lg.kvViolation(method, msg, problems, 3+lg.skip)
+	}
+}
+
+// *z 和 *zc 方法对应的名称, 用于自诊断日志
+var typedMethods = map[zapcore.Level]string{
+	zapcore.DebugLevel:  "Debugz",
+	zapcore.InfoLevel:   "Infoz",
+	zapcore.WarnLevel:   "Warnz",
+	zapcore.ErrorLevel:  "Errorz",
+	zapcore.DPanicLevel: "DPanicz",
+	zapcore.PanicLevel:  "Panicz",
+	zapcore.FatalLevel:  "Fatalz",
+}
+
+// 严格模式下校验强类型字段: 空消息、键重复或与 Fields、保留字段重名
+func (lg *Logging) validateFields(ctx context.Context, lvl zapcore.Level, msg string, fields []Field) {
+	method := typedMethods[lvl]
+	if ctx != nil {
+		method += "c"
+	}
+	var problems []string
+	if len(msg) == 0 {
+		problems = append(problems, "empty message")
+	}
+	seen := lg.reservedKeys(ctx != nil)
+	for _, f := range fields {
+		problems = lg.checkKey(problems, seen, f.Key)
+	}
+	if len(problems) > 0 {
+		// 跳过 validateFields、writez 和 *z 方法
+		lg.kvViolation(method, msg, problems, 4+lg.skip)
+	}
+}
+
+func (lg *Logging) checkKey(problems []string, seen map[string]string, key string) []string {
+	if src, ok := seen[key]; ok {
+		return append(problems, fmt.Sprintf("key %q duplicates %s", key, src))
+	}
+	seen[key] = "an earlier key"
+	return problems
+}
+
+// 不能再次使用的键及其来源: 编码器字段、Fields、服务名、With 附加的键以及 *wc 追加的 trace id 和 span id
+func (lg *Logging) reservedKeys(trace bool) map[string]string {
+	keys := map[string]string{}
+	ec := lg.opts.EncoderConfig
+	if ec == nil {
+		ec = defaultEncoderConfig
+	}
+	for _, k := range []string{ec.TimeKey, ec.LevelKey, ec.NameKey, ec.CallerKey, ec.FunctionKey, ec.MessageKey, ec.StacktraceKey} {
+		if len(k) > 0 && k != zapcore.OmitKey {
+			keys[k] = "a reserved key"
+		}
+	}
+	for _, f := range lg.opts.ExtendField() {
+		keys[f.Key] = "Options.Fields"
+	}
+	for _, k := range lg.withKeys {
+		keys[k] = "a key added by With"
+	}
+	if trace && !lg.traced {
+		reg := lg.registry()
+		keys[reg.traceIdKey] = "the trace id added by *wc"
+		keys[reg.SpanIdKey()] = "the span id added by *wc"
+	}
+	return keys
+}
+
+func (lg *Logging) kvViolation(method, msg string, problems []string, skip int) {
+	if lg.opts.Mode == mode.ModeLocal {
+		panic(fmt.Sprintf("Logging.StrictKV.%s || msg=%s | err=%s", method, msg, strings.Join(problems, "; ")))
+	}
+	atomic.AddUint64(metrics.counter("kv_invalid_total", lg.opts.GetName()), 1)
+	base := lg.base
+	if base == nil {
+		base = lg.logger.Desugar()
+	}
+	base.WithOptions(zap.WithCaller(false)).Warn(strictKVMsg,
+		zap.String("method", method),
+		zap.String("log_msg", msg),
+		zap.Strings("problems", problems),
+		zap.StackSkip("at", skip))
+}
@@ -0,0 +1,168 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/braveghost/meteor/mode"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func newStrictLogger(md mode.ModeType) (*Logging, *observer.ObservedLogs) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	lg := &Logging{status: true, strict: true, opts: &Options{
+		Mode:     md,
+		StrictKV: true,
+		Fields:   []zap.Field{zap.String("app", "joker")},
+	}}
+	lg.logger = lg.newSugar(core)
+	lg.derive()
+	return lg, logs
+}
+
+func TestStrictKVPanicsInLocal(t *testing.T) {
+	lg, _ := newStrictLogger(mode.ModeLocal)
+	lg.Infow("ok", "id", 1, zap.Int("n", 2))
+
+	defer func() {
+		r := recover()
+		if r == nil || !strings.Contains(r.(string), `key "id" has no value`) {
+			t.Fatalf("want panic for odd pairs, got %v", r)
+		}
+	}()
+	lg.Infow("odd", "id")
+}
+
+func TestStrictKVDiagnosticInPro(t *testing.T) {
+	lg, logs := newStrictLogger(mode.ModePro)
+	ctx := WithTraceId(context.Background(), "t1")
+
+	lg.Infowc("", ctx, 1, "v", "trace_id", "t2", "msg", "x", "app", "y", "k", 1, "k", 2)
+	lg.With("level", "x")
+
+	diag := logs.FilterMessage(strictKVMsg).All()
+	if len(diag) != 2 {
+		t.Fatalf("want 2 diagnostics, got %d", len(diag))
+	}
+	problems := fmt.Sprint(diag[0].ContextMap()["problems"])
+	for _, want := range []string{
+		"empty message",
+		"key 1 at 0 is int",
+		`key "trace_id" duplicates the trace id`,
+		`key "msg" duplicates a reserved key`,
+		`key "app" duplicates Options.Fields`,
+		`key "k" duplicates an earlier key`,
+	} {
+		if !strings.Contains(problems, want) {
+			t.Errorf("problems %s missing %q", problems, want)
+		}
+	}
+	if !strings.Contains(fmt.Sprint(diag[1].ContextMap()["problems"]), `key "level" duplicates a reserved key`) {
+		t.Errorf("With keys should be validated, got %v", diag[1].ContextMap())
+	}
+	// 校验失败不影响原日志输出
+	if logs.FilterMessage("").Len() != 1 {
+		t.Fatal("original entry should still be written")
+	}
+}
+
+// 强类型字段同样校验重复键、保留字段和 Fields
+func TestStrictKVTypedFields(t *testing.T) {
+	lg, logs := newStrictLogger(mode.ModePro)
+	ctx := WithTraceId(context.Background(), "t1")
+
+	lg.Infoz("ok", String("id", "1"), Int("n", 2))
+	lg.Infozc("", ctx, String("trace_id", "t2"), String("level", "x"), String("app", "y"), Int("k", 1), Int("k", 2))
+
+	diag := logs.FilterMessage(strictKVMsg).All()
+	if len(diag) != 1 {
+		t.Fatalf("want 1 diagnostic, got %d", len(diag))
+	}
+	fields := diag[0].ContextMap()
+	problems := fmt.Sprint(fields["problems"])
+	for _, want := range []string{
+		"empty message",
+		`key "trace_id" duplicates the trace id`,
+		`key "level" duplicates a reserved key`,
+		`key "app" duplicates Options.Fields`,
+		`key "k" duplicates an earlier key`,
+	} {
+		if !strings.Contains(problems, want) {
+			t.Errorf("problems %s missing %q", problems, want)
+		}
+	}
+	// 调用栈从调用方开始
+	if fields["method"] != "Infozc" || !strings.Contains(fields["at"].(string), "TestStrictKVTypedFields") ||
+		strings.Contains(fields["at"].(string), "writez") {
+		t.Errorf("diagnostic %v", fields)
+	}
+
+	local, _ := newStrictLogger(mode.ModeLocal)
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(r.(string), "Logging.StrictKV.Warnz") {
+			t.Fatalf("want panic for duplicate key, got %v", r)
+		}
+	}()
+	local.Warnz("dup", String("msg", "x"))
+}
+
+// 级别未开启的日志不校验, 不输出自诊断也不计数
+func TestStrictKVSkipsDisabledLevels(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	lg := &Logging{status: true, strict: true, opts: &Options{Mode: mode.ModePro, StrictKV: true, FileName: "strict_disabled"}}
+	lg.logger = lg.newSugar(core)
+	lg.derive()
+	ctx := WithTraceId(context.Background(), "t1")
+
+	lg.Debugw("", "k")
+	lg.Debugwc("", ctx, "trace_id", "t2")
+	lg.Debugz("", String("msg", "x"))
+	if logs.Len() != 0 {
+		t.Fatalf("disabled entries validated: %+v", logs.All())
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		lg.Debugz("", String("msg", "x"))
+	})
+	if allocs != 0 {
+		t.Fatalf("disabled level should not allocate in strict mode, got %v", allocs)
+	}
+	lg.Infow("", "k")
+	if logs.FilterMessage(strictKVMsg).Len() != 1 {
+		t.Fatal("enabled entries should still be validated")
+	}
+}
+
+// 包级函数的自诊断调用栈从调用方开始; With 附加的键不能再次使用
+func TestStrictKVPackageAndWith(t *testing.T) {
+	lg, logs := newStrictLogger(mode.ModePro)
+	useDefaultLogger(t, lg)
+	ctx := WithTraceId(context.Background(), "t1")
+
+	_, file, line, _ := runtime.Caller(0)
+	Infow("", "k")
+	Infowc("", ctx, "k")
+	lg.WithContext(ctx).Infow("m", "trace_id", "t2")
+	lg.With("k", 1).Infoz("m", Int("k", 2))
+
+	diag := logs.FilterMessage(strictKVMsg).All()
+	if len(diag) != 4 {
+		t.Fatalf("want 4 diagnostics, got %d", len(diag))
+	}
+	for i, d := range diag[:2] {
+		at := d.ContextMap()["at"].(string)
+		first := strings.SplitN(at, "\n", 3)
+		if want := fmt.Sprintf("%s:%d", file, line+1+i); len(first) < 2 || !strings.Contains(first[1], want) {
+			t.Errorf("%s: stack starts at %q, want %s", d.ContextMap()["method"], first, want)
+		}
+	}
+	for _, d := range diag[2:] {
+		if problems := fmt.Sprint(d.ContextMap()["problems"]); !strings.Contains(problems, "duplicates a key added by With") {
+			t.Errorf("%s: problems %s", d.ContextMap()["method"], problems)
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+var (
+	defaultTailRule = TailRule{
+		SampleRate:    0.01,
+		SlowThreshold: time.Second,
+		MaxEntries:    1000,
+		MaxTraces:     10000,
+		TraceTimeout:  time.Minute,
+	}
+)
+
+// 尾部采样规则, 以 trace 为单位缓存 *wc 日志, 结束时决定全量输出或按比例丢弃
+type TailRule struct {
+	SampleRate    float64       // 正常结束的 trace 保留比例, 0~1
+	SlowThreshold time.Duration // 耗时超过该值的 trace 全量保留, 0 表示不按耗时判断
+	MaxEntries    int           // 单个 trace 最多缓存条数, 超出丢弃最早的非错误日志
+	MaxTraces     int           // 同时缓存的 trace 数, 超出时最早的 trace 提前结束
+	TraceTimeout  time.Duration // trace 超过该时间无新日志视为遗弃
+}
+
+// 默认尾部采样规则
+func GetDefaultTailRule() *TailRule {
+	rule := defaultTailRule
+	return &rule
+}
+
+type tailEntry struct {
+	core   zapcore.Core
+	entry  zapcore.Entry
+	fields []zapcore.Field
+}
+
+type tailTrace struct {
+	id      string
+	start   time.Time
+	last    time.Time
+	failed  bool
+	entries []tailEntry
+}
+
+type tailBuffer struct {
+	name   string
+	key    string // trace id 字段名
+	rule   TailRule
+	mu     sync.Mutex
+	traces map[string]*tailTrace
+	stop   chan struct{}
+	once   sync.Once
+}
+
+func newTailBuffer(name, key string, rule *TailRule) *tailBuffer {
+	tb := &tailBuffer{
+		name:   name,
+		key:    key,
+		rule:   *rule,
+		traces: map[string]*tailTrace{},
+		stop:   make(chan struct{}),
+	}
+	if tb.rule.TraceTimeout > 0 {
+		go tb.janitor()
+	}
+	return tb
+}
+
+// 包装日志引擎, 带 trace id 的日志进入缓存
+func (tb *tailBuffer) wrap(core zapcore.Core) zapcore.Core {
+	return &tailCore{Core: core, tb: tb}
+}
+
+// 标记 trace 开始, 用于统计耗时
+func (tb *tailBuffer) begin(id string) {
+	tb.mu.Lock()
+	tb.getTrace(id, time.Now())
+	tb.mu.Unlock()
+}
+
+// 调用方需持有锁
+func (tb *tailBuffer) getTrace(id string, now time.Time) *tailTrace {
+	tr, ok := tb.traces[id]
+	if ok {
+		return tr
+	}
+	if tb.rule.MaxTraces > 0 && len(tb.traces) >= tb.rule.MaxTraces {
+		var oldest *tailTrace
+		for _, v := range tb.traces {
+			if oldest == nil || v.start.Before(oldest.start) {
+				oldest = v
+			}
+		}
+		delete(tb.traces, oldest.id)
+		// 持有锁, 异步输出被挤出的 trace
+		go tb.settle(oldest, false, oldest.last)
+	}
+	tr = &tailTrace{id: id, start: now, last: now}
+	tb.traces[id] = tr
+	return tr
+}
+
+func (tb *tailBuffer) add(id string, e tailEntry) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tr := tb.getTrace(id, e.entry.Time)
+	tr.last = time.Now()
+	if e.entry.Level >= zapcore.ErrorLevel {
+		tr.failed = true
+	}
+	if tb.rule.MaxEntries > 0 && len(tr.entries) >= tb.rule.MaxEntries {
+		// 丢弃最早的非错误日志, 全是错误日志时丢弃最早的一条
+		idx := 0
+		for i, old := range tr.entries {
+			if old.entry.Level < zapcore.ErrorLevel {
+				idx = i
+				break
+			}
+		}
+		lc := metrics.level(tb.name, tr.entries[idx].entry.Level)
+		atomic.AddUint64(&lc.dropped, 1)
+		tr.entries = append(tr.entries[:idx], tr.entries[idx+1:]...)
+	}
+	tr.entries = append(tr.entries, e)
+}
+
+// 结束 trace, 按规则输出或丢弃
+func (tb *tailBuffer) finish(id string, failed bool) {
+	tb.mu.Lock()
+	tr, ok := tb.traces[id]
+	if ok {
+		delete(tb.traces, id)
+	}
+	tb.mu.Unlock()
+	if ok {
+		tb.settle(tr, failed, time.Now())
+	}
+}
+
+func (tb *tailBuffer) settle(tr *tailTrace, failed bool, end time.Time) {
+	if !tb.keep(tr, failed, end) {
+		for _, e := range tr.entries {
+			lc := metrics.level(tb.name, e.entry.Level)
+			atomic.AddUint64(&lc.sampled, 1)
+		}
+		return
+	}
+	for _, e := range tr.entries {
+		writeThrough(e.core, e.entry, e.fields)
+	}
+}
+
+func (tb *tailBuffer) keep(tr *tailTrace, failed bool, end time.Time) bool {
+	if failed || tr.failed {
+		return true
+	}
+	if tb.rule.SlowThreshold > 0 && end.Sub(tr.start) >= tb.rule.SlowThreshold {
+		return true
+	}
+	return sampled(tr.id, tb.rule.SampleRate)
+}
+
+// 按 trace id 哈希采样, 同一 trace 在各服务中决策一致
+func sampled(id string, rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	if rate >= 1 {
+		return true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return float64(h.Sum32()%10000) < rate*10000
+}
+
+// 定期清理遗弃的 trace
+func (tb *tailBuffer) janitor() {
+	ticker := time.NewTicker(tb.rule.TraceTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-tb.stop:
+			return
+		case now := <-ticker.C:
+			tb.expire(now)
+		}
+	}
+}
+
+func (tb *tailBuffer) expire(now time.Time) {
+	var expired []*tailTrace
+	tb.mu.Lock()
+	for id, tr := range tb.traces {
+		if now.Sub(tr.last) >= tb.rule.TraceTimeout {
+			expired = append(expired, tr)
+			delete(tb.traces, id)
+		}
+	}
+	tb.mu.Unlock()
+	for _, tr := range expired {
+		tb.settle(tr, false, tr.last)
+	}
+}
+
+// 停止清理协程并输出所有缓存
+func (tb *tailBuffer) close() {
+	tb.once.Do(func() {
+		close(tb.stop)
+		tb.mu.Lock()
+		traces := tb.traces
+		tb.traces = map[string]*tailTrace{}
+		tb.mu.Unlock()
+		for _, tr := range traces {
+			tb.settle(tr, false, tr.last)
+		}
+	})
+}
+
+type tailCore struct {
+	zapcore.Core
+	tb      *tailBuffer
+	traceId string // 通过 With 附加的 trace id, 如 WithContext 的子日志
+	traced  bool
+}
+
+func (tc *tailCore) With(fields []zapcore.Field) zapcore.Core {
+	child := &tailCore{Core: tc.Core.With(fields), tb: tc.tb, traceId: tc.traceId, traced: tc.traced}
+	if id, ok := traceIdFromFields(fields, tc.tb.key); ok {
+		child.traceId, child.traced = id, true
+	}
+	return child
+}
+
+func (tc *tailCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if tc.Enabled(ent.Level) {
+		return ce.AddCore(ent, tc)
+	}
+	return ce
+}
+
+func (tc *tailCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	// panic 及以上级别直接输出
+	if ent.Level < zapcore.DPanicLevel {
+		id, ok := traceIdFromFields(fields, tc.tb.key)
+		if !ok {
+			id, ok = tc.traceId, tc.traced
+		}
+		if ok {
+			tc.tb.add(id, tailEntry{
+				core:   tc.Core,
+				entry:  ent,
+				fields: append([]zapcore.Field(nil), fields...),
+			})
+			return nil
+		}
+	}
+	writeThrough(tc.Core, ent, fields)
+	return nil
+}
+
+// 经过内部引擎的级别判断后写入
+func writeThrough(core zapcore.Core, ent zapcore.Entry, fields []zapcore.Field) {
+	if ce := core.Check(ent, nil); ce != nil {
+		ce.Write(fields...)
+	}
+}
+
+// 从日志字段中提取 trace id
+func traceIdFromFields(fields []zapcore.Field, key string) (string, bool) {
+	for _, f := range fields {
+		if f.Key != key {
+			continue
+		}
+		enc := zapcore.NewMapObjectEncoder()
+		f.AddTo(enc)
+		v := enc.Fields[f.Key]
+		if v == nil {
+			return "", false
+		}
+		return fmt.Sprint(v), true
+	}
+	return "", false
+}
+
+func (lg *Logging) traceIdString(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	v := lg.registry().GetTraceId(ctx)
+	if v == nil {
+		return "", false
+	}
+	return fmt.Sprint(v), true
+}
+
+// 开始 trace, 耗时从此刻起算, 未调用时从 trace 的第一条日志起算
+func (lg *Logging) Begin(ctx context.Context) {
+	if lg.tail == nil {
+		return
+	}
+	if id, ok := lg.traceIdString(ctx); ok {
+		lg.tail.begin(id)
+	}
+}
+
+// 结束 trace, 有错误日志或超过耗时阈值时全量输出, 否则按比例采样
+func (lg *Logging) Finish(ctx context.Context) {
+	if lg.tail == nil {
+		return
+	}
+	if id, ok := lg.traceIdString(ctx); ok {
+		lg.tail.finish(id, false)
+	}
+}
+
+// 结束 trace, 无论采样结果都全量输出
+func (lg *Logging) FinishWithError(ctx context.Context) {
+	if lg.tail == nil {
+		return
+	}
+	if id, ok := lg.traceIdString(ctx); ok {
+		lg.tail.finish(id, true)
+	}
+}
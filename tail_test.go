@@ -0,0 +1,108 @@
+package logging
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func newTailTestLogger(rule *TailRule) (*Logging, *observer.ObservedLogs) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	lg := &Logging{status: true, opts: &Options{}, tail: newTailBuffer("tail", "trace_id", rule)}
+	lg.logger = zap.New(lg.tail.wrap(core)).Sugar()
+	return lg, logs
+}
+
+func TestTailSampling(t *testing.T) {
+	lg, logs := newTailTestLogger(&TailRule{MaxEntries: 2, MaxTraces: 10})
+	defer lg.tail.close()
+
+	okCtx := WithTraceId(context.Background(), "ok")
+	errCtx := WithTraceId(context.Background(), "err")
+
+	lg.Infowc("a", okCtx)
+	lg.Infowc("b", errCtx)
+	lg.Infow("untraced")
+	if logs.Len() != 1 {
+		t.Fatalf("want only untraced entry, got %d", logs.Len())
+	}
+
+	lg.Finish(okCtx)
+	if logs.Len() != 1 {
+		t.Fatalf("successful trace should be discarded, got %d", logs.Len())
+	}
+
+	lg.Infowc("c", errCtx)
+	lg.Errorwc("d", errCtx)
+	lg.Finish(errCtx)
+	msgs := []string{}
+	for _, e := range logs.All() {
+		msgs = append(msgs, e.Message)
+	}
+	// MaxEntries=2, 最早的 b 被丢弃
+	if len(msgs) != 3 || msgs[1] != "c" || msgs[2] != "d" {
+		t.Fatalf("unexpected entries %v", msgs)
+	}
+}
+
+func TestTailSamplingTimeout(t *testing.T) {
+	lg, logs := newTailTestLogger(&TailRule{SlowThreshold: time.Hour, TraceTimeout: 20 * time.Millisecond})
+	defer lg.tail.close()
+
+	lg.Errorwc("lost", WithTraceId(context.Background(), 1))
+	time.Sleep(100 * time.Millisecond)
+	if logs.Len() != 1 {
+		t.Fatalf("abandoned failed trace should be flushed, got %d", logs.Len())
+	}
+}
+
+// WithContext 的子日志不再逐条追加 trace id, 仍按 With 附加的 trace id 采样
+func TestTailSamplingWithContext(t *testing.T) {
+	lg, logs := newTailTestLogger(&TailRule{MaxEntries: 10, MaxTraces: 10})
+	defer lg.tail.close()
+
+	okCtx := WithTraceId(context.Background(), "ok")
+	errCtx := WithTraceId(context.Background(), "err")
+
+	lg.WithContext(okCtx).Infow("a")
+	child := lg.WithContext(errCtx)
+	child.Infow("b")
+	child.Errorwc("c", errCtx)
+	if logs.Len() != 0 {
+		t.Fatalf("traced entries should be buffered, got %d", logs.Len())
+	}
+
+	lg.Finish(okCtx)
+	lg.Finish(errCtx)
+	if logs.Len() != 2 || logs.All()[0].Message != "b" || logs.All()[1].ContextMap()["trace_id"] != "err" {
+		t.Fatalf("failed trace should be flushed with its trace id, got %v", logs.All())
+	}
+}
+
+// 处理函数 panic 时中间件全量输出缓存的日志, panic 原样向上传递
+func TestTailSamplingMiddlewarePanic(t *testing.T) {
+	lg, logs := newTailTestLogger(&TailRule{MaxEntries: 10, MaxTraces: 10})
+	defer lg.tail.close()
+
+	h := lg.HTTPMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lg.Infowc("before panic", r.Context())
+		panic(http.ErrAbortHandler)
+	}))
+	func() {
+		defer func() {
+			if rc := recover(); rc != http.ErrAbortHandler {
+				t.Fatalf("panic should propagate unchanged, got %v", rc)
+			}
+		}()
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}()
+	if logs.Len() != 1 {
+		t.Fatalf("panicked request should be flushed, got %d", logs.Len())
+	}
+}